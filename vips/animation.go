@@ -0,0 +1,225 @@
+package vips
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// FrameDisposal represents how the area of an animation frame is treated before the next frame is rendered
+type FrameDisposal int
+
+// FrameDisposal enum, the values match the GIF disposal methods
+const (
+	FrameDisposalUnspecified FrameDisposal = iota
+	FrameDisposalNone                      // the frame is left in place
+	FrameDisposalBackground                // the frame area is cleared to the background
+	FrameDisposalPrevious                  // the frame area is restored to the previous frame (GIF only)
+)
+
+var (
+	errInvalidGIF         = errors.New("invalid GIF block structure")
+	errFrameDisposalCount = errors.New("number of frame disposals does not match the number of frames")
+)
+
+// ReadFrameDisposals returns the disposal method of each frame of an animated GIF or WebP, e.g. to inspect
+// a source before transcoding it. libvips renders every frame onto the full canvas when loading, so the
+// disposal methods are already applied to the loaded frames. WebP frames are either FrameDisposalNone or
+// FrameDisposalBackground.
+func ReadFrameDisposals(buf []byte) ([]FrameDisposal, error) {
+	switch DetermineImageType(buf) {
+	case ImageTypeGIF:
+		return readGIFDisposals(buf)
+	case ImageTypeWEBP:
+		return readWebPDisposals(buf), nil
+	}
+	return nil, ErrUnsupportedImageFormat
+}
+
+// WriteFrameDisposals returns a copy of an animated GIF or WebP with the disposal method of each frame
+// replaced, e.g. to set FrameDisposalBackground on the frames of an exported animation with transparency,
+// so that earlier frames don't show through. The libvips savers pick the disposal methods themselves, so
+// this is applied to the exported buffer. There must be one disposal per frame, and WebP does not support
+// FrameDisposalPrevious.
+func WriteFrameDisposals(buf []byte, disposals []FrameDisposal) ([]byte, error) {
+	switch DetermineImageType(buf) {
+	case ImageTypeGIF:
+		return writeGIFDisposals(buf, disposals)
+	case ImageTypeWEBP:
+		return writeWebPDisposals(buf, disposals)
+	}
+	return nil, ErrUnsupportedImageFormat
+}
+
+// gifFrame holds the position of the packed fields of the graphic control extension of a GIF frame,
+// or -1 if it has none, and the position of its image descriptor
+type gifFrame struct {
+	control    int
+	descriptor int
+}
+
+// readGIFFrames walks the blocks of a GIF, see https://www.w3.org/Graphics/GIF/spec-gif89a.txt
+func readGIFFrames(buf []byte) ([]gifFrame, error) {
+	// header and logical screen descriptor
+	pos := 13
+	if len(buf) < pos {
+		return nil, errInvalidGIF
+	}
+	if buf[10]&0x80 != 0 {
+		pos += 3 << (buf[10]&0x07 + 1)
+	}
+
+	var frames []gifFrame
+	control := -1
+
+	for pos < len(buf) {
+		switch buf[pos] {
+		case 0x21:
+			if pos+2 >= len(buf) {
+				return nil, errInvalidGIF
+			}
+			// graphic control extension of the next frame
+			if buf[pos+1] == 0xF9 && pos+3 < len(buf) && buf[pos+2] == 4 {
+				control = pos + 3
+			}
+			next, err := skipGIFSubBlocks(buf, pos+2)
+			if err != nil {
+				return nil, err
+			}
+			pos = next
+		case 0x2C:
+			// image descriptor, followed by the local color table and the LZW minimum code size
+			if pos+10 > len(buf) {
+				return nil, errInvalidGIF
+			}
+			next := pos + 10
+			if buf[pos+9]&0x80 != 0 {
+				next += 3 << (buf[pos+9]&0x07 + 1)
+			}
+			next, err := skipGIFSubBlocks(buf, next+1)
+			if err != nil {
+				return nil, err
+			}
+
+			frames = append(frames, gifFrame{control: control, descriptor: pos})
+			control = -1
+			pos = next
+		case 0x3B:
+			return frames, nil
+		default:
+			return nil, errInvalidGIF
+		}
+	}
+
+	// tolerate a missing trailer
+	return frames, nil
+}
+
+func readGIFDisposals(buf []byte) ([]FrameDisposal, error) {
+	frames, err := readGIFFrames(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	disposals := make([]FrameDisposal, len(frames))
+	for i, frame := range frames {
+		if frame.control < 0 {
+			continue
+		}
+		if disposal := FrameDisposal(buf[frame.control] >> 2 & 0x07); disposal <= FrameDisposalPrevious {
+			disposals[i] = disposal
+		}
+	}
+	return disposals, nil
+}
+
+// writeGIFDisposals sets the disposal bits of the graphic control extensions, frames without one get
+// an extension with no delay and no transparency
+func writeGIFDisposals(buf []byte, disposals []FrameDisposal) ([]byte, error) {
+	frames, err := readGIFFrames(buf)
+	if err != nil {
+		return nil, err
+	}
+	if len(frames) != len(disposals) {
+		return nil, fmt.Errorf("%w: %d disposals for %d frames", errFrameDisposalCount, len(disposals), len(frames))
+	}
+
+	out := make([]byte, 0, len(buf)+8*len(frames))
+	pos := 0
+	for i, frame := range frames {
+		if disposals[i] < FrameDisposalUnspecified || disposals[i] > FrameDisposalPrevious {
+			return nil, fmt.Errorf("invalid frame disposal %d", disposals[i])
+		}
+		disposal := byte(disposals[i]) << 2
+		if frame.control >= 0 {
+			out = append(out, buf[pos:frame.control]...)
+			out = append(out, buf[frame.control]&^0x1C|disposal)
+			pos = frame.control + 1
+			continue
+		}
+
+		out = append(out, buf[pos:frame.descriptor]...)
+		out = append(out, 0x21, 0xF9, 0x04, disposal, 0x00, 0x00, 0x00, 0x00)
+		pos = frame.descriptor
+	}
+	return append(out, buf[pos:]...), nil
+}
+
+// skipGIFSubBlocks returns the position after the data sub-blocks starting at pos
+func skipGIFSubBlocks(buf []byte, pos int) (int, error) {
+	for {
+		if pos >= len(buf) {
+			return 0, errInvalidGIF
+		}
+		size := int(buf[pos])
+		pos++
+		if size == 0 {
+			return pos, nil
+		}
+		pos += size
+	}
+}
+
+// readWebPDisposals reads the dispose flag of the ANMF chunks of an animated WebP
+func readWebPDisposals(buf []byte) []FrameDisposal {
+	var disposals []FrameDisposal
+	for _, chunk := range readWebPChunks(buf) {
+		if !bytes.Equal(chunk.fourCC, webpChunkANMF) || len(chunk.data) < 16 {
+			continue
+		}
+		if chunk.data[15]&0x01 != 0 {
+			disposals = append(disposals, FrameDisposalBackground)
+		} else {
+			disposals = append(disposals, FrameDisposalNone)
+		}
+	}
+	return disposals
+}
+
+// writeWebPDisposals sets the dispose flag of the ANMF chunks of an animated WebP
+func writeWebPDisposals(buf []byte, disposals []FrameDisposal) ([]byte, error) {
+	out := make([]byte, len(buf))
+	copy(out, buf)
+
+	var frames [][]byte
+	for _, chunk := range readWebPChunks(out) {
+		if bytes.Equal(chunk.fourCC, webpChunkANMF) && len(chunk.data) >= 16 {
+			frames = append(frames, chunk.data)
+		}
+	}
+	if len(frames) != len(disposals) {
+		return nil, fmt.Errorf("%w: %d disposals for %d frames", errFrameDisposalCount, len(disposals), len(frames))
+	}
+
+	for i, frame := range frames {
+		switch disposals[i] {
+		case FrameDisposalBackground:
+			frame[15] |= 0x01
+		case FrameDisposalPrevious:
+			return nil, fmt.Errorf("%w: WebP frames cannot be disposed to the previous frame", ErrUnsupportedImageFormat)
+		default:
+			frame[15] &^= 0x01
+		}
+	}
+	return out, nil
+}
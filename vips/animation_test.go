@@ -0,0 +1,108 @@
+package vips
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadFrameDisposals__GIF(t *testing.T) {
+	palette := color.Palette{color.Black, color.White}
+	anim := &gif.GIF{
+		Disposal: []byte{gif.DisposalNone, gif.DisposalBackground, gif.DisposalPrevious},
+	}
+	for i := 0; i < 3; i++ {
+		anim.Image = append(anim.Image, image.NewPaletted(image.Rect(0, 0, 4, 4), palette))
+		anim.Delay = append(anim.Delay, 10)
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, gif.EncodeAll(&buf, anim))
+
+	disposals, err := ReadFrameDisposals(buf.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, []FrameDisposal{FrameDisposalNone, FrameDisposalBackground, FrameDisposalPrevious}, disposals)
+}
+
+func TestReadFrameDisposals__WebP(t *testing.T) {
+	buf, err := ioutil.ReadFile(resources + "webp-animated+alpha.webp")
+	require.NoError(t, err)
+
+	disposals, err := ReadFrameDisposals(buf)
+	require.NoError(t, err)
+	assert.Len(t, disposals, 14)
+	for _, disposal := range disposals {
+		assert.Contains(t, []FrameDisposal{FrameDisposalNone, FrameDisposalBackground}, disposal)
+	}
+}
+
+func TestWriteFrameDisposals__GIF(t *testing.T) {
+	palette := color.Palette{color.Transparent, color.White}
+	anim := &gif.GIF{
+		// frames without delay or disposal are written without a graphic control extension
+		Delay:    []int{10, 0, 10},
+		Disposal: []byte{gif.DisposalNone, 0, gif.DisposalNone},
+	}
+	for i := 0; i < 3; i++ {
+		anim.Image = append(anim.Image, image.NewPaletted(image.Rect(0, 0, 4, 4), palette))
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, gif.EncodeAll(&buf, anim))
+
+	want := []FrameDisposal{FrameDisposalBackground, FrameDisposalPrevious, FrameDisposalBackground}
+	out, err := WriteFrameDisposals(buf.Bytes(), want)
+	require.NoError(t, err)
+
+	disposals, err := ReadFrameDisposals(out)
+	require.NoError(t, err)
+	assert.Equal(t, want, disposals)
+
+	decoded, err := gif.DecodeAll(bytes.NewReader(out))
+	require.NoError(t, err)
+	assert.Equal(t, []byte{gif.DisposalBackground, gif.DisposalPrevious, gif.DisposalBackground}, decoded.Disposal)
+	assert.Equal(t, []int{10, 0, 10}, decoded.Delay)
+
+	_, err = WriteFrameDisposals(buf.Bytes(), want[:2])
+	assert.Error(t, err)
+}
+
+func TestWriteFrameDisposals__WebP(t *testing.T) {
+	buf, err := ioutil.ReadFile(resources + "webp-animated+alpha.webp")
+	require.NoError(t, err)
+
+	want := make([]FrameDisposal, 14)
+	for i := range want {
+		want[i] = FrameDisposalBackground
+		if i%2 == 0 {
+			want[i] = FrameDisposalNone
+		}
+	}
+
+	out, err := WriteFrameDisposals(buf, want)
+	require.NoError(t, err)
+	assert.Equal(t, len(buf), len(out))
+
+	disposals, err := ReadFrameDisposals(out)
+	require.NoError(t, err)
+	assert.Equal(t, want, disposals)
+
+	want[0] = FrameDisposalPrevious
+	_, err = WriteFrameDisposals(buf, want)
+	assert.True(t, errors.Is(err, ErrUnsupportedImageFormat))
+}
+
+func TestReadFrameDisposals__Unsupported(t *testing.T) {
+	buf, err := ioutil.ReadFile(resources + "png-8bit.png")
+	require.NoError(t, err)
+
+	_, err = ReadFrameDisposals(buf)
+	assert.Equal(t, ErrUnsupportedImageFormat, err)
+}
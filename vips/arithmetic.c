@@ -1,4 +1,5 @@
 #include "arithmetic.h"
+#include <math.h>
 
 int add(VipsImage *left, VipsImage *right, VipsImage **out) {
 	return vips_add(left, right, out, NULL);
@@ -23,3 +24,139 @@ int linear1(VipsImage *in, VipsImage **out, double a, double b) {
 int invert_image(VipsImage *in, VipsImage **out) {
 	return vips_invert(in, out, NULL);
 }
+
+// invert_cmyk inverts the four ink bands and keeps any extra bands such as alpha
+int invert_cmyk(VipsImage *in, VipsImage **out) {
+	if (in->Bands <= 4) {
+		return vips_invert(in, out, NULL);
+	}
+
+	VipsImage *base = vips_image_new();
+	VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 3);
+
+	if (
+		vips_extract_band(in, &t[0], 0, "n", 4, NULL) ||
+		vips_invert(t[0], &t[1], NULL) ||
+		vips_extract_band(in, &t[2], 4, "n", in->Bands - 4, NULL) ||
+		vips_bandjoin2(t[1], t[2], out, NULL)
+		) {
+		g_object_unref(base);
+		return 1;
+	}
+
+	g_object_unref(base);
+	return 0;
+}
+
+// ssim computes the mean structural similarity of the luminance of two images of the same size,
+// using a gaussian window with sigma 1.5 as in the original paper
+int ssim(VipsImage *left, VipsImage *right, double *out) {
+	const double c1 = (0.01 * 255) * (0.01 * 255);
+	const double c2 = (0.03 * 255) * (0.03 * 255);
+	const double sigma = 1.5;
+
+	VipsImage *base = vips_image_new();
+	VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 29);
+
+	if (
+		vips_colourspace(left, &t[0], VIPS_INTERPRETATION_B_W, NULL) ||
+		vips_extract_band(t[0], &t[1], 0, NULL) ||
+		vips_cast(t[1], &t[2], VIPS_FORMAT_FLOAT, NULL) ||
+		vips_colourspace(right, &t[3], VIPS_INTERPRETATION_B_W, NULL) ||
+		vips_extract_band(t[3], &t[4], 0, NULL) ||
+		vips_cast(t[4], &t[5], VIPS_FORMAT_FLOAT, NULL)
+		) {
+		g_object_unref(base);
+		return 1;
+	}
+
+	// means, variances and covariance over the window
+	if (
+		vips_gaussblur(t[2], &t[6], sigma, NULL) ||
+		vips_gaussblur(t[5], &t[7], sigma, NULL) ||
+		vips_multiply(t[2], t[2], &t[8], NULL) ||
+		vips_multiply(t[5], t[5], &t[9], NULL) ||
+		vips_multiply(t[2], t[5], &t[10], NULL) ||
+		vips_gaussblur(t[8], &t[11], sigma, NULL) ||
+		vips_gaussblur(t[9], &t[12], sigma, NULL) ||
+		vips_gaussblur(t[10], &t[13], sigma, NULL) ||
+		vips_multiply(t[6], t[6], &t[14], NULL) ||
+		vips_multiply(t[7], t[7], &t[15], NULL) ||
+		vips_multiply(t[6], t[7], &t[16], NULL) ||
+		vips_subtract(t[11], t[14], &t[17], NULL) ||
+		vips_subtract(t[12], t[15], &t[18], NULL) ||
+		vips_subtract(t[13], t[16], &t[19], NULL)
+		) {
+		g_object_unref(base);
+		return 1;
+	}
+
+	// (2 * mx * my + c1) * (2 * sxy + c2) / ((mx^2 + my^2 + c1) * (sx^2 + sy^2 + c2))
+	if (
+		vips_linear1(t[16], &t[20], 2.0, c1, NULL) ||
+		vips_linear1(t[19], &t[21], 2.0, c2, NULL) ||
+		vips_multiply(t[20], t[21], &t[22], NULL) ||
+		vips_add(t[14], t[15], &t[23], NULL) ||
+		vips_linear1(t[23], &t[24], 1.0, c1, NULL) ||
+		vips_add(t[17], t[18], &t[25], NULL) ||
+		vips_linear1(t[25], &t[26], 1.0, c2, NULL) ||
+		vips_multiply(t[24], t[26], &t[27], NULL) ||
+		vips_divide(t[22], t[27], &t[28], NULL) ||
+		vips_avg(t[28], out, NULL)
+		) {
+		g_object_unref(base);
+		return 1;
+	}
+
+	g_object_unref(base);
+	return 0;
+}
+
+// non_finite_mask sets every sample of mask to 255 where the float image has a NaN or infinite value,
+// NaN is the only value which isn't equal to itself
+static int non_finite_mask(VipsObject *scope, VipsImage *in, VipsImage **mask) {
+	VipsImage **t = (VipsImage **) vips_object_local_array(scope, 3);
+
+	return (
+		vips_relational(in, in, &t[0], VIPS_OPERATION_RELATIONAL_NOTEQ, NULL) ||
+		vips_abs(in, &t[1], NULL) ||
+		vips_relational_const1(t[1], &t[2], VIPS_OPERATION_RELATIONAL_EQUAL, INFINITY, NULL) ||
+		vips_boolean(t[0], t[2], mask, VIPS_OPERATION_BOOLEAN_OR, NULL)
+	);
+}
+
+int find_non_finite(VipsImage *in, int *found) {
+	VipsImage *base = vips_image_new();
+	VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 1);
+	double max;
+
+	if (non_finite_mask(VIPS_OBJECT(base), in, &t[0]) || vips_max(t[0], &max, NULL)) {
+		g_object_unref(base);
+		return 1;
+	}
+
+	*found = max > 0;
+
+	g_object_unref(base);
+	return 0;
+}
+
+int replace_non_finite(VipsImage *in, VipsImage **out, double value) {
+	VipsImage *base = vips_image_new();
+	VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 5);
+
+	if (
+		non_finite_mask(VIPS_OBJECT(base), in, &t[0]) ||
+		vips_black(&t[1], in->Xsize, in->Ysize, "bands", in->Bands, NULL) ||
+		vips_linear1(t[1], &t[2], 1.0, value, NULL) ||
+		vips_ifthenelse(t[0], t[2], in, &t[3], NULL) ||
+		vips_cast(t[3], &t[4], in->BandFmt, NULL) ||
+		vips_copy(t[4], out, "interpretation", in->Type, NULL)
+		) {
+		g_object_unref(base);
+		return 1;
+	}
+
+	g_object_unref(base);
+	return 0;
+}
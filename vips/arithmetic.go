@@ -75,3 +75,47 @@ func vipsInvert(in *C.VipsImage) (*C.VipsImage, error) {
 
 	return out, nil
 }
+
+func vipsInvertCMYK(in *C.VipsImage) (*C.VipsImage, error) {
+	incOpCounter("invert_cmyk")
+	var out *C.VipsImage
+
+	if err := C.invert_cmyk(in, &out); err != 0 {
+		return nil, handleImageError(out)
+	}
+
+	return out, nil
+}
+
+func vipsSSIM(left *C.VipsImage, right *C.VipsImage) (float64, error) {
+	incOpCounter("ssim")
+	var out C.double
+
+	if err := C.ssim(left, right, &out); err != 0 {
+		return 0, handleVipsError()
+	}
+
+	return float64(out), nil
+}
+
+func vipsFindNonFinite(in *C.VipsImage) (bool, error) {
+	incOpCounter("find_non_finite")
+	var found C.int
+
+	if err := C.find_non_finite(in, &found); err != 0 {
+		return false, handleVipsError()
+	}
+
+	return found != 0, nil
+}
+
+func vipsReplaceNonFinite(in *C.VipsImage, value float64) (*C.VipsImage, error) {
+	incOpCounter("replace_non_finite")
+	var out *C.VipsImage
+
+	if err := C.replace_non_finite(in, &out, C.double(value)); err != 0 {
+		return nil, handleImageError(out)
+	}
+
+	return out, nil
+}
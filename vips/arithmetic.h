@@ -9,3 +9,7 @@ int divide(VipsImage *left, VipsImage *right, VipsImage **out);
 int linear(VipsImage *in, VipsImage **out, double *a, double *b, int n);
 int linear1(VipsImage *in, VipsImage **out, double a, double b);
 int invert_image(VipsImage *in, VipsImage **out);
+int invert_cmyk(VipsImage *in, VipsImage **out);
+int ssim(VipsImage *left, VipsImage *right, double *out);
+int find_non_finite(VipsImage *in, int *found);
+int replace_non_finite(VipsImage *in, VipsImage **out, double value);
@@ -0,0 +1,94 @@
+package vips
+
+import "sync"
+
+// BatchItem is an image to transcode with TranscodeBatch. Params are the export params of the item, if nil
+// the image is exported in its source format as with Export. ImportOptions are applied when loading the item.
+type BatchItem struct {
+	Buf           []byte
+	Params        *ExportParams
+	ImportOptions []ImportOption
+}
+
+// BatchResult is the outcome of transcoding a BatchItem. Err is set if the item failed to load or export.
+type BatchResult struct {
+	Buf      []byte
+	Metadata *ImageMetadata
+	Err      error
+}
+
+// Transcode loads an image from the buffer and exports it with the given params in one call.
+func Transcode(buf []byte, params *ExportParams, o ...ImportOption) ([]byte, *ImageMetadata, error) {
+	img, err := NewImageFromBuffer(buf, o...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer img.Close()
+
+	return img.Export(params)
+}
+
+// AutoOrientAndStrip prepares a photo for the web in one call: the image is loaded upright according to its EXIF
+// orientation, the orientation and the other metadata such as EXIF and XMP are removed, and it is exported with the
+// given params (nil exports in the source format). The ICC profile is kept so that colors are displayed correctly.
+func AutoOrientAndStrip(buf []byte, params *ExportParams) ([]byte, error) {
+	img, err := NewImageFromBuffer(buf, AutorotateParamImportOption(true))
+	if err != nil {
+		return nil, err
+	}
+	defer img.Close()
+
+	// loaders without autorotate support leave the orientation to be applied, animations are not rotated
+	if img.Pages() == 1 {
+		if err := img.ApplyOrientation(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := img.RemoveMetadata(); err != nil {
+		return nil, err
+	}
+
+	if err := img.RemoveOrientation(); err != nil {
+		return nil, err
+	}
+
+	out, _, err := img.Export(params)
+	return out, err
+}
+
+// TranscodeBatch transcodes the items with at most concurrency items in flight at once and returns the
+// results in the order of the items. A failing item does not stop the others. A concurrency below 1 is
+// treated as 1. Note that libvips also parallelizes each operation, see Config.ConcurrencyLevel.
+func TranscodeBatch(items []BatchItem, concurrency int) []BatchResult {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if concurrency > len(items) {
+		concurrency = len(items)
+	}
+
+	results := make([]BatchResult, len(items))
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	wg.Add(concurrency)
+	for w := 0; w < concurrency; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				item := items[i]
+				buf, metadata, err := Transcode(item.Buf, item.Params, item.ImportOptions...)
+				results[i] = BatchResult{Buf: buf, Metadata: metadata, Err: err}
+			}
+		}()
+	}
+
+	for i := range items {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return results
+}
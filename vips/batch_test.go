@@ -0,0 +1,87 @@
+package vips
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTranscodeBatch(t *testing.T) {
+	Startup(nil)
+
+	png, err := ioutil.ReadFile(resources + "png-8bit.png")
+	require.NoError(t, err)
+	jpeg, err := ioutil.ReadFile(resources + "jpg-24bit.jpg")
+	require.NoError(t, err)
+
+	items := []BatchItem{
+		{Buf: png, Params: NewDefaultWEBPExportParams()},
+		{Buf: []byte("not an image")},
+		{Buf: jpeg, Params: NewDefaultPNGExportParams()},
+		{Buf: png},
+	}
+
+	results := TranscodeBatch(items, 2)
+	require.Len(t, results, len(items))
+
+	require.NoError(t, results[0].Err)
+	assert.Equal(t, ImageTypeWEBP, DetermineImageType(results[0].Buf))
+	assert.Equal(t, 200, results[0].Metadata.Width)
+
+	assert.Error(t, results[1].Err)
+	assert.Nil(t, results[1].Buf)
+
+	require.NoError(t, results[2].Err)
+	assert.Equal(t, ImageTypePNG, DetermineImageType(results[2].Buf))
+
+	require.NoError(t, results[3].Err)
+	assert.Equal(t, ImageTypePNG, results[3].Metadata.Format)
+}
+
+func TestTranscodeBatch__Empty(t *testing.T) {
+	assert.Empty(t, TranscodeBatch(nil, 4))
+}
+
+func TestAutoOrientAndStrip(t *testing.T) {
+	Startup(nil)
+
+	buf, err := ioutil.ReadFile(resources + "jpg-orientation-6.jpg")
+	require.NoError(t, err)
+
+	unrotated, err := NewImageFromBuffer(buf)
+	require.NoError(t, err)
+	require.Equal(t, 6, unrotated.GetOrientation())
+
+	out, err := AutoOrientAndStrip(buf, nil)
+	require.NoError(t, err)
+	assert.Equal(t, ImageTypeJPEG, DetermineImageType(out))
+
+	img, err := NewImageFromBuffer(out)
+	require.NoError(t, err)
+	assert.Equal(t, 0, img.GetOrientation())
+	assert.False(t, img.HasField("exif-data"))
+	assert.Equal(t, unrotated.Height(), img.Width())
+	assert.Equal(t, unrotated.Width(), img.Height())
+}
+
+func TestAutoOrientAndStrip__KeepsICCProfile(t *testing.T) {
+	Startup(nil)
+
+	buf, err := ioutil.ReadFile(resources + "jpg-24bit-icc-adobe-rgb.jpg")
+	require.NoError(t, err)
+
+	out, err := AutoOrientAndStrip(buf, NewDefaultWEBPExportParams())
+	require.NoError(t, err)
+	assert.Equal(t, ImageTypeWEBP, DetermineImageType(out))
+
+	img, err := NewImageFromBuffer(out)
+	require.NoError(t, err)
+	assert.True(t, img.HasICCProfile())
+}
+
+func TestAutoOrientAndStrip__Invalid(t *testing.T) {
+	_, err := AutoOrientAndStrip([]byte("not an image"), nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,126 @@
+package vips
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// blurHashCharacters is the base 83 alphabet of BlurHash strings
+const blurHashCharacters = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// encodeBlurHash encodes 8-bit RGBA pixels as a BlurHash with xComp by yComp components, see
+// https://github.com/woltapp/blurhash/blob/master/Algorithm.md. Alpha is ignored.
+func encodeBlurHash(pixels []byte, width, height, xComp, yComp int) (string, error) {
+	if xComp < 1 || xComp > 9 || yComp < 1 || yComp > 9 {
+		return "", fmt.Errorf("BlurHash components must be between 1 and 9, got %dx%d", xComp, yComp)
+	}
+	if width < 1 || height < 1 || len(pixels) < width*height*4 {
+		return "", fmt.Errorf("invalid pixel data for a %dx%d image", width, height)
+	}
+
+	// the basis only depends on the column or row, so it is computed once per component
+	cosX := make([][]float64, xComp)
+	for i := range cosX {
+		cosX[i] = make([]float64, width)
+		for x := 0; x < width; x++ {
+			cosX[i][x] = math.Cos(math.Pi * float64(i) * float64(x) / float64(width))
+		}
+	}
+	cosY := make([][]float64, yComp)
+	for j := range cosY {
+		cosY[j] = make([]float64, height)
+		for y := 0; y < height; y++ {
+			cosY[j][y] = math.Cos(math.Pi * float64(j) * float64(y) / float64(height))
+		}
+	}
+
+	var linear [256]float64
+	for v := range linear {
+		linear[v] = sRGBToLinear(v)
+	}
+
+	factors := make([][3]float64, 0, xComp*yComp)
+	for j := 0; j < yComp; j++ {
+		for i := 0; i < xComp; i++ {
+			var factor [3]float64
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					basis := cosX[i][x] * cosY[j][y]
+					offset := (y*width + x) * 4
+					factor[0] += basis * linear[pixels[offset]]
+					factor[1] += basis * linear[pixels[offset+1]]
+					factor[2] += basis * linear[pixels[offset+2]]
+				}
+			}
+
+			scale := 1.0 / float64(width*height)
+			if i != 0 || j != 0 {
+				scale *= 2
+			}
+			factors = append(factors, [3]float64{factor[0] * scale, factor[1] * scale, factor[2] * scale})
+		}
+	}
+
+	var hash strings.Builder
+	hash.WriteString(encodeBase83((xComp-1)+(yComp-1)*9, 1))
+
+	maximumValue := 1.0
+	if len(factors) > 1 {
+		actualMax := 0.0
+		for _, factor := range factors[1:] {
+			for _, v := range factor {
+				actualMax = math.Max(actualMax, math.Abs(v))
+			}
+		}
+
+		quantisedMax := int(math.Max(0, math.Min(82, math.Floor(actualMax*166-0.5))))
+		maximumValue = float64(quantisedMax+1) / 166
+		hash.WriteString(encodeBase83(quantisedMax, 1))
+	} else {
+		hash.WriteString(encodeBase83(0, 1))
+	}
+
+	dc := factors[0]
+	hash.WriteString(encodeBase83(linearToSRGB(dc[0])<<16|linearToSRGB(dc[1])<<8|linearToSRGB(dc[2]), 4))
+
+	for _, factor := range factors[1:] {
+		value := 0
+		for _, v := range factor {
+			quantised := int(math.Max(0, math.Min(18, math.Floor(signPow(v/maximumValue, 0.5)*9+9.5))))
+			value = value*19 + quantised
+		}
+		hash.WriteString(encodeBase83(value, 2))
+	}
+
+	return hash.String(), nil
+}
+
+func encodeBase83(value, length int) string {
+	digits := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		digits[i] = blurHashCharacters[value%83]
+		value /= 83
+	}
+	return string(digits)
+}
+
+func sRGBToLinear(value int) float64 {
+	v := float64(value) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(value float64) int {
+	v := math.Max(0, math.Min(1, value))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(value, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(value), exp), value)
+}
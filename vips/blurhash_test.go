@@ -0,0 +1,39 @@
+package vips
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_EncodeBlurHash_Uniform(t *testing.T) {
+	pixels := bytes.Repeat([]byte{255, 255, 255, 255}, 8*6)
+
+	hash, err := encodeBlurHash(pixels, 8, 6, 4, 3)
+	require.NoError(t, err)
+	assert.Equal(t, "L0TSUAfQfQfQfQfQfQfQfQfQfQfQ", hash)
+}
+
+func Test_EncodeBlurHash_InvalidComponents(t *testing.T) {
+	pixels := bytes.Repeat([]byte{0, 0, 0, 255}, 4)
+
+	_, err := encodeBlurHash(pixels, 2, 2, 0, 3)
+	assert.Error(t, err)
+
+	_, err = encodeBlurHash(pixels, 2, 2, 4, 10)
+	assert.Error(t, err)
+}
+
+func TestImageRef_BlurHash(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "png-24bit.png")
+	require.NoError(t, err)
+
+	hash, err := img.BlurHash(4, 3)
+	require.NoError(t, err)
+	assert.Len(t, hash, 4+2*4*3)
+	assert.Equal(t, "L", hash[:1])
+}
@@ -1,4 +1,5 @@
 #include "color.h"
+#include <math.h>
 #include <unistd.h>
 
 int is_colorspace_supported(VipsImage *in)
@@ -11,6 +12,12 @@ int to_colorspace(VipsImage *in, VipsImage **out, VipsInterpretation space)
 	return vips_colourspace(in, out, space, NULL);
 }
 
+// https://libvips.github.io/libvips/API/current/libvips-colour.html#vips-icc-transform
+int icc_transform_embedded(VipsImage *in, VipsImage **out, const char *output_profile, VipsIntent intent)
+{
+	return vips_icc_transform(in, out, output_profile, "embedded", TRUE, "intent", intent, NULL);
+}
+
 // https://libvips.github.io/libvips/API/8.6/libvips-colour.html#vips-icc-transform
 int optimize_icc_profile(VipsImage *in, VipsImage **out, int isCmyk, char *srgb_profile_path, char *gray_profile_path)
 {
@@ -48,3 +55,101 @@ int optimize_icc_profile(VipsImage *in, VipsImage **out, int isCmyk, char *srgb_
 
 	return result;
 }
+
+// tone_map compresses linear scRGB values to the [0, 1] range with the given operator and encodes the result as 8-bit sRGB.
+// Extra bands such as alpha are passed through unchanged.
+int tone_map(VipsImage *in, VipsImage **out, int operator, double exposure, double bias)
+{
+	VipsImage *base = vips_image_new();
+	VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 14);
+	double max;
+
+	if (
+		vips_colourspace(in, &t[0], VIPS_INTERPRETATION_scRGB, NULL) ||
+		vips_extract_band(t[0], &t[1], 0, "n", 3, NULL) ||
+		vips_linear1(t[1], &t[2], exposure, 0.0, NULL)
+		) {
+		g_object_unref(base);
+		return 1;
+	}
+
+	if (operator == TONE_MAP_DRAGO) {
+		// L = log(1 + x) / log(2 + 8 * (x / max) ^ (log(bias) / log(0.5))) / log10(1 + max)
+		if (vips_max(t[2], &max, NULL)) {
+			g_object_unref(base);
+			return 1;
+		}
+		if (max <= 0) {
+			max = 1;
+		}
+		if (
+			vips_linear1(t[2], &t[3], 1.0, 1.0, NULL) ||
+			vips_log(t[3], &t[4], NULL) ||
+			vips_linear1(t[2], &t[5], 1.0 / max, 0.0, NULL) ||
+			vips_math2_const1(t[5], &t[6], VIPS_OPERATION_MATH2_POW, log(bias) / log(0.5), NULL) ||
+			vips_linear1(t[6], &t[7], 8.0, 2.0, NULL) ||
+			vips_log(t[7], &t[8], NULL) ||
+			vips_divide(t[4], t[8], &t[9], NULL) ||
+			vips_linear1(t[9], &t[10], 1.0 / log10(1.0 + max), 0.0, NULL)
+			) {
+			g_object_unref(base);
+			return 1;
+		}
+	} else {
+		// L = x / (1 + x)
+		if (
+			vips_linear1(t[2], &t[3], 1.0, 1.0, NULL) ||
+			vips_divide(t[2], t[3], &t[10], NULL)
+			) {
+			g_object_unref(base);
+			return 1;
+		}
+	}
+
+	if (t[0]->Bands > 3) {
+		if (
+			vips_extract_band(t[0], &t[11], 3, "n", t[0]->Bands - 3, NULL) ||
+			vips_bandjoin2(t[10], t[11], &t[12], NULL)
+			) {
+			g_object_unref(base);
+			return 1;
+		}
+	} else {
+		t[12] = t[10];
+		g_object_ref(t[12]);
+	}
+
+	if (
+		vips_copy(t[12], &t[13], "interpretation", VIPS_INTERPRETATION_scRGB, NULL) ||
+		vips_colourspace(t[13], out, VIPS_INTERPRETATION_sRGB, NULL)
+		) {
+		g_object_unref(base);
+		return 1;
+	}
+
+	g_object_unref(base);
+	return 0;
+}
+
+// https://libvips.github.io/libvips/API/current/libvips-colour.html#vips-dE00
+// Both images are converted to Lab, extra bands such as alpha are not compared.
+int max_delta_e00(VipsImage *left, VipsImage *right, double *out)
+{
+	VipsImage *base = vips_image_new();
+	VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 5);
+
+	if (
+		vips_colourspace(left, &t[0], VIPS_INTERPRETATION_LAB, NULL) ||
+		vips_extract_band(t[0], &t[1], 0, "n", 3, NULL) ||
+		vips_colourspace(right, &t[2], VIPS_INTERPRETATION_LAB, NULL) ||
+		vips_extract_band(t[2], &t[3], 0, "n", 3, NULL) ||
+		vips_dE00(t[1], t[3], &t[4], NULL) ||
+		vips_max(t[4], out, NULL)
+		) {
+		g_object_unref(base);
+		return 1;
+	}
+
+	g_object_unref(base);
+	return 0;
+}
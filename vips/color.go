@@ -4,6 +4,9 @@ package vips
 // #include "color.h"
 import "C"
 import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
 	"path/filepath"
 	"unsafe"
 )
@@ -46,6 +49,112 @@ const (
 	InterpretationHSV       Interpretation = C.VIPS_INTERPRETATION_HSV
 )
 
+// interpretationNames holds the libvips nicknames of the interpretations
+var interpretationNames = map[Interpretation]string{
+	InterpretationError:     "error",
+	InterpretationMultiband: "multiband",
+	InterpretationBW:        "b-w",
+	InterpretationHistogram: "histogram",
+	InterpretationXYZ:       "xyz",
+	InterpretationLAB:       "lab",
+	InterpretationCMYK:      "cmyk",
+	InterpretationLABQ:      "labq",
+	InterpretationRGB:       "rgb",
+	InterpretationRGB16:     "rgb16",
+	InterpretationCMC:       "cmc",
+	InterpretationLCH:       "lch",
+	InterpretationLABS:      "labs",
+	InterpretationSRGB:      "srgb",
+	InterpretationYXY:       "yxy",
+	InterpretationFourier:   "fourier",
+	InterpretationGrey16:    "grey16",
+	InterpretationMatrix:    "matrix",
+	InterpretationScRGB:     "scrgb",
+	InterpretationHSV:       "hsv",
+}
+
+// String returns the libvips nickname of the interpretation, e.g. "srgb", "b-w" or "lab"
+func (i Interpretation) String() string {
+	if name, ok := interpretationNames[i]; ok {
+		return name
+	}
+	return fmt.Sprintf("Interpretation(%d)", int(i))
+}
+
+// ToneMapOperator represents the operator used to compress high dynamic range values
+type ToneMapOperator int
+
+// ToneMapOperator enum
+const (
+	ToneMapReinhard ToneMapOperator = C.TONE_MAP_REINHARD
+	ToneMapDrago    ToneMapOperator = C.TONE_MAP_DRAGO
+)
+
+// ToneMapParams are options when tone-mapping a high dynamic range image. Exposure scales the linear
+// values before they are compressed; Bias (typically 0.7 to 0.9) only affects the Drago operator,
+// lower values give more contrast.
+type ToneMapParams struct {
+	Operator ToneMapOperator
+	Exposure float64
+	Bias     float64
+}
+
+// NewDefaultToneMapParams creates default values for tone-mapping with the Reinhard operator
+func NewDefaultToneMapParams() *ToneMapParams {
+	return &ToneMapParams{
+		Operator: ToneMapReinhard,
+		Exposure: 1,
+		Bias:     0.85,
+	}
+}
+
+// RenderingIntent represents the ICC rendering intent, which tells color management how to map colors
+// outside the gamut of the destination profile
+type RenderingIntent int
+
+// RenderingIntent enum. RenderingIntentDefault keeps the intent of the profile and converts perceptually.
+const (
+	RenderingIntentDefault RenderingIntent = iota
+	RenderingIntentPerceptual
+	RenderingIntentRelative
+	RenderingIntentSaturation
+	RenderingIntentAbsolute
+)
+
+var renderingIntents = map[RenderingIntent]C.int{
+	RenderingIntentPerceptual: C.VIPS_INTENT_PERCEPTUAL,
+	RenderingIntentRelative:   C.VIPS_INTENT_RELATIVE,
+	RenderingIntentSaturation: C.VIPS_INTENT_SATURATION,
+	RenderingIntentAbsolute:   C.VIPS_INTENT_ABSOLUTE,
+}
+
+func (i RenderingIntent) vipsIntent() C.int {
+	if intent, ok := renderingIntents[i]; ok {
+		return intent
+	}
+	return C.VIPS_INTENT_PERCEPTUAL
+}
+
+// the rendering intent is a big-endian uint32 at this offset of the 128 byte ICC profile header, with the
+// same values as VipsIntent. The profile ID is computed with it zeroed, so setting it keeps the ID valid.
+const (
+	iccHeaderSize            = 128
+	iccRenderingIntentOffset = 64
+)
+
+var iccSignature = []byte("acsp")
+
+// setICCRenderingIntent returns a copy of the ICC profile with the rendering intent set in its header
+func setICCRenderingIntent(profile []byte, intent RenderingIntent) ([]byte, bool) {
+	if len(profile) < iccHeaderSize || !bytes.Equal(profile[36:40], iccSignature) {
+		return nil, false
+	}
+
+	out := append([]byte(nil), profile...)
+	binary.BigEndian.PutUint32(out[iccRenderingIntentOffset:], uint32(intent.vipsIntent()))
+	return out, true
+}
+
 func vipsIsColorSpaceSupported(in *C.VipsImage) bool {
 	return C.is_colorspace_supported(in) == 1
 }
@@ -64,6 +173,59 @@ func vipsToColorSpace(in *C.VipsImage, interpretation Interpretation) (*C.VipsIm
 	return out, nil
 }
 
+// vipsImportColorspace converts the image to the given color space. If the image has an embedded
+// ICC profile, it is first transformed to sRGB with the profile so that wide-gamut and CMYK inputs
+// are converted accurately.
+func vipsImportColorspace(in *C.VipsImage, interpretation Interpretation) (*C.VipsImage, error) {
+	incOpCounter("import_colorspace")
+
+	if vipsHasICCProfile(in) && int(C.vips_icc_present()) != 0 {
+		var srgb *C.VipsImage
+
+		profilePath := C.CString(filepath.Join(temporaryDirectory, sRGBIEC6196621ICCProfilePath))
+		defer freeCString(profilePath)
+
+		if err := C.icc_transform_embedded(in, &srgb, profilePath, C.VIPS_INTENT_PERCEPTUAL); err != 0 {
+			return nil, handleImageError(srgb)
+		}
+		defer clearImage(srgb)
+
+		return vipsToColorSpace(srgb, interpretation)
+	}
+
+	return vipsToColorSpace(in, interpretation)
+}
+
+// vipsTransformToICCProfile converts the image to the profile stored at profilePath with the given intent and embeds it.
+func vipsTransformToICCProfile(in *C.VipsImage, profilePath string, intent RenderingIntent) (*C.VipsImage, error) {
+	incOpCounter("icc_transform")
+	var out *C.VipsImage
+
+	if int(C.vips_icc_present()) == 0 {
+		return nil, fmt.Errorf("libvips was built without ICC support")
+	}
+
+	cPath := C.CString(profilePath)
+	defer freeCString(cPath)
+
+	if err := C.icc_transform_embedded(in, &out, cPath, C.VipsIntent(intent.vipsIntent())); err != 0 {
+		return nil, handleImageError(out)
+	}
+
+	return out, nil
+}
+
+func vipsToneMap(in *C.VipsImage, params *ToneMapParams) (*C.VipsImage, error) {
+	incOpCounter("tone_map")
+	var out *C.VipsImage
+
+	if err := C.tone_map(in, &out, C.int(params.Operator), C.double(params.Exposure), C.double(params.Bias)); err != 0 {
+		return nil, handleImageError(out)
+	}
+
+	return out, nil
+}
+
 func vipsOptimizeICCProfile(in *C.VipsImage, isCmyk int) (*C.VipsImage, error) {
 	var out *C.VipsImage
 
@@ -79,3 +241,14 @@ func vipsOptimizeICCProfile(in *C.VipsImage, isCmyk int) (*C.VipsImage, error) {
 
 	return out, nil
 }
+
+func vipsMaxDeltaE00(left *C.VipsImage, right *C.VipsImage) (float64, error) {
+	incOpCounter("dE00")
+	var out C.double
+
+	if err := C.max_delta_e00(left, right, &out); err != 0 {
+		return 0, handleVipsError()
+	}
+
+	return float64(out), nil
+}
@@ -6,4 +6,14 @@
 int is_colorspace_supported(VipsImage *in);
 int to_colorspace(VipsImage *in, VipsImage **out, VipsInterpretation space);
 
+int icc_transform_embedded(VipsImage *in, VipsImage **out, const char *output_profile, VipsIntent intent);
+
+enum tone_map_operators {
+	TONE_MAP_REINHARD = 0,
+	TONE_MAP_DRAGO
+};
+
+int tone_map(VipsImage *in, VipsImage **out, int operator, double exposure, double bias);
+int max_delta_e00(VipsImage *left, VipsImage *right, double *out);
+
 int optimize_icc_profile(VipsImage *in, VipsImage **out, int isCmyk, char *srgb_profile_path, char *gray_profile_path);
@@ -4,6 +4,10 @@ int copy_image(VipsImage *in, VipsImage **out) {
 	return vips_copy(in, out, NULL);
 }
 
+int copy_image_resolution(VipsImage *in, VipsImage **out, double xres, double yres) {
+	return vips_copy(in, out, "xres", xres, "yres", yres, NULL);
+}
+
 int embed_image(VipsImage *in, VipsImage **out, int left, int top, int width, int height, int extend, double r, double g, double b) {
 	if (extend == VIPS_EXTEND_BACKGROUND) {
 		double background[3] = {r, g, b};
@@ -120,6 +124,10 @@ int cast(VipsImage *in, VipsImage **out, int bandFormat) {
     return vips_cast(in, out, bandFormat, NULL);
 }
 
+int cast_shift(VipsImage *in, VipsImage **out, int bandFormat) {
+    return vips_cast(in, out, bandFormat, "shift", TRUE, NULL);
+}
+
 double max_alpha(VipsImage *in) {
     switch (in->BandFmt) {
     case VIPS_FORMAT_USHORT:
@@ -146,3 +154,21 @@ int composite_image(VipsImage **in, VipsImage **out, int n, int *mode, int *x, i
 int composite2_image(VipsImage *base, VipsImage *overlay, VipsImage **out, int mode, gint x, gint y) {
 	return vips_composite2(base, overlay, out, mode, "x", x, "y", y, NULL);
 }
+
+// joins equally sized frames vertically into an animation strip, delay is in milliseconds per frame
+int join_frames(VipsImage **in, VipsImage **out, int n, int *delay, int n_delay) {
+	if (vips_arrayjoin(in, out, n, "across", 1, NULL)) {
+		return 1;
+	}
+
+	vips_image_set_int(*out, VIPS_META_PAGE_HEIGHT, in[0]->Ysize);
+	vips_image_set_int(*out, VIPS_META_N_PAGES, n);
+
+	if (n_delay > 0) {
+		vips_image_set_array_int(*out, "delay", delay, n_delay);
+		// libvips before 8.9 reads the delay of all frames from "gif-delay" in centiseconds
+		vips_image_set_int(*out, "gif-delay", delay[0] / 10);
+	}
+
+	return 0;
+}
@@ -131,6 +131,17 @@ func vipsCopyImage(in *C.VipsImage) (*C.VipsImage, error) {
 	return out, nil
 }
 
+// https://libvips.github.io/libvips/API/current/libvips-conversion.html#vips-copy
+func vipsCopyImageResolution(in *C.VipsImage, xres, yres float64) (*C.VipsImage, error) {
+	var out *C.VipsImage
+
+	if err := C.copy_image_resolution(in, &out, C.double(xres), C.double(yres)); int(err) != 0 {
+		return nil, handleImageError(out)
+	}
+
+	return out, nil
+}
+
 // https://libvips.github.io/libvips/API/current/libvips-conversion.html#vips-embed
 func vipsEmbed(in *C.VipsImage, left, top, width, height int, extend ExtendStrategy) (*C.VipsImage, error) {
 	incOpCounter("embed")
@@ -314,6 +325,17 @@ func vipsUnpremultiplyAlpha(in *C.VipsImage) (*C.VipsImage, error) {
 	return out, nil
 }
 
+// vipsUnpremultiplyAlphaToFormat converts premultiplied to straight alpha, keeping the band format
+func vipsUnpremultiplyAlphaToFormat(in *C.VipsImage) (*C.VipsImage, error) {
+	unpremultiplied, err := vipsUnpremultiplyAlpha(in)
+	if err != nil {
+		return nil, err
+	}
+	defer clearImage(unpremultiplied)
+
+	return vipsCast(unpremultiplied, BandFormat(in.BandFmt))
+}
+
 func vipsCast(in *C.VipsImage, bandFormat BandFormat) (*C.VipsImage, error) {
 	incOpCounter("cast")
 	var out *C.VipsImage
@@ -325,6 +347,18 @@ func vipsCast(in *C.VipsImage, bandFormat BandFormat) (*C.VipsImage, error) {
 	return out, nil
 }
 
+// vipsCastShift casts between integer formats by shifting the values, e.g. 16-bit 65535 becomes 8-bit 255
+func vipsCastShift(in *C.VipsImage, bandFormat BandFormat) (*C.VipsImage, error) {
+	incOpCounter("cast_shift")
+	var out *C.VipsImage
+
+	if err := C.cast_shift(in, &out, C.int(bandFormat)); err != 0 {
+		return nil, handleImageError(out)
+	}
+
+	return out, nil
+}
+
 // https://libvips.github.io/libvips/API/current/libvips-conversion.html#vips-composite
 func vipsComposite(ins []*C.VipsImage, modes []C.int, xs, ys []C.int) (*C.VipsImage, error) {
 	incOpCounter("composite_multi")
@@ -348,3 +382,20 @@ func vipsComposite2(base *C.VipsImage, overlay *C.VipsImage, mode BlendMode, x,
 
 	return out, nil
 }
+
+// https://libvips.github.io/libvips/API/current/libvips-conversion.html#vips-arrayjoin
+func vipsJoinFrames(ins []*C.VipsImage, delays []int) (*C.VipsImage, error) {
+	incOpCounter("join_frames")
+	var out *C.VipsImage
+
+	cDelays := make([]C.int, len(delays)+1)
+	for i, delay := range delays {
+		cDelays[i] = C.int(delay)
+	}
+
+	if err := C.join_frames(&ins[0], &out, C.int(len(ins)), &cDelays[0], C.int(len(delays))); err != 0 {
+		return nil, handleImageError(out)
+	}
+
+	return out, nil
+}
@@ -4,6 +4,7 @@
 #include <vips/vips.h>
 
 int copy_image(VipsImage *in, VipsImage **out);
+int copy_image_resolution(VipsImage *in, VipsImage **out, double xres, double yres);
 
 int embed_image(VipsImage *in, VipsImage **out, int left, int top, int width, int height, int extend, double r, double g, double b);
 
@@ -28,9 +29,12 @@ int add_alpha(VipsImage *in, VipsImage **out);
 int premultiply_alpha(VipsImage *in, VipsImage **out);
 int unpremultiply_alpha(VipsImage *in, VipsImage **out);
 int cast(VipsImage *in, VipsImage **out, int bandFormat);
+int cast_shift(VipsImage *in, VipsImage **out, int bandFormat);
 double max_alpha(VipsImage *in);
 
 int composite_image(VipsImage **in, VipsImage **out, int n, int *mode, int *x, int *y);
 int composite2_image(VipsImage *base, VipsImage *overlay, VipsImage **out, int mode, gint x, gint y);
 
 int is_16bit(VipsInterpretation interpretation);
+
+int join_frames(VipsImage **in, VipsImage **out, int n, int *delay, int n_delay);
@@ -0,0 +1,53 @@
+package vips
+
+import (
+	"image"
+	"io"
+	"sync"
+)
+
+// Encoder encodes an image with Go for an image type libvips cannot save, e.g. with image/gif
+type Encoder func(w io.Writer, img image.Image, params *ExportParams) error
+
+var (
+	encoders     = make(map[ImageType]Encoder)
+	encodersLock sync.RWMutex
+)
+
+// RegisterEncoder registers a Go encoder which Export falls back to when libvips has no saver for the image type
+// on this host, e.g. GIF output with image/gif on a minimal libvips build. The encoder is passed the image as
+// 8-bit sRGB with alpha after the format independent export params are applied. Registering nil removes the
+// encoder. Types which libvips can save always use libvips.
+func RegisterEncoder(imageType ImageType, encoder Encoder) {
+	encodersLock.Lock()
+	defer encodersLock.Unlock()
+
+	if encoder == nil {
+		delete(encoders, imageType)
+		return
+	}
+	encoders[imageType] = encoder
+}
+
+// fallbackEncoder returns the registered encoder for the image type if libvips cannot save it on this host
+func fallbackEncoder(imageType ImageType) (Encoder, bool) {
+	if imageType == ImageTypeUnknown || hasSaver(imageType) {
+		return nil, false
+	}
+
+	encodersLock.RLock()
+	defer encodersLock.RUnlock()
+
+	encoder, ok := encoders[imageType]
+	return encoder, ok
+}
+
+// hasSaver reports whether libvips can save the image type on this host
+func hasSaver(imageType ImageType) bool {
+	for _, s := range imageTypeSavers {
+		if s.imageType == imageType {
+			return IsTypeSupported(imageType) && hasOperation(s.saver)
+		}
+	}
+	return false
+}
@@ -8,14 +8,116 @@ import (
 	"errors"
 	"fmt"
 	dbg "runtime/debug"
+	"strings"
 	"unsafe"
 )
 
 var (
 	// ErrUnsupportedImageFormat when image type is unsupported
 	ErrUnsupportedImageFormat = errors.New("unsupported image format")
+
+	// ErrWebPDimensionExceeded when the image is too large to be encoded as WebP
+	ErrWebPDimensionExceeded = errors.New("image dimensions exceed the WebP limit of 16383x16383")
+
+	// ErrMaxRasterPixelsExceeded when an SVG or PDF would be rasterized, or a QOI decoded, to more pixels than allowed
+	ErrMaxRasterPixelsExceeded = errors.New("rasterized image exceeds the maximum number of pixels")
+
+	// ErrMaxFramesExceeded when an animated or multi-page image has more frames than allowed
+	ErrMaxFramesExceeded = errors.New("image has more frames than allowed")
+
+	// ErrWebPExactUnsupported when exact WebP output is requested but libvips is older than 8.15
+	ErrWebPExactUnsupported = errors.New("exact WebP output requires libvips 8.15 or later")
+
+	// ErrHEIFEncoderUnsupported when a HEIF encoder is selected but libvips is older than 8.13
+	ErrHEIFEncoderUnsupported = errors.New("selecting the HEIF encoder requires libvips 8.13 or later")
+
+	// ErrHEIFSubsampleModeUnsupported when HEIF chroma subsampling is set but libvips is older than 8.13
+	ErrHEIFSubsampleModeUnsupported = errors.New("setting the HEIF chroma subsampling requires libvips 8.13 or later")
+
+	// ErrTooManyBands when an image has more bands than the output format can store
+	ErrTooManyBands = errors.New("image has too many bands for the output format")
+
+	// ErrUnknownICCProfile when an ICC profile name is neither built-in nor registered
+	ErrUnknownICCProfile = errors.New("unknown ICC profile")
+
+	// ErrDataURITooLarge when an exported image exceeds the size limit for inlining it as data URI
+	ErrDataURITooLarge = errors.New("image is too large for a data URI")
+
+	// ErrTruncated when libvips fails because the image data ends prematurely
+	ErrTruncated = errors.New("image data is truncated")
+
+	// ErrTooLarge when libvips fails because the image is too large to be processed or encoded
+	ErrTooLarge = errors.New("image is too large")
+
+	// ErrUnsupportedColorspace when libvips cannot convert from or to the color space of the image
+	ErrUnsupportedColorspace = errors.New("unsupported color space")
+
+	// ErrEncodeFailed when libvips fails to encode an image for a reason not covered by another error
+	ErrEncodeFailed = errors.New("failed to encode image")
+
+	// ErrPassthrough when a recognized image cannot be processed on this host and passthrough was requested
+	ErrPassthrough = errors.New("image format cannot be processed, passing through original")
 )
 
+// PassthroughError carries the original buffer and detected type of an image which
+// cannot be processed by libvips on this host. It is only returned when loading with
+// PassthroughImportOption and matches ErrPassthrough with errors.Is.
+type PassthroughError struct {
+	Buf       []byte
+	ImageType ImageType
+}
+
+func (e *PassthroughError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrPassthrough, ImageTypes[e.ImageType])
+}
+
+// Unwrap returns ErrPassthrough
+func (e *PassthroughError) Unwrap() error {
+	return ErrPassthrough
+}
+
+// vipsError is an error reported by libvips. It matches the error class derived from the libvips message,
+// if any, with errors.Is.
+type vipsError struct {
+	message string
+	stack   []byte
+	class   error
+}
+
+func (e *vipsError) Error() string {
+	return fmt.Sprintf("%v\nStack:\n%s", e.message, e.stack)
+}
+
+// Unwrap returns the error class, e.g. ErrTruncated, or nil if the message could not be classified
+func (e *vipsError) Unwrap() error {
+	return e.class
+}
+
+// vipsErrorClasses holds lowercase messages of libvips and the loader libraries for each error class, in the
+// order they are matched. They are kept to whole phrases, so unrelated messages are not misclassified.
+var vipsErrorClasses = []struct {
+	class     error
+	fragments []string
+}{
+	{ErrTruncated, []string{"premature end of", "truncated", "unexpected end of file", "unexpected end of data"}},
+	{ErrTooLarge, []string{"image too large", "too large for", "too big", "out of memory"}},
+	{ErrUnsupportedColorspace, []string{"no known route from", "unsupported colourspace", "unsupported colorspace"}},
+	{ErrUnsupportedImageFormat, []string{"is not a known file format", "is not in a known format", "unsupported image format"}},
+}
+
+// classifyVipsError returns the error class for a libvips error message, or nil
+func classifyVipsError(message string) error {
+	lower := strings.ToLower(message)
+	for _, c := range vipsErrorClasses {
+		for _, fragment := range c.fragments {
+			if strings.Contains(lower, fragment) {
+				return c.class
+			}
+		}
+	}
+	return nil
+}
+
 func handleImageError(out *C.VipsImage) error {
 	if out != nil {
 		clearImage(out)
@@ -24,17 +126,28 @@ func handleImageError(out *C.VipsImage) error {
 	return handleVipsError()
 }
 
+// handleSaveBufferError frees the output of a failed save to buffer and returns the error of handleSaveError
 func handleSaveBufferError(out unsafe.Pointer) error {
 	if out != nil {
 		gFreePointer(out)
 	}
 
-	return handleVipsError()
+	return handleSaveError()
+}
+
+// handleSaveError returns the libvips error of a failed save, which matches ErrEncodeFailed if it does not
+// match a more specific error class
+func handleSaveError() error {
+	err := handleVipsError()
+	if verr, ok := err.(*vipsError); ok && verr.class == nil {
+		verr.class = ErrEncodeFailed
+	}
+	return err
 }
 
 func handleVipsError() error {
 	s := C.GoString(C.vips_error_buffer())
 	C.vips_error_clear()
 
-	return fmt.Errorf("%v\nStack:\n%s", s, dbg.Stack())
+	return &vipsError{message: s, stack: dbg.Stack(), class: classifyVipsError(s)}
 }
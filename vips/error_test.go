@@ -0,0 +1,34 @@
+package vips
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_classifyVipsError(t *testing.T) {
+	assert.Equal(t, ErrTruncated, classifyVipsError("VipsJpeg: Premature end of JPEG file"))
+	assert.Equal(t, ErrTruncated, classifyVipsError("gifload: truncated GIF file"))
+	assert.Equal(t, ErrTooLarge, classifyVipsError("vips_image_new_memory: image too large"))
+	assert.Equal(t, ErrUnsupportedColorspace, classifyVipsError("vips_colourspace: no known route from 'fourier' to 'srgb'"))
+	assert.Equal(t, ErrUnsupportedImageFormat, classifyVipsError("VipsForeignLoad: buffer is not in a known format"))
+	assert.Equal(t, ErrTruncated, classifyVipsError("spng: unexpected end of file"))
+	assert.Equal(t, ErrTooLarge, classifyVipsError("vips_tracked_malloc: out of memory --- size == 4096MB"))
+	assert.Equal(t, ErrUnsupportedImageFormat, classifyVipsError("VipsForeignLoad: \"a.xyz\" is not a known file format"))
+	assert.Nil(t, classifyVipsError("something else went wrong"))
+	assert.Nil(t, classifyVipsError("extract_area: bad extract area, region exceeds image"))
+	assert.Nil(t, classifyVipsError("vips_image_decode: bad interpretation"))
+	assert.Nil(t, classifyVipsError("vips_colourspace: image must be uncoded"))
+	assert.Nil(t, classifyVipsError("vips__file_read: end of file"))
+}
+
+func Test_vipsError(t *testing.T) {
+	err := error(&vipsError{message: "VipsJpeg: Premature end of JPEG file", class: ErrTruncated})
+	assert.True(t, errors.Is(err, ErrTruncated))
+	assert.False(t, errors.Is(err, ErrTooLarge))
+	assert.Contains(t, err.Error(), "Premature end of JPEG file")
+
+	err = &vipsError{message: "unknown"}
+	assert.False(t, errors.Is(err, ErrTruncated))
+}
@@ -0,0 +1,169 @@
+package vips
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// TIFF tags which point to sub-IFDs of the EXIF data
+const (
+	exifTagExifIFD    = 0x8769
+	exifTagGPSIFD     = 0x8825
+	exifTagInteropIFD = 0xA005
+)
+
+// TIFF tags of IFD1 which locate the JPEG thumbnail
+const (
+	exifTagJPEGInterchangeFormat       = 0x0201
+	exifTagJPEGInterchangeFormatLength = 0x0202
+)
+
+// exifHeader is the prefix libvips and JPEG APP1 segments use for the EXIF data
+var exifHeader = []byte("Exif\x00\x00")
+
+// exifTypeSizes are the sizes in bytes of the TIFF field types
+var exifTypeSizes = map[uint16]int{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8,
+}
+
+// exifReader walks the IFDs of TIFF structured EXIF data
+type exifReader struct {
+	tiff    []byte
+	order   binary.ByteOrder
+	visited map[int]bool
+}
+
+func newEXIFReader(tiff []byte) (*exifReader, bool) {
+	if len(tiff) < 8 {
+		return nil, false
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, false
+	}
+
+	if order.Uint16(tiff[2:4]) != 42 {
+		return nil, false
+	}
+
+	return &exifReader{tiff: tiff, order: order, visited: make(map[int]bool)}, true
+}
+
+// nextIFDPosition returns the position of the pointer to the next IFD after the IFD at offset
+func (e *exifReader) nextIFDPosition(offset int) (int, bool) {
+	if offset < 8 || offset+2 > len(e.tiff) {
+		return 0, false
+	}
+
+	n := int(e.order.Uint16(e.tiff[offset:]))
+	pos := offset + 2 + 12*n
+	if pos+4 > len(e.tiff) {
+		return 0, false
+	}
+
+	return pos, true
+}
+
+// end returns the end of the IFD at offset, its out-of-line values and its sub-IFDs
+func (e *exifReader) end(offset int) int {
+	if e.visited[offset] {
+		return 0
+	}
+	e.visited[offset] = true
+
+	next, ok := e.nextIFDPosition(offset)
+	if !ok {
+		return 0
+	}
+
+	end := next + 4
+	for pos := offset + 2; pos < next; pos += 12 {
+		tag := e.order.Uint16(e.tiff[pos:])
+		value := int(e.order.Uint32(e.tiff[pos+8:]))
+
+		if tag == exifTagExifIFD || tag == exifTagGPSIFD || tag == exifTagInteropIFD {
+			if subEnd := e.end(value); subEnd > end {
+				end = subEnd
+			}
+			continue
+		}
+
+		size := exifTypeSizes[e.order.Uint16(e.tiff[pos+2:])] * int(e.order.Uint32(e.tiff[pos+4:]))
+		if size > 4 && value+size > end {
+			end = value + size
+		}
+	}
+
+	return end
+}
+
+// jpegThumbnail returns the position and length of the JPEG thumbnail referenced by the IFD at offset, or a
+// zero length if it has none or it lies outside of the data
+func (e *exifReader) jpegThumbnail(offset int) (int, int) {
+	next, ok := e.nextIFDPosition(offset)
+	if !ok {
+		return 0, 0
+	}
+
+	position, length := 0, 0
+	for pos := offset + 2; pos < next; pos += 12 {
+		switch e.order.Uint16(e.tiff[pos:]) {
+		case exifTagJPEGInterchangeFormat:
+			position = int(e.order.Uint32(e.tiff[pos+8:]))
+		case exifTagJPEGInterchangeFormatLength:
+			length = int(e.order.Uint32(e.tiff[pos+8:]))
+		}
+	}
+
+	if position < 8 || length <= 0 || position+length > len(e.tiff) {
+		return 0, 0
+	}
+	return position, length
+}
+
+// removeEXIFThumbnail unlinks IFD1, which holds the embedded thumbnail, from the EXIF data. If IFD1 and
+// the thumbnail are stored after all other data, as cameras usually do, they are truncated as well,
+// otherwise the JPEG thumbnail is overwritten with zeros. It returns false if the data has no IFD1 or
+// cannot be parsed.
+func removeEXIFThumbnail(exif []byte) ([]byte, bool) {
+	var prefix []byte
+	if bytes.HasPrefix(exif, exifHeader) {
+		prefix = exifHeader
+	}
+
+	tiff := append([]byte(nil), exif[len(prefix):]...)
+	e, ok := newEXIFReader(tiff)
+	if !ok {
+		return nil, false
+	}
+
+	ifd0 := int(e.order.Uint32(tiff[4:]))
+	next, ok := e.nextIFDPosition(ifd0)
+	if !ok {
+		return nil, false
+	}
+
+	ifd1 := int(e.order.Uint32(tiff[next:]))
+	if ifd1 == 0 {
+		return nil, false
+	}
+
+	thumbnail, thumbnailLength := e.jpegThumbnail(ifd1)
+	e.order.PutUint32(tiff[next:], 0)
+
+	if end := e.end(ifd0); end <= ifd1 && end <= len(tiff) {
+		tiff = tiff[:end]
+	} else if thumbnailLength > 0 {
+		for i := thumbnail; i < thumbnail+thumbnailLength; i++ {
+			tiff[i] = 0
+		}
+	}
+
+	return append(append([]byte(nil), prefix...), tiff...), true
+}
@@ -0,0 +1,71 @@
+package vips
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readTestEXIF(t *testing.T, buf []byte) []byte {
+	segments, err := readJPEGSegments(buf)
+	require.NoError(t, err)
+
+	for _, segment := range segments {
+		if segment.marker == 0xE1 && bytes.HasPrefix(segment.data, exifHeader) {
+			return segment.data
+		}
+	}
+	return nil
+}
+
+func hasEXIFThumbnail(exif []byte) bool {
+	e, ok := newEXIFReader(exif[len(exifHeader):])
+	if !ok {
+		return false
+	}
+
+	next, ok := e.nextIFDPosition(int(e.order.Uint32(e.tiff[4:])))
+	return ok && e.order.Uint32(e.tiff[next:]) != 0
+}
+
+func Test_removeEXIFThumbnail(t *testing.T) {
+	buf, err := ioutil.ReadFile(resources + "orientation-issue-1.jpg")
+	require.NoError(t, err)
+
+	exif := readTestEXIF(t, buf)
+	require.NotNil(t, exif)
+	require.True(t, hasEXIFThumbnail(exif))
+
+	stripped, ok := removeEXIFThumbnail(exif)
+	require.True(t, ok)
+	assert.False(t, hasEXIFThumbnail(stripped))
+	assert.Less(t, len(stripped), len(exif)-50000)
+	assert.True(t, bytes.HasPrefix(stripped, exifHeader))
+
+	_, ok = removeEXIFThumbnail(stripped)
+	assert.False(t, ok)
+}
+
+func TestImageRef_StripEXIFThumbnail(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "orientation-issue-1.jpg")
+	require.NoError(t, err)
+
+	params := NewDefaultJPEGExportParams()
+	params.StripEXIFThumbnail = true
+
+	buf, _, err := img.Export(params)
+	require.NoError(t, err)
+
+	exif := readTestEXIF(t, buf)
+	require.NotNil(t, exif)
+	assert.False(t, hasEXIFThumbnail(exif))
+
+	stripped, err := NewImageFromBuffer(buf)
+	require.NoError(t, err)
+	assert.Equal(t, img.GetOrientation(), stripped.GetOrientation())
+}
@@ -1,5 +1,6 @@
 #include "lang.h"
 #include "foreign.h"
+#include "header.h"
 
 int load_jpeg_buffer(void *buf, size_t len, VipsImage **out, int shrink, int fail, int autorotate) {
 	return vips_jpegload_buffer(buf, len, out,
@@ -9,14 +10,42 @@ int load_jpeg_buffer(void *buf, size_t len, VipsImage **out, int shrink, int fai
 		NULL);
 }
 
-int load_png_buffer(void *buf, size_t len, VipsImage **out) {
-	return vips_pngload_buffer(buf, len, out, NULL);
+// the png and webp loaders have no autorotate parameter, so the EXIF orientation is applied after loading.
+// Multi-page images are left as is, as rotating the whole strip would mix up the pages.
+static int autorotate_loaded(VipsImage **out) {
+	VipsImage *rotated;
+
+	if (vips_image_get_page_height(*out) != (*out)->Ysize) {
+		return 0;
+	}
+
+	if (vips_autorot(*out, &rotated, NULL)) {
+		return -1;
+	}
+
+	g_object_unref(*out);
+	*out = rotated;
+	return 0;
 }
 
-int load_webp_buffer(void *buf, size_t len, VipsImage **out, int shrink) {
-	return vips_webpload_buffer(buf, len, out,
+int load_png_buffer(void *buf, size_t len, VipsImage **out, int autorotate) {
+	if (vips_pngload_buffer(buf, len, out, NULL)) {
+		return -1;
+	}
+
+	return autorotate ? autorotate_loaded(out) : 0;
+}
+
+int load_webp_buffer(void *buf, size_t len, VipsImage **out, int shrink, int page, int n, int autorotate) {
+	if (vips_webpload_buffer(buf, len, out,
 		"shrink", shrink,
-		NULL);
+		"page", page,
+		"n", n,
+		NULL)) {
+		return -1;
+	}
+
+	return autorotate ? autorotate_loaded(out) : 0;
 }
 
 int load_tiff_buffer(void *buf, size_t len, VipsImage **out, int page, int n, int autorotate, int subifd) {
@@ -29,7 +58,7 @@ int load_tiff_buffer(void *buf, size_t len, VipsImage **out, int page, int n, in
 }
 
 int load_gif_buffer(void *buf, size_t len, VipsImage **out, int page, int n) {
-	return vips_tiffload_buffer(buf, len, out,
+	return vips_gifload_buffer(buf, len, out,
 		"page", page,
 		"n", n,
 		NULL);
@@ -52,11 +81,14 @@ int load_svg_buffer(void *buf, size_t len, VipsImage **out, double dpi, double s
 		NULL);
 }
 
-int load_heif_buffer(void *buf, size_t len, VipsImage **out, int page, int n, int thumbnail) {
+// autorotate applies the container level irot/imir transforms and resets the orientation to 1,
+// otherwise the pixels are left unrotated and the orientation reflects the transforms
+int load_heif_buffer(void *buf, size_t len, VipsImage **out, int page, int n, int thumbnail, int autorotate) {
 	return vips_heifload_buffer(buf, len, out,
 		"page", page,
 		"n", n,
 		"thumbnail", INT_TO_GBOOLEAN(thumbnail),
+		"autorotate", INT_TO_GBOOLEAN(autorotate),
 		NULL);
 }
 
@@ -68,9 +100,95 @@ int load_magick_buffer(void *buf, size_t len, VipsImage **out, int page, int n,
 		NULL);
 }
 
+// Radiance images are loaded in their packed RGBE coding, unpack them to float
+int load_hdr_buffer(void *buf, size_t len, VipsImage **out) {
+	VipsImage *rad;
+
+	if (vips_radload_buffer(buf, len, &rad, NULL)) {
+		return -1;
+	}
+
+	int ret = vips_rad2float(rad, out, NULL);
+	g_object_unref(rad);
+
+	return ret;
+}
+
+// there is no buffer loader for OpenEXR, the pixels are copied to memory so the file can be removed after loading
+int load_exr_file(const char *filename, VipsImage **out) {
+	VipsImage *exr;
+
+	if (vips_openexrload(filename, &exr, NULL)) {
+		return -1;
+	}
+
+	*out = vips_image_copy_memory(exr);
+	g_object_unref(exr);
+
+	return *out == NULL ? -1 : 0;
+}
+
+// libvips before 8.12 only loads PNM images from files, the image is read into memory so the file can be removed
+int load_ppm_file(const char *filename, VipsImage **out) {
+	VipsImage *ppm;
+
+	if (vips_ppmload(filename, &ppm, NULL)) {
+		return -1;
+	}
+
+	*out = vips_image_copy_memory(ppm);
+	g_object_unref(ppm);
+
+	return *out == NULL ? -1 : 0;
+}
+
+// runs the buffer loader operation with the given name, e.g. "magickload_buffer", with its default options
+int load_buffer_with_loader(const char *loader, void *buf, size_t len, VipsImage **out) {
+	VipsOperation *operation = vips_operation_new(loader);
+	if (operation == NULL) {
+		return -1;
+	}
+
+	if (!vips_isprefix("VipsForeignLoad", G_OBJECT_TYPE_NAME(operation)) ||
+		vips_object_get_argument_flags(VIPS_OBJECT(operation), "buffer") == 0) {
+		vips_error("govips", "%s is not a buffer loader", loader);
+		g_object_unref(operation);
+		return -1;
+	}
+
+	VipsBlob *blob = vips_blob_new(NULL, buf, len);
+	g_object_set(operation, "buffer", blob, NULL);
+	vips_area_unref(VIPS_AREA(blob));
+
+	if (vips_cache_operation_buildp(&operation)) {
+		vips_object_unref_outputs(VIPS_OBJECT(operation));
+		g_object_unref(operation);
+		return -1;
+	}
+
+	g_object_get(operation, "out", out, NULL);
+
+	vips_object_unref_outputs(VIPS_OBJECT(operation));
+	g_object_unref(operation);
+	return 0;
+}
+
 // https://libvips.github.io/libvips/API/current/VipsForeignSave.html#vips-jpegsave-buffer
-int save_jpeg_buffer(VipsImage *in, void **buf, size_t *len, int strip, int quality, int interlace) {
-    return vips_jpegsave_buffer(in, buf, len,
+// density > 0 overrides the JFIF density, which is otherwise written from the image resolution
+int save_jpeg_buffer(VipsImage *in, void **buf, size_t *len, int strip, int quality, int interlace, double density, int unit) {
+	VipsImage *image = in;
+
+	if (density > 0) {
+		// libvips stores the resolution in pixels per millimetre
+		double res = unit == DENSITY_UNIT_CENTIMETER ? density / 10.0 : density / 25.4;
+
+		if (vips_copy(in, &image, "xres", res, "yres", res, NULL)) {
+			return -1;
+		}
+		vips_image_set_string(image, "resolution-unit", unit == DENSITY_UNIT_CENTIMETER ? "cm" : "in");
+	}
+
+	int ret = vips_jpegsave_buffer(image, buf, len,
 		"strip", INT_TO_GBOOLEAN(strip),
 		"Q", quality,
 		"optimize_coding", TRUE,
@@ -78,6 +196,12 @@ int save_jpeg_buffer(VipsImage *in, void **buf, size_t *len, int strip, int qual
 		"subsample_mode", VIPS_FOREIGN_JPEG_SUBSAMPLE_ON,
 		NULL
 	);
+
+	if (image != in) {
+		g_object_unref(image);
+	}
+
+	return ret;
 }
 
 // https://libvips.github.io/libvips/API/current/VipsForeignSave.html#vips-pngsave-buffer
@@ -94,41 +218,175 @@ int save_png_buffer(VipsImage *in, void **buf, size_t *len, int strip, int compr
 // todo: support additional params
 // https://github.com/libvips/libvips/blob/master/libvips/foreign/webpsave.c#L524
 // https://libvips.github.io/libvips/API/current/VipsForeignSave.html#vips-webpsave-buffer
-int save_webp_buffer(VipsImage *in, void **buf, size_t *len, int strip, int quality, int lossless, int effort) {
+// exact is only passed when set, as the option is not available before libvips 8.15.
+// near_lossless implies lossless and uses quality as the amount of preprocessing.
+int save_webp_buffer(VipsImage *in, void **buf, size_t *len, int strip, int quality, int lossless, int effort, int preset, int near_lossless, int exact) {
+	if (exact) {
+		return vips_webpsave_buffer(in, buf, len,
+			"strip", INT_TO_GBOOLEAN(strip),
+			"Q", quality,
+			"lossless", INT_TO_GBOOLEAN(lossless),
+			"reduction_effort", effort,
+			"preset", preset,
+			"near_lossless", INT_TO_GBOOLEAN(near_lossless),
+			"exact", TRUE,
+			NULL
+		);
+	}
+
 	return vips_webpsave_buffer(in, buf, len,
 		"strip", INT_TO_GBOOLEAN(strip),
 		"Q", quality,
 		"lossless", INT_TO_GBOOLEAN(lossless),
 		"reduction_effort", effort,
+		"preset", preset,
+		"near_lossless", INT_TO_GBOOLEAN(near_lossless),
 		NULL
 	);
 }
 
 // todo: support additional params
 // https://github.com/libvips/libvips/blob/master/libvips/foreign/heifsave.c#L653
-int save_heif_buffer(VipsImage *in, void **buf, size_t *len, int quality, int lossless) {
-	return vips_heifsave_buffer(in, buf, len,
+int save_heif_buffer(VipsImage *in, void **buf, size_t *len, int quality, int lossless, int encoder, int subsample) {
+	VipsOperation *operation = vips_operation_new("heifsave_buffer");
+	if (operation == NULL) {
+		return 1;
+	}
+
+	g_object_set(operation,
+		"in", in,
 		"Q", quality,
 		"lossless", INT_TO_GBOOLEAN(lossless),
 		NULL
 	);
+
+	// encoder and subsample_mode are only set when used, as the options are not available before libvips 8.13.
+	// AOM, rav1e and SVT-AV1 only encode AV1, so their output is AVIF
+	if (encoder != HEIF_ENCODER_AUTO) {
+		g_object_set(operation,
+			"encoder", encoder,
+			"compression", encoder == HEIF_ENCODER_X265 ? VIPS_FOREIGN_HEIF_COMPRESSION_HEVC : VIPS_FOREIGN_HEIF_COMPRESSION_AV1,
+			NULL
+		);
+	}
+	if (subsample != VIPS_FOREIGN_JPEG_SUBSAMPLE_AUTO) {
+		g_object_set(operation, "subsample_mode", subsample, NULL);
+	}
+
+	if (vips_cache_operation_buildp(&operation)) {
+		vips_object_unref_outputs(VIPS_OBJECT(operation));
+		g_object_unref(operation);
+		return 1;
+	}
+
+	// copy the output, as the buffer is freed with g_free by the caller
+	VipsBlob *blob;
+	g_object_get(operation, "buffer", &blob, NULL);
+	*len = VIPS_AREA(blob)->length;
+	*buf = g_malloc(*len);
+	memcpy(*buf, VIPS_AREA(blob)->data, *len);
+	vips_area_unref(VIPS_AREA(blob));
+
+	vips_object_unref_outputs(VIPS_OBJECT(operation));
+	g_object_unref(operation);
+	return 0;
 }
 
 // https://libvips.github.io/libvips/API/current/VipsForeignSave.html#vips-tiffsave-buffer
-int save_tiff_buffer(VipsImage *in, void **buf, size_t *len, int strip, int quality, int lossless) {
+// compression < 0 selects no compression for lossless and LZW otherwise
+int save_tiff_buffer(VipsImage *in, void **buf, size_t *len, int strip, int quality, int lossless, int compression, int bitdepth) {
+  if (compression < 0) {
+    compression = lossless ? VIPS_FOREIGN_TIFF_COMPRESSION_NONE : VIPS_FOREIGN_TIFF_COMPRESSION_LZW;
+  }
+
   // TODO: Allow various options to be passed in.
 	return vips_tiffsave_buffer(in, buf, len,
     "strip", INT_TO_GBOOLEAN(strip),
     "Q", quality,
-    "compression", lossless ? VIPS_FOREIGN_TIFF_COMPRESSION_NONE : VIPS_FOREIGN_TIFF_COMPRESSION_LZW,
+    "compression", compression,
+    "bitdepth", bitdepth,
     "pyramid", FALSE,
     "predictor", VIPS_FOREIGN_TIFF_PREDICTOR_HORIZONTAL,
     "pyramid", FALSE,
     "tile", FALSE,
     "tile_height", 256,
     "tile_width", 256,
-    "xres", 1.0,
-    "yres", 1.0,
     NULL
   );
 }
+
+// https://libvips.github.io/libvips/API/current/VipsForeignSave.html#vips-tiffsave
+// the options match save_tiff_buffer
+int save_tiff_file(VipsImage *in, const char *filename, int strip, int quality, int lossless, int compression, int bitdepth) {
+	if (compression < 0) {
+		compression = lossless ? VIPS_FOREIGN_TIFF_COMPRESSION_NONE : VIPS_FOREIGN_TIFF_COMPRESSION_LZW;
+	}
+
+	return vips_tiffsave(in, filename,
+		"strip", INT_TO_GBOOLEAN(strip),
+		"Q", quality,
+		"compression", compression,
+		"bitdepth", bitdepth,
+		"predictor", VIPS_FOREIGN_TIFF_PREDICTOR_HORIZONTAL,
+		"pyramid", FALSE,
+		"tile", FALSE,
+		"tile_height", 256,
+		"tile_width", 256,
+		NULL
+	);
+}
+
+// https://libvips.github.io/libvips/API/current/VipsForeignSave.html#vips-ppmsave
+// PNM has no alpha channel, so like JPEG transparent areas are flattened against black
+int save_ppm_file(VipsImage *in, const char *filename, int strip) {
+	VipsImage *image = in;
+
+	if (vips_image_hasalpha(in) && vips_flatten(in, &image, NULL)) {
+		return -1;
+	}
+
+	int ret = vips_ppmsave(image, filename, "strip", INT_TO_GBOOLEAN(strip), NULL);
+
+	if (image != in) {
+		g_object_unref(image);
+	}
+
+	return ret;
+}
+
+// https://libvips.github.io/libvips/API/current/VipsForeignSave.html#vips-magicksave-buffer
+int save_magick_buffer(VipsImage *in, void **buf, size_t *len, const char *format, int quality) {
+	return vips_magicksave_buffer(in, buf, len,
+		"format", format,
+		"quality", quality,
+		NULL
+	);
+}
+
+// loads all GIF frames with sequential access so that libvips streams them into the WebP encoder
+// instead of decoding the whole animation strip into memory first
+int transcode_gif_to_webp(void *buf, size_t len, void **out, size_t *out_len, int strip, int quality, int lossless, int effort, int loop) {
+	VipsImage *in, *copy;
+
+	if (vips_gifload_buffer(buf, len, &in,
+		"n", -1,
+		"access", VIPS_ACCESS_SEQUENTIAL,
+		NULL)) {
+		return -1;
+	}
+
+	// copy before changing metadata, the loaded image may be shared via the operation cache
+	int code = vips_copy(in, &copy, NULL);
+	g_object_unref(in);
+	if (code) {
+		return code;
+	}
+
+	if (loop >= 0) {
+		set_meta_loop(copy, loop);
+	}
+	code = save_webp_buffer(copy, out, out_len, strip, quality, lossless, effort, VIPS_FOREIGN_WEBP_PRESET_DEFAULT, 0, 0);
+
+	g_object_unref(copy);
+	return code;
+}
@@ -5,15 +5,21 @@ package vips
 import "C"
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/xml"
 	"fmt"
 	"image/png"
+	"io/ioutil"
 	"math"
+	"os"
+	"regexp"
 	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"unsafe"
 
 	"golang.org/x/image/bmp"
-	"golang.org/x/net/html/charset"
 )
 
 // ImageType represents an image type
@@ -32,6 +38,10 @@ const (
 	ImageTypeWEBP    ImageType = C.WEBP
 	ImageTypeHEIF    ImageType = C.HEIF
 	ImageTypeBMP     ImageType = C.BMP
+	ImageTypeHDR     ImageType = C.HDR
+	ImageTypeEXR     ImageType = C.EXR
+	ImageTypePNM     ImageType = C.PNM
+	ImageTypeQOI     ImageType = C.QOI
 )
 
 var imageTypeExtensionMap = map[ImageType]string{
@@ -45,8 +55,138 @@ var imageTypeExtensionMap = map[ImageType]string{
 	ImageTypeWEBP:   ".webp",
 	ImageTypeHEIF:   ".heic",
 	ImageTypeBMP:    ".bmp",
+	ImageTypeHDR:    ".hdr",
+	ImageTypeEXR:    ".exr",
+	ImageTypePNM:    ".pnm",
+	ImageTypeQOI:    ".qoi",
 }
 
+var imageTypeMIMEMap = map[ImageType]string{
+	ImageTypeGIF:  "image/gif",
+	ImageTypeJPEG: "image/jpeg",
+	ImageTypePDF:  "application/pdf",
+	ImageTypePNG:  "image/png",
+	ImageTypeSVG:  "image/svg+xml",
+	ImageTypeTIFF: "image/tiff",
+	ImageTypeWEBP: "image/webp",
+	ImageTypeHEIF: "image/heif",
+	ImageTypeBMP:  "image/bmp",
+	ImageTypeHDR:  "image/vnd.radiance",
+	ImageTypeEXR:  "image/x-exr",
+	ImageTypePNM:  "image/x-portable-anymap",
+	ImageTypeQOI:  "image/qoi",
+}
+
+// imageTypeAcceptMIMEs lists the media types an image type is negotiated for when they differ from its MIME.
+// HEIF export encodes HEVC unless an AV1 HeifEncoder is set, so HEIF is not negotiated for image/avif.
+var imageTypeAcceptMIMEs = map[ImageType][]string{
+	ImageTypeHEIF: {"image/heif", "image/heic"},
+}
+
+// TiffCompression represents the compression used when saving TIFF images
+type TiffCompression int
+
+// TiffCompression enum. TiffCompressionDefault uses no compression for lossless export and LZW otherwise.
+const (
+	TiffCompressionDefault TiffCompression = iota
+	TiffCompressionNone
+	TiffCompressionJPEG
+	TiffCompressionDeflate
+	TiffCompressionPackbits
+	TiffCompressionCCITTFax4
+	TiffCompressionLZW
+)
+
+var tiffCompressions = map[TiffCompression]C.int{
+	TiffCompressionNone:      C.VIPS_FOREIGN_TIFF_COMPRESSION_NONE,
+	TiffCompressionJPEG:      C.VIPS_FOREIGN_TIFF_COMPRESSION_JPEG,
+	TiffCompressionDeflate:   C.VIPS_FOREIGN_TIFF_COMPRESSION_DEFLATE,
+	TiffCompressionPackbits:  C.VIPS_FOREIGN_TIFF_COMPRESSION_PACKBITS,
+	TiffCompressionCCITTFax4: C.VIPS_FOREIGN_TIFF_COMPRESSION_CCITTFAX4,
+	TiffCompressionLZW:       C.VIPS_FOREIGN_TIFF_COMPRESSION_LZW,
+}
+
+// WebPPreset represents the libwebp preset, which tunes the encoder for the kind of image content
+type WebPPreset int
+
+// WebPPreset enum. WebPPresetIcon and WebPPresetDrawing suit graphics with few colors, such as icons and logos.
+const (
+	WebPPresetDefault WebPPreset = iota
+	WebPPresetPicture
+	WebPPresetPhoto
+	WebPPresetDrawing
+	WebPPresetIcon
+	WebPPresetText
+)
+
+var webpPresets = map[WebPPreset]C.int{
+	WebPPresetDefault: C.VIPS_FOREIGN_WEBP_PRESET_DEFAULT,
+	WebPPresetPicture: C.VIPS_FOREIGN_WEBP_PRESET_PICTURE,
+	WebPPresetPhoto:   C.VIPS_FOREIGN_WEBP_PRESET_PHOTO,
+	WebPPresetDrawing: C.VIPS_FOREIGN_WEBP_PRESET_DRAWING,
+	WebPPresetIcon:    C.VIPS_FOREIGN_WEBP_PRESET_ICON,
+	WebPPresetText:    C.VIPS_FOREIGN_WEBP_PRESET_TEXT,
+}
+
+// TiffSampleFormat represents the sample format of TIFF output
+type TiffSampleFormat int
+
+// TiffSampleFormat enum. TiffSampleFormatDefault keeps the band format of the image.
+const (
+	TiffSampleFormatDefault TiffSampleFormat = iota
+	TiffSampleFormatUint8
+	TiffSampleFormatUint16
+	TiffSampleFormatFloat32
+)
+
+var tiffSampleFormats = map[TiffSampleFormat]BandFormat{
+	TiffSampleFormatUint8:   BandFormatUchar,
+	TiffSampleFormatUint16:  BandFormatUshort,
+	TiffSampleFormatFloat32: BandFormatFloat,
+}
+
+// DensityUnit represents the unit of the JFIF density written when saving JPEG images
+type DensityUnit int
+
+// DensityUnit enum
+const (
+	DensityUnitInch       DensityUnit = C.DENSITY_UNIT_INCH
+	DensityUnitCentimeter DensityUnit = C.DENSITY_UNIT_CENTIMETER
+)
+
+// HeifEncoder represents the libheif encoder used when saving HEIF images
+type HeifEncoder int
+
+// HeifEncoder enum
+const (
+	HeifEncoderAuto  HeifEncoder = C.HEIF_ENCODER_AUTO
+	HeifEncoderAOM   HeifEncoder = C.HEIF_ENCODER_AOM
+	HeifEncoderRav1e HeifEncoder = C.HEIF_ENCODER_RAV1E
+	HeifEncoderSVT   HeifEncoder = C.HEIF_ENCODER_SVT
+	HeifEncoderX265  HeifEncoder = C.HEIF_ENCODER_X265
+)
+
+// SubsampleMode represents the chroma subsampling of lossy output
+type SubsampleMode int
+
+// SubsampleMode enum. SubsampleModeAuto lets libvips decide, which keeps full chroma for qualities of 90 and up.
+const (
+	SubsampleModeAuto SubsampleMode = C.VIPS_FOREIGN_JPEG_SUBSAMPLE_AUTO
+	SubsampleModeOn   SubsampleMode = C.VIPS_FOREIGN_JPEG_SUBSAMPLE_ON
+	SubsampleModeOff  SubsampleMode = C.VIPS_FOREIGN_JPEG_SUBSAMPLE_OFF
+)
+
+// ProcessingPrecision represents the band format images are processed in after loading
+type ProcessingPrecision int
+
+// ProcessingPrecision enum. ProcessingPrecisionDefault keeps the band format of the decoder.
+const (
+	ProcessingPrecisionDefault ProcessingPrecision = iota
+	ProcessingPrecision8
+	ProcessingPrecision16
+	ProcessingPrecisionFloat
+)
+
 // ImageTypes defines the various image types supported by govips
 var ImageTypes = map[ImageType]string{
 	ImageTypeGIF:    "gif",
@@ -59,9 +199,20 @@ var ImageTypes = map[ImageType]string{
 	ImageTypeWEBP:   "webp",
 	ImageTypeHEIF:   "heif",
 	ImageTypeBMP:    "bmp",
+	ImageTypeHDR:    "hdr",
+	ImageTypeEXR:    "exr",
+	ImageTypePNM:    "pnm",
+	ImageTypeQOI:    "qoi",
+}
+
+// imageTypeLoaders holds the libvips loader names for image types where they differ from ImageTypes
+var imageTypeLoaders = map[ImageType]string{
+	ImageTypeHDR: "rad",
+	ImageTypeEXR: "openexr",
+	ImageTypePNM: "ppm",
 }
 
-// FileExt returns the canonical extension for the ImageType
+// FileExt returns the canonical extension for the ImageType, see DetermineFileExt for brand specific HEIF extensions
 func (i ImageType) FileExt() string {
 	if ext, ok := imageTypeExtensionMap[i]; ok {
 		return ext
@@ -69,6 +220,99 @@ func (i ImageType) FileExt() string {
 	return ""
 }
 
+// MIME returns the media type for the ImageType, e.g. for a Content-Type header
+func (i ImageType) MIME() string {
+	if mime, ok := imageTypeMIMEMap[i]; ok {
+		return mime
+	}
+	return ""
+}
+
+// NegotiateFormat picks the image type to respond with for the given HTTP Accept header. Candidates are
+// given in order of preference and are weighed by the q-value of the most specific matching media range
+// (e.g. image/webp, image/* or */*). Candidates which are not supported on this host are skipped.
+// ImageTypeHEIF is matched by image/heif and image/heic, but not by image/avif, as HEIF export encodes HEVC
+// by default. If no candidate is acceptable, ImageTypeJPEG is returned.
+func NegotiateFormat(accept string, candidates []ImageType) ImageType {
+	ranges := parseAccept(accept)
+
+	best := ImageTypeJPEG
+	bestQuality := 0.0
+	for _, candidate := range candidates {
+		mimes, ok := imageTypeAcceptMIMEs[candidate]
+		if !ok {
+			mimes = []string{candidate.MIME()}
+		}
+		if mimes[0] == "" || !IsTypeSupported(candidate) {
+			continue
+		}
+
+		for _, mime := range mimes {
+			if quality := acceptQuality(ranges, mime); quality > bestQuality {
+				best = candidate
+				bestQuality = quality
+			}
+		}
+	}
+
+	return best
+}
+
+// mediaRange is a media range of an Accept header with its q-value
+type mediaRange struct {
+	mime    string
+	quality float64
+}
+
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mime := strings.ToLower(strings.TrimSpace(params[0]))
+		if mime == "" {
+			continue
+		}
+
+		quality := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					quality = q
+				}
+			}
+		}
+
+		ranges = append(ranges, mediaRange{mime: mime, quality: quality})
+	}
+	return ranges
+}
+
+// acceptQuality returns the q-value of the most specific media range matching mime, or 0 if none matches
+func acceptQuality(ranges []mediaRange, mime string) float64 {
+	typeWildcard := mime[:strings.Index(mime, "/")+1] + "*"
+
+	quality, specificity := 0.0, 0
+	for _, r := range ranges {
+		var s int
+		switch r.mime {
+		case mime:
+			s = 3
+		case typeWildcard:
+			s = 2
+		case "*/*":
+			s = 1
+		default:
+			continue
+		}
+
+		if s > specificity {
+			quality, specificity = r.quality, s
+		}
+	}
+	return quality
+}
+
 // IsTypeSupported checks whether given image type is supported by govips
 func IsTypeSupported(imageType ImageType) bool {
 	startupIfNeeded()
@@ -76,11 +320,47 @@ func IsTypeSupported(imageType ImageType) bool {
 	return supportedImageTypes[imageType]
 }
 
-// DetermineImageType attempts to determine the image type of the given buffer
+// imageTypeSavers maps the image types govips can export to the libvips saver used for them
+var imageTypeSavers = []struct {
+	imageType ImageType
+	saver     string
+}{
+	{ImageTypeJPEG, "jpegsave_buffer"},
+	{ImageTypeMagick, "magicksave_buffer"},
+	{ImageTypePNG, "pngsave_buffer"},
+	{ImageTypeTIFF, "tiffsave_buffer"},
+	{ImageTypeWEBP, "webpsave_buffer"},
+	{ImageTypeHEIF, "heifsave_buffer"},
+	{ImageTypePNM, "ppmsave"},
+}
+
+// AvailableOutputFormats returns the image types an image of the given type can be exported to on this host,
+// e.g. to populate a "convert to" menu. It is empty if the input type cannot be loaded. Exporting to
+// ImageTypeMagick additionally needs ExportParams.MagickFormat.
+func AvailableOutputFormats(in ImageType) []ImageType {
+	if !IsTypeSupported(in) {
+		return nil
+	}
+
+	var formats []ImageType
+	for _, s := range imageTypeSavers {
+		if IsTypeSupported(s.imageType) && hasOperation(s.saver) {
+			formats = append(formats, s.imageType)
+		}
+	}
+	return formats
+}
+
+// DetermineImageType attempts to determine the image type of the given buffer. Formats which only the
+// ImageMagick loader can read, FLIF and JPEG-LS, are returned as ImageTypeMagick. Whether they can be loaded
+// depends on the delegates of the ImageMagick build.
 func DetermineImageType(buf []byte) ImageType {
 	if len(buf) < 12 {
 		return ImageTypeUnknown
 	} else if isJPEG(buf) {
+		if isJPEGLS(buf) {
+			return ImageTypeMagick
+		}
 		return ImageTypeJPEG
 	} else if isPNG(buf) {
 		return ImageTypePNG
@@ -98,11 +378,68 @@ func DetermineImageType(buf []byte) ImageType {
 		return ImageTypePDF
 	} else if isBMP(buf) {
 		return ImageTypeBMP
+	} else if isHDR(buf) {
+		return ImageTypeHDR
+	} else if isEXR(buf) {
+		return ImageTypeEXR
+	} else if isPNM(buf) {
+		return ImageTypePNM
+	} else if isQOI(buf) {
+		return ImageTypeQOI
+	} else if isFLIF(buf) {
+		return ImageTypeMagick
 	} else {
 		return ImageTypeUnknown
 	}
 }
 
+// heifBrandExtensions maps the major brand of HEIF images to the extension conventionally used for it
+var heifBrandExtensions = map[string]string{
+	"heic": ".heic",
+	"mif1": ".heif",
+	"msf1": ".heif",
+	"avif": ".avif",
+}
+
+// DetermineFileExt returns the extension for the image type of the buffer. Unlike ImageType.FileExt it
+// takes the brand of HEIF images into account, so mif1 files get ".heif" and AVIF files ".avif" instead
+// of ".heic". It returns "" for unknown image types.
+func DetermineFileExt(buf []byte) string {
+	imageType := DetermineImageType(buf)
+	if imageType == ImageTypeHEIF {
+		if ext, ok := heifBrandExtensions[string(buf[8:12])]; ok {
+			return ext
+		}
+	}
+	return imageType.FileExt()
+}
+
+var (
+	pngTrailer  = []byte("\x00\x00\x00\x00IEND\xAE\x42\x60\x82")
+	gifTrailer  = []byte("\x3B")
+	jpegTrailer = []byte("\xFF\xD9")
+)
+
+// IsComplete is a cheap structural check for truncated uploads, without decoding the image: PNG must end
+// with the IEND chunk, GIF with the trailer byte, JPEG with the end of image marker (ignoring zero padding)
+// and WebP must be as long as its RIFF header states. Other image types are reported as complete, unknown
+// types are not.
+func IsComplete(buf []byte) bool {
+	switch DetermineImageType(buf) {
+	case ImageTypeUnknown:
+		return false
+	case ImageTypePNG:
+		return bytes.HasSuffix(buf, pngTrailer)
+	case ImageTypeGIF:
+		return bytes.HasSuffix(buf, gifTrailer)
+	case ImageTypeJPEG:
+		return bytes.HasSuffix(bytes.TrimRight(buf, "\x00"), jpegTrailer)
+	case ImageTypeWEBP:
+		return uint64(binary.LittleEndian.Uint32(buf[4:8]))+8 <= uint64(len(buf))
+	}
+	return true
+}
+
 var jpeg = []byte("\xFF\xD8\xFF")
 
 func isJPEG(buf []byte) bool {
@@ -151,17 +488,13 @@ func isHEIF(buf []byte) bool {
 var svg = []byte("<svg")
 
 func isSVG(buf []byte) bool {
-	sub := buf[:int(math.Min(1024.0, float64(len(buf))))]
+	text := svgText(buf)
+	sub := text[:int(math.Min(1024.0, float64(len(text))))]
 	if bytes.Contains(sub, svg) {
 		data := &struct {
 			XMLName xml.Name `xml:"svg"`
 		}{}
-		reader := bytes.NewReader(buf)
-		decoder := xml.NewDecoder(reader)
-		decoder.Strict = false
-		decoder.CharsetReader = charset.NewReaderLabel
-
-		err := decoder.Decode(data)
+		err := newSVGDecoder(text).Decode(data)
 
 		return err == nil && data.XMLName.Local == "svg"
 	}
@@ -181,6 +514,41 @@ func isBMP(buf []byte) bool {
 	return bytes.HasPrefix(buf, bmpHeader)
 }
 
+var flifHeader = []byte("FLIF")
+
+func isFLIF(buf []byte) bool {
+	return bytes.HasPrefix(buf, flifHeader)
+}
+
+var radianceHeader = []byte("#?RADIANCE")
+var rgbeHeader = []byte("#?RGBE")
+
+func isHDR(buf []byte) bool {
+	return bytes.HasPrefix(buf, radianceHeader) || bytes.HasPrefix(buf, rgbeHeader)
+}
+
+var exrHeader = []byte("\x76\x2F\x31\x01")
+
+func isEXR(buf []byte) bool {
+	return bytes.HasPrefix(buf, exrHeader)
+}
+
+// isPNM detects the NetPBM family by the magic number: P1-P3 ASCII and P4-P6 binary PBM, PGM and PPM,
+// P7 PAM and Pf/PF grey and color PFM, followed by whitespace. Only some libvips versions can load PAM.
+func isPNM(buf []byte) bool {
+	if len(buf) < 3 || buf[0] != 'P' {
+		return false
+	}
+
+	switch buf[2] {
+	case ' ', '\t', '\n', '\r':
+	default:
+		return false
+	}
+
+	return (buf[1] >= '1' && buf[1] <= '7') || buf[1] == 'f' || buf[1] == 'F'
+}
+
 func vipsLoadFromBuffer(buf []byte, o ...ImportOption) (*C.VipsImage, ImageType, error) {
 	src := buf
 	// Reference src here so it's not garbage collected during image initialization.
@@ -188,7 +556,9 @@ func vipsLoadFromBuffer(buf []byte, o ...ImportOption) (*C.VipsImage, ImageType,
 	imageType := DetermineImageType(buf)
 
 	options := ImportOptions{
-		imageType: ImageTypeUnknown,
+		imageType:  ImageTypeUnknown,
+		colorspace: InterpretationError,
+		maxPixels:  -1,
 		params: importParams{
 			shrink: 1,
 			fail:   false,
@@ -206,10 +576,22 @@ func vipsLoadFromBuffer(buf []byte, o ...ImportOption) (*C.VipsImage, ImageType,
 		},
 	}
 
+	for _, option := range getDefaultImportOptions() {
+		option(&options)
+	}
+
 	for _, option := range o {
 		option(&options)
 	}
 
+	if options.raw {
+		options.params.autorotate = false
+		options.colorspace = InterpretationError
+		options.premultiplied = false
+		options.invertCMYK = false
+		options.precision = ProcessingPrecisionDefault
+	}
+
 	var err error
 	var out *C.VipsImage
 
@@ -218,67 +600,357 @@ func vipsLoadFromBuffer(buf []byte, o ...ImportOption) (*C.VipsImage, ImageType,
 		imageType = options.imageType
 	}
 
-	if imageType == ImageTypeBMP {
-		src, err = bmpToPNG(src)
-		if err != nil {
+	// set when a BMP is fed to magick directly, so that it can be retried via PNG if magick fails
+	bmpFallback := false
+
+	// a pinned loader reads BMP images itself
+	isBMP := imageType == ImageTypeBMP && options.loader == ""
+
+	if isBMP && options.directBMP && IsTypeSupported(ImageTypeMagick) {
+		imageType = ImageTypeMagick
+		bmpFallback = isBMPConversionEnabled()
+	} else if isBMP && !isBMPConversionEnabled() {
+		govipsLog("govips", LogLevelInfo, fmt.Sprintf("rejecting bmp as the conversion to png is disabled size=%d", len(src)))
+		return nil, ImageTypeUnknown, ErrUnsupportedImageFormat
+	} else if isBMP {
+		converted, err := bmpToPNG(src)
+		switch {
+		case err == nil:
+			src = converted
+			imageType = ImageTypePNG
+		case IsTypeSupported(ImageTypeMagick):
+			// e.g. OS/2 headers or V4/V5 headers with alpha bitfields, which x/image/bmp cannot decode
+			govipsLog("govips", LogLevelInfo, fmt.Sprintf("loading bmp with magick header=%d error=%v", bmpHeaderSize(src), err))
+			imageType = ImageTypeMagick
+		default:
 			return nil, ImageTypeUnknown, err
 		}
-
-		imageType = ImageTypePNG
 	}
 
-	if !IsTypeSupported(imageType) {
+	if options.loader == "" && !IsTypeSupported(imageType) {
+		if options.passthrough && imageType != ImageTypeUnknown {
+			govipsLog("govips", LogLevelInfo, fmt.Sprintf("passing through unsupported image format type=%s size=%d", ImageTypes[imageType], len(buf)))
+			return nil, imageType, &PassthroughError{Buf: buf, ImageType: imageType}
+		}
+
 		govipsLog("govips", LogLevelInfo, fmt.Sprintf("failed to understand image format size=%d", len(src)))
 		return nil, ImageTypeUnknown, ErrUnsupportedImageFormat
 	}
 
+	maxPixels := options.maxPixels
+	if maxPixels < 0 && (imageType == ImageTypeSVG || imageType == ImageTypeQOI) {
+		maxPixels = defaultMaxRasterPixels
+	}
+
 	var code C.int
 
-	switch imageType {
-	case ImageTypeJPEG:
-		code = C.load_jpeg_buffer(unsafe.Pointer(&src[0]), C.size_t(len(src)), &out,
-			C.int(options.params.shrink), C.int(boolToInt(options.params.fail)),
-			C.int(boolToInt(options.params.autorotate)))
-	case ImageTypePNG:
-		code = C.load_png_buffer(unsafe.Pointer(&src[0]), C.size_t(len(src)), &out)
-	case ImageTypeWEBP:
-		code = C.load_webp_buffer(unsafe.Pointer(&src[0]), C.size_t(len(src)), &out,
-			C.int(options.params.shrink))
-	case ImageTypeTIFF:
-		code = C.load_tiff_buffer(unsafe.Pointer(&src[0]), C.size_t(len(src)), &out,
-			C.int(options.params.page), C.int(options.params.n), C.int(boolToInt(options.params.autorotate)),
-			C.int(options.params.subifd))
-	case ImageTypeGIF:
-		code = C.load_gif_buffer(unsafe.Pointer(&src[0]), C.size_t(len(src)), &out,
-			C.int(options.params.page), C.int(options.params.n))
-	case ImageTypePDF:
-		govipsLog("govips", LogLevelInfo, fmt.Sprintf("pdf options page=%d n=%d dpi=%f scale=%f", options.params.page, options.params.n, options.params.dpi, options.params.scale))
-		code = C.load_pdf_buffer(unsafe.Pointer(&src[0]), C.size_t(len(src)), &out,
-			C.int(options.params.page), C.int(options.params.n), C.double(options.params.dpi),
-			C.double(options.params.scale))
-	case ImageTypeSVG:
-		code = C.load_svg_buffer(unsafe.Pointer(&src[0]), C.size_t(len(src)), &out,
-			C.double(options.params.dpi), C.double(options.params.scale), C.int(boolToInt(options.params.unlimited)))
-	case ImageTypeHEIF:
-		code = C.load_heif_buffer(unsafe.Pointer(&src[0]), C.size_t(len(src)), &out,
-			C.int(options.params.page), C.int(options.params.n), C.int(boolToInt(options.params.thumbnail)))
-	case ImageTypeMagick:
-		density := C.CString(options.params.density)
-		defer C.free(unsafe.Pointer(density))
-		code = C.load_magick_buffer(unsafe.Pointer(&src[0]), C.size_t(len(src)), &out,
-			C.int(options.params.page), C.int(options.params.n), density)
-	default:
-		panic(ErrUnsupportedImageFormat) // unreachable, in theory
+	if options.loader != "" {
+		loader := C.CString(options.loader)
+		defer freeCString(loader)
+		code = C.load_buffer_with_loader(loader, unsafe.Pointer(&src[0]), C.size_t(len(src)), &out)
+		imageType = loaderImageType(options.loader, imageType)
+	} else {
+		switch imageType {
+		case ImageTypeJPEG:
+			govipsLog("govips", LogLevelDebug, fmt.Sprintf("jpeg variant=%s", JPEGVariants[DetermineJPEGVariant(src)]))
+			code = C.load_jpeg_buffer(unsafe.Pointer(&src[0]), C.size_t(len(src)), &out,
+				C.int(options.params.shrink), C.int(boolToInt(options.params.fail)),
+				C.int(boolToInt(options.params.autorotate)))
+		case ImageTypePNG:
+			code = C.load_png_buffer(unsafe.Pointer(&src[0]), C.size_t(len(src)), &out,
+				C.int(boolToInt(options.params.autorotate)))
+		case ImageTypeWEBP:
+			code = C.load_webp_buffer(unsafe.Pointer(&src[0]), C.size_t(len(src)), &out,
+				C.int(options.params.shrink), C.int(options.params.page), C.int(options.params.n),
+				C.int(boolToInt(options.params.autorotate)))
+		case ImageTypeTIFF:
+			code = C.load_tiff_buffer(unsafe.Pointer(&src[0]), C.size_t(len(src)), &out,
+				C.int(options.params.page), C.int(options.params.n), C.int(boolToInt(options.params.autorotate)),
+				C.int(options.params.subifd))
+		case ImageTypeGIF:
+			code = C.load_gif_buffer(unsafe.Pointer(&src[0]), C.size_t(len(src)), &out,
+				C.int(options.params.page), C.int(options.params.n))
+		case ImageTypePDF:
+			govipsLog("govips", LogLevelInfo, fmt.Sprintf("pdf options page=%d n=%d dpi=%f scale=%f", options.params.page, options.params.n, options.params.dpi, options.params.scale))
+			code = C.load_pdf_buffer(unsafe.Pointer(&src[0]), C.size_t(len(src)), &out,
+				C.int(options.params.page), C.int(options.params.n), C.double(options.params.dpi),
+				C.double(options.params.scale))
+		case ImageTypeSVG:
+			code = C.load_svg_buffer(unsafe.Pointer(&src[0]), C.size_t(len(src)), &out,
+				C.double(options.params.dpi), C.double(options.params.scale), C.int(boolToInt(options.params.unlimited)))
+		case ImageTypeHEIF:
+			code = C.load_heif_buffer(unsafe.Pointer(&src[0]), C.size_t(len(src)), &out,
+				C.int(options.params.page), C.int(options.params.n), C.int(boolToInt(options.params.thumbnail)),
+				C.int(boolToInt(options.params.autorotate)))
+		case ImageTypeMagick:
+			density := C.CString(options.params.density)
+			defer C.free(unsafe.Pointer(density))
+			code = C.load_magick_buffer(unsafe.Pointer(&src[0]), C.size_t(len(src)), &out,
+				C.int(options.params.page), C.int(options.params.n), density)
+		case ImageTypeHDR:
+			code = C.load_hdr_buffer(unsafe.Pointer(&src[0]), C.size_t(len(src)), &out)
+		case ImageTypeEXR:
+			out, err = vipsLoadEXR(src)
+			if err != nil {
+				return nil, ImageTypeUnknown, err
+			}
+		case ImageTypePNM:
+			out, err = vipsLoadPNM(src)
+			if err != nil {
+				return nil, ImageTypeUnknown, err
+			}
+		case ImageTypeQOI:
+			out, err = qoiToVips(src, maxPixels)
+			if err != nil {
+				return nil, ImageTypeUnknown, err
+			}
+		default:
+			panic(ErrUnsupportedImageFormat) // unreachable, in theory
+		}
+	}
+
+	if code != 0 && bmpFallback {
+		if converted, err := bmpToPNG(src); err == nil {
+			govipsLog("govips", LogLevelInfo, fmt.Sprintf("magick failed to load bmp, loading via png error=%v", handleImageError(out)))
+			src = converted
+			imageType = ImageTypePNG
+			code = C.load_png_buffer(unsafe.Pointer(&src[0]), C.size_t(len(src)), &out, C.int(0))
+		}
 	}
 
 	if code != 0 {
 		return nil, ImageTypeUnknown, handleImageError(out)
 	}
 
+	// svg and pdf are rendered lazily, so the dimensions are known before any pixels are allocated
+	if (imageType == ImageTypeSVG || imageType == ImageTypePDF) && maxPixels > 0 {
+		width, height := int(out.Xsize), vipsGetPageHeight(out)
+		if int64(width)*int64(height) > int64(maxPixels) {
+			clearImage(out)
+			return nil, ImageTypeUnknown, fmt.Errorf("%w: %dx%d is larger than %d pixels",
+				ErrMaxRasterPixelsExceeded, width, height, maxPixels)
+		}
+	}
+
+	// loaders only read the header here, so the frames are counted before any of them is decoded
+	if options.maxFrames > 0 {
+		pageHeight := vipsGetPageHeight(out)
+		if frames := int(out.Ysize) / pageHeight; frames > options.maxFrames {
+			if !options.truncateFrames {
+				clearImage(out)
+				return nil, ImageTypeUnknown, fmt.Errorf("%w: %d frames are more than %d",
+					ErrMaxFramesExceeded, frames, options.maxFrames)
+			}
+
+			truncated, err := vipsExtractArea(out, 0, 0, int(out.Xsize), pageHeight*options.maxFrames)
+			clearImage(out)
+			if err != nil {
+				return nil, ImageTypeUnknown, err
+			}
+
+			// copy before changing metadata, the cut strip may be shared via the operation cache
+			out, err = vipsCopyImage(truncated)
+			clearImage(truncated)
+			if err != nil {
+				return nil, ImageTypeUnknown, err
+			}
+			vipsTruncateMetaFrames(out, options.maxFrames)
+		}
+	}
+
+	if imageType == ImageTypeWEBP {
+		if animation, ok := readWebPAnimation(src); ok {
+			// copy before changing metadata, the loaded image may be shared via the operation cache
+			tagged, err := vipsCopyImage(out)
+			clearImage(out)
+			if err != nil {
+				return nil, ImageTypeUnknown, err
+			}
+			out = tagged
+
+			vipsSetMetaWebPBackground(out, animation.background)
+		}
+	}
+
+	if options.premultiplied && vipsHasAlpha(out) {
+		straight, err := vipsUnpremultiplyAlphaToFormat(out)
+		clearImage(out)
+		if err != nil {
+			return nil, ImageTypeUnknown, err
+		}
+		out = straight
+	}
+
+	if options.invertCMYK && Interpretation(out.Type) == InterpretationCMYK {
+		inverted, err := vipsInvertCMYK(out)
+		clearImage(out)
+		if err != nil {
+			return nil, ImageTypeUnknown, err
+		}
+		out = inverted
+	}
+
+	if options.precision != ProcessingPrecisionDefault {
+		narrowed, err := vipsCastToPrecision(out, options.precision)
+		clearImage(out)
+		if err != nil {
+			return nil, ImageTypeUnknown, err
+		}
+		out = narrowed
+	}
+
+	if options.colorspace != InterpretationError {
+		converted, err := vipsImportColorspace(out, options.colorspace)
+		clearImage(out)
+		if err != nil {
+			return nil, ImageTypeUnknown, err
+		}
+		out = converted
+	}
+
 	return out, imageType, nil
 }
 
+// vipsCastToPrecision converts the image to the band format of the precision. 16-bit RGB and grey images
+// and scRGB are converted to the matching color space, other integer images are shifted to keep their range.
+func vipsCastToPrecision(in *C.VipsImage, precision ProcessingPrecision) (*C.VipsImage, error) {
+	interpretation := Interpretation(in.Type)
+
+	switch precision {
+	case ProcessingPrecision8:
+		switch interpretation {
+		case InterpretationRGB16, InterpretationScRGB:
+			return vipsToColorSpace(in, InterpretationSRGB)
+		case InterpretationGrey16:
+			return vipsToColorSpace(in, InterpretationBW)
+		}
+		return vipsCastShift(in, BandFormatUchar)
+	case ProcessingPrecision16:
+		switch interpretation {
+		case InterpretationSRGB, InterpretationScRGB:
+			return vipsToColorSpace(in, InterpretationRGB16)
+		case InterpretationBW:
+			return vipsToColorSpace(in, InterpretationGrey16)
+		}
+		return vipsCastShift(in, BandFormatUshort)
+	case ProcessingPrecisionFloat:
+		return vipsCast(in, BandFormatFloat)
+	}
+
+	return nil, fmt.Errorf("unknown processing precision %d", precision)
+}
+
+func vipsLoadEXR(buf []byte) (*C.VipsImage, error) {
+	file, err := writeTempFile(buf, "govips-*.exr")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file)
+
+	filename := C.CString(file)
+	defer freeCString(filename)
+
+	var out *C.VipsImage
+	if err := C.load_exr_file(filename, &out); err != 0 {
+		return nil, handleImageError(out)
+	}
+
+	return out, nil
+}
+
+func vipsLoadPNM(buf []byte) (*C.VipsImage, error) {
+	file, err := writeTempFile(buf, "govips-*.pnm")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file)
+
+	filename := C.CString(file)
+	defer freeCString(filename)
+
+	var out *C.VipsImage
+	if err := C.load_ppm_file(filename, &out); err != 0 {
+		return nil, handleImageError(out)
+	}
+
+	return out, nil
+}
+
+// loaderImageType returns the image type read by a libvips buffer loader such as "magickload_buffer",
+// or fallback if the loader isn't known
+func loaderImageType(loader string, fallback ImageType) ImageType {
+	name := strings.TrimSuffix(loader, "load_buffer")
+	for imageType, typeName := range ImageTypes {
+		if override, ok := imageTypeLoaders[imageType]; ok {
+			typeName = override
+		}
+		if typeName == name {
+			return imageType
+		}
+	}
+	return fallback
+}
+
+// writeTempFile stores buf in a new temporary file for loaders which only read from files,
+// the caller must remove the returned file
+func writeTempFile(buf []byte, pattern string) (string, error) {
+	file, err := ioutil.TempFile("", pattern)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = file.Write(buf)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+
+	return file.Name(), nil
+}
+
+var (
+	bmpConversionDisabled     bool
+	bmpConversionDisabledLock sync.RWMutex
+)
+
+// SetBMPConversion controls whether BMP images, which libvips cannot load itself, are decoded with Go and
+// handed to libvips as PNG. It is enabled by default. When disabled, loading a BMP fails with
+// ErrUnsupportedImageFormat, unless DirectBMPImportOption loads it with the magick loader, which then has
+// no PNG fallback.
+func SetBMPConversion(enabled bool) {
+	bmpConversionDisabledLock.Lock()
+	defer bmpConversionDisabledLock.Unlock()
+
+	bmpConversionDisabled = !enabled
+}
+
+func isBMPConversionEnabled() bool {
+	bmpConversionDisabledLock.RLock()
+	defer bmpConversionDisabledLock.RUnlock()
+
+	return !bmpConversionDisabled
+}
+
+// BMP DIB header sizes which x/image/bmp can decode (BITMAPINFOHEADER, BITMAPV4HEADER and BITMAPV5HEADER).
+// OS/2 headers (12 and 64 bytes) are not supported.
+var bmpDecodableHeaderSizes = map[int]bool{40: true, 108: true, 124: true}
+
+// bmpHeaderSize returns the size of the DIB header, which identifies the BMP variant
+func bmpHeaderSize(buf []byte) int {
+	if len(buf) < 18 {
+		return 0
+	}
+	return int(binary.LittleEndian.Uint32(buf[14:18]))
+}
+
 func bmpToPNG(src []byte) ([]byte, error) {
+	if !bmpDecodableHeaderSizes[bmpHeaderSize(src)] {
+		return nil, bmp.ErrUnsupported
+	}
+
 	i, err := bmp.Decode(bytes.NewReader(src))
 	if err != nil {
 		return nil, err
@@ -293,8 +965,23 @@ func bmpToPNG(src []byte) ([]byte, error) {
 	return w.Bytes(), nil
 }
 
+// qoiToVips decodes a QOI image with Go and hands the pixels to libvips
+func qoiToVips(src []byte, maxPixels int) (*C.VipsImage, error) {
+	pixels, width, height, channels, err := decodeQOI(src, maxPixels)
+	if err != nil {
+		return nil, err
+	}
+
+	return vipsImageFromMemory(pixels, width, height, channels, BandFormatUchar)
+}
+
 func vipsSavePNGToBuffer(in *C.VipsImage, stripMetadata bool, compression int, interlaced bool) ([]byte, error) {
 	incOpCounter("save_png_buffer")
+
+	if err := checkPNGCompression(compression); err != nil {
+		return nil, err
+	}
+
 	var ptr unsafe.Pointer
 	cLen := C.size_t(0)
 
@@ -309,8 +996,79 @@ func vipsSavePNGToBuffer(in *C.VipsImage, stripMetadata bool, compression int, i
 	return toBuff(ptr, cLen), nil
 }
 
-func vipsSaveWebPToBuffer(in *C.VipsImage, stripMetadata bool, quality int, lossless bool, effort int) ([]byte, error) {
+// webpMaxDimension is the largest width or height libwebp is able to encode
+const webpMaxDimension = 16383
+
+// maxQuality is the highest JPEG, WebP and HEIF quality. A quality of 0 leaves the libvips default.
+const maxQuality = 100
+
+// checkQuality rejects qualities libvips would otherwise ignore or clamp silently
+func checkQuality(format string, quality int) error {
+	if quality < 0 || quality > maxQuality {
+		return fmt.Errorf("invalid %s quality %d, the quality must be between 0 and %d", format, quality, maxQuality)
+	}
+	return nil
+}
+
+// pngMaxCompression is the highest zlib compression level
+const pngMaxCompression = 9
+
+// checkPNGCompression rejects compression levels libvips would otherwise ignore silently
+func checkPNGCompression(compression int) error {
+	if compression < 0 || compression > pngMaxCompression {
+		return fmt.Errorf("invalid PNG compression %d, the zlib level must be between 0 and %d", compression, pngMaxCompression)
+	}
+	return nil
+}
+
+// webpMaxEffort is the slowest WebP effort, which libvips passes to libwebp as the method (cwebp -m)
+const webpMaxEffort = 6
+
+// checkWebPEffort rejects efforts libvips would otherwise clamp silently
+func checkWebPEffort(effort int) error {
+	if effort < 0 || effort > webpMaxEffort {
+		return fmt.Errorf("invalid WebP effort %d, the libwebp method must be between 0 and %d", effort, webpMaxEffort)
+	}
+	return nil
+}
+
+// defaultMaxRasterPixels is the default limit for rasterizing SVG documents and decoding QOI images (10000x10000)
+const defaultMaxRasterPixels = 100000000
+
+// exact keeps the RGB values under fully transparent pixels, which libwebp otherwise modifies to compress better
+func vipsSaveWebPToBuffer(in *C.VipsImage, stripMetadata bool, quality int, lossless bool, effort int, preset WebPPreset, nearLossless bool, exact bool) ([]byte, error) {
 	incOpCounter("save_webp_buffer")
+
+	if err := checkQuality("WebP", quality); err != nil {
+		return nil, err
+	}
+
+	if err := checkWebPEffort(effort); err != nil {
+		return nil, err
+	}
+
+	webpPreset, ok := webpPresets[preset]
+	if !ok {
+		return nil, fmt.Errorf("invalid WebP preset %d", preset)
+	}
+
+	// libwebp applies presets to lossy encoding only and near-lossless at quality 100 leaves the pixels as is
+	if (lossless || nearLossless) && preset != WebPPresetDefault {
+		return nil, fmt.Errorf("WebP preset %d has no effect on lossless output", preset)
+	}
+	if nearLossless && quality == 100 {
+		return nil, fmt.Errorf("near-lossless WebP at quality 100 is lossless, use Lossless instead")
+	}
+
+	if exact && !hasOperationProperty("webpsave_buffer", "exact") {
+		return nil, ErrWebPExactUnsupported
+	}
+
+	// animated images are stored as a tall strip, so check the height of a single frame
+	if int(in.Xsize) > webpMaxDimension || vipsGetPageHeight(in) > webpMaxDimension {
+		return nil, ErrWebPDimensionExceeded
+	}
+
 	var ptr unsafe.Pointer
 	cLen := C.size_t(0)
 
@@ -318,47 +1076,176 @@ func vipsSaveWebPToBuffer(in *C.VipsImage, stripMetadata bool, quality int, loss
 	qual := C.int(quality)
 	loss := C.int(boolToInt(lossless))
 	eff := C.int(effort)
+	nearLoss := C.int(boolToInt(nearLossless))
+	ex := C.int(boolToInt(exact))
 
-	if err := C.save_webp_buffer(in, &ptr, &cLen, strip, qual, loss, eff); err != 0 {
+	if err := C.save_webp_buffer(in, &ptr, &cLen, strip, qual, loss, eff, webpPreset, nearLoss, ex); err != 0 {
 		return nil, handleSaveBufferError(ptr)
 	}
 
-	return toBuff(ptr, cLen), nil
+	buf := toBuff(ptr, cLen)
+
+	// libvips does not write the background color of animations, restore the one read on load
+	if background, ok := vipsGetMetaWebPBackground(in); ok {
+		setWebPAnimationBackground(buf, background)
+	}
+
+	return buf, nil
 }
 
-func vipsSaveTIFFToBuffer(in *C.VipsImage, stripMetadata bool, quality int, lossless bool) ([]byte, error) {
+// bitdepth 1 writes a bilevel image, which combined with TiffCompressionCCITTFax4 stores scanned
+// documents compactly. A bitdepth of 0 keeps the bit depth of the image.
+// sampleFormat casts the samples to the given format, e.g. float rasters are saved with 32-bit float samples.
+func vipsSaveTIFFToBuffer(in *C.VipsImage, stripMetadata bool, quality int, lossless bool, compression TiffCompression, bitdepth int, sampleFormat TiffSampleFormat) ([]byte, error) {
 	incOpCounter("save_tiff_buffer")
 	var ptr unsafe.Pointer
 	cLen := C.size_t(0)
 
+	in, err := vipsTIFFInput(in, bitdepth, sampleFormat)
+	if err != nil {
+		return nil, err
+	}
+	defer clearImage(in)
+
 	strip := C.int(boolToInt(stripMetadata))
 	qual := C.int(quality)
 	loss := C.int(boolToInt(lossless))
+	comp := vipsTIFFCompression(compression)
+	depth := C.int(bitdepth)
 
-	if err := C.save_tiff_buffer(in, &ptr, &cLen, strip, qual, loss); err != 0 {
+	if err := C.save_tiff_buffer(in, &ptr, &cLen, strip, qual, loss, comp, depth); err != 0 {
 		return nil, handleSaveBufferError(ptr)
 	}
 
 	return toBuff(ptr, cLen), nil
 }
 
-func vipsSaveHEIFToBuffer(in *C.VipsImage, quality int, lossless bool) ([]byte, error) {
+// vipsSaveTIFFToFile writes the image directly to a file without holding the output in memory,
+// the options are the same as for vipsSaveTIFFToBuffer
+func vipsSaveTIFFToFile(in *C.VipsImage, file string, stripMetadata bool, quality int, lossless bool, compression TiffCompression, bitdepth int, sampleFormat TiffSampleFormat) error {
+	incOpCounter("save_tiff_file")
+
+	in, err := vipsTIFFInput(in, bitdepth, sampleFormat)
+	if err != nil {
+		return err
+	}
+	defer clearImage(in)
+
+	filename := C.CString(file)
+	defer freeCString(filename)
+
+	strip := C.int(boolToInt(stripMetadata))
+	qual := C.int(quality)
+	loss := C.int(boolToInt(lossless))
+	comp := vipsTIFFCompression(compression)
+	depth := C.int(bitdepth)
+
+	if err := C.save_tiff_file(in, filename, strip, qual, loss, comp, depth); err != 0 {
+		return handleSaveError()
+	}
+
+	return nil
+}
+
+// vipsSavePNMToBuffer saves a binary PBM, PGM, PPM or PFM depending on the bands and format of the image.
+// libvips before 8.12 only saves PNM to files, so the image is written to a temporary file.
+func vipsSavePNMToBuffer(in *C.VipsImage, stripMetadata bool) ([]byte, error) {
+	incOpCounter("save_ppm_file")
+
+	file, err := writeTempFile(nil, "govips-*.pnm")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file)
+
+	filename := C.CString(file)
+	defer freeCString(filename)
+
+	if err := C.save_ppm_file(in, filename, C.int(boolToInt(stripMetadata))); err != 0 {
+		return nil, handleSaveError()
+	}
+
+	return ioutil.ReadFile(file)
+}
+
+// vipsTIFFInput returns a new reference to the image to save, converted to a single band for bilevel
+// output and cast to the sample format. Samples are cast without rescaling, so the values are unchanged.
+func vipsTIFFInput(in *C.VipsImage, bitdepth int, sampleFormat TiffSampleFormat) (*C.VipsImage, error) {
+	var out *C.VipsImage
+	var err error
+
+	if bitdepth != 1 || (Interpretation(in.Type) == InterpretationBW && int(in.Bands) == 1) {
+		out, err = vipsCopyImage(in)
+	} else {
+		grey, greyErr := vipsToColorSpace(in, InterpretationBW)
+		if greyErr != nil {
+			return nil, greyErr
+		}
+		out, err = vipsExtractBand(grey, 0, 1)
+		clearImage(grey)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	format, ok := tiffSampleFormats[sampleFormat]
+	if !ok || BandFormat(out.BandFmt) == format {
+		return out, nil
+	}
+
+	cast, err := vipsCast(out, format)
+	clearImage(out)
+	if err != nil {
+		return nil, err
+	}
+
+	return cast, nil
+}
+
+// vipsTIFFCompression maps the compression to libvips, -1 selects the default in the C savers
+func vipsTIFFCompression(compression TiffCompression) C.int {
+	if c, ok := tiffCompressions[compression]; ok {
+		return c
+	}
+	return -1
+}
+
+func vipsSaveHEIFToBuffer(in *C.VipsImage, quality int, lossless bool, encoder HeifEncoder, subsample SubsampleMode) ([]byte, error) {
 	incOpCounter("save_heif_buffer")
+
+	if err := checkQuality("HEIF", quality); err != nil {
+		return nil, err
+	}
+
+	if encoder != HeifEncoderAuto && !hasOperationProperty("heifsave_buffer", "encoder") {
+		return nil, ErrHEIFEncoderUnsupported
+	}
+
+	if subsample != SubsampleModeAuto && !hasOperationProperty("heifsave_buffer", "subsample_mode") {
+		return nil, ErrHEIFSubsampleModeUnsupported
+	}
+
 	var ptr unsafe.Pointer
 	cLen := C.size_t(0)
 
 	qual := C.int(quality)
 	loss := C.int(boolToInt(lossless))
 
-	if err := C.save_heif_buffer(in, &ptr, &cLen, qual, loss); err != 0 {
+	if err := C.save_heif_buffer(in, &ptr, &cLen, qual, loss, C.int(encoder), C.int(subsample)); err != 0 {
 		return nil, handleSaveBufferError(ptr)
 	}
 
 	return toBuff(ptr, cLen), nil
 }
 
-func vipsSaveJPEGToBuffer(in *C.VipsImage, quality int, stripMetadata, interlaced bool) ([]byte, error) {
+// density, if positive, is the JFIF density written in dots per unit instead of the image resolution
+func vipsSaveJPEGToBuffer(in *C.VipsImage, quality int, stripMetadata, interlaced bool, density float64, unit DensityUnit) ([]byte, error) {
 	incOpCounter("save_jpeg_buffer")
+
+	if err := checkQuality("JPEG", quality); err != nil {
+		return nil, err
+	}
+
 	var ptr unsafe.Pointer
 	cLen := C.size_t(0)
 
@@ -366,13 +1253,195 @@ func vipsSaveJPEGToBuffer(in *C.VipsImage, quality int, stripMetadata, interlace
 	qual := C.int(quality)
 	inter := C.int(boolToInt(interlaced))
 
-	if err := C.save_jpeg_buffer(in, &ptr, &cLen, strip, qual, inter); err != 0 {
+	if err := C.save_jpeg_buffer(in, &ptr, &cLen, strip, qual, inter, C.double(density), C.int(unit)); err != 0 {
+		return nil, handleSaveBufferError(ptr)
+	}
+
+	return toBuff(ptr, cLen), nil
+}
+
+// ssimTolerance is how far above the target SSIM an encoding may be to stop searching for a lower quality
+const ssimTolerance = 0.002
+
+// vipsSaveJPEGToBufferWithTargetSSIM binary searches the lowest JPEG quality which reaches the target SSIM
+// against the input. If even the highest quality does not reach it, the highest quality is used.
+func vipsSaveJPEGToBufferWithTargetSSIM(in *C.VipsImage, target float64, stripMetadata, interlaced bool, density float64, unit DensityUnit) ([]byte, error) {
+	var best []byte
+
+	for low, high := 1, 100; low <= high; {
+		quality := (low + high) / 2
+
+		buf, err := vipsSaveJPEGToBuffer(in, quality, stripMetadata, interlaced, density, unit)
+		if err != nil {
+			return nil, err
+		}
+
+		decoded, _, err := vipsLoadFromBuffer(buf, RawDecodeImportOption(true))
+		if err != nil {
+			return nil, err
+		}
+
+		ssim, err := vipsSSIM(in, decoded)
+		clearImage(decoded)
+		if err != nil {
+			return nil, err
+		}
+
+		govipsLog("govips", LogLevelDebug, fmt.Sprintf("jpeg target ssim=%f quality=%d ssim=%f", target, quality, ssim))
+
+		if ssim < target {
+			low = quality + 1
+			continue
+		}
+
+		best = buf
+		if ssim-target <= ssimTolerance {
+			break
+		}
+		high = quality - 1
+	}
+
+	if best == nil {
+		return vipsSaveJPEGToBuffer(in, 100, stripMetadata, interlaced, density, unit)
+	}
+
+	return best, nil
+}
+
+func vipsTranscodeGIFToWebP(buf []byte, stripMetadata bool, quality int, lossless bool, effort int, loop int) ([]byte, error) {
+	incOpCounter("transcode_gif_to_webp")
+	src := buf
+	// Reference src here so it's not garbage collected during the transcode.
+	defer runtime.KeepAlive(src)
+
+	if err := checkQuality("WebP", quality); err != nil {
+		return nil, err
+	}
+
+	if err := checkWebPEffort(effort); err != nil {
+		return nil, err
+	}
+
+	// every frame is decoded at the size of the GIF logical screen
+	width, height := gifScreenSize(src)
+	if width > webpMaxDimension || height > webpMaxDimension {
+		return nil, ErrWebPDimensionExceeded
+	}
+
+	var ptr unsafe.Pointer
+	cLen := C.size_t(0)
+
+	strip := C.int(boolToInt(stripMetadata))
+	qual := C.int(quality)
+	loss := C.int(boolToInt(lossless))
+	eff := C.int(effort)
+
+	if err := C.transcode_gif_to_webp(unsafe.Pointer(&src[0]), C.size_t(len(src)), &ptr, &cLen, strip, qual, loss, eff, C.int(loop)); err != 0 {
+		return nil, handleSaveBufferError(ptr)
+	}
+
+	return toBuff(ptr, cLen), nil
+}
+
+// gifScreenSize returns the logical screen size from the GIF header, or zero if the header is incomplete
+func gifScreenSize(buf []byte) (width, height int) {
+	if len(buf) < 10 {
+		return 0, 0
+	}
+
+	return int(binary.LittleEndian.Uint16(buf[6:8])), int(binary.LittleEndian.Uint16(buf[8:10]))
+}
+
+var magickFormatPattern = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+
+// vipsSaveMagickToBuffer saves the image with ImageMagick using the given coder, e.g. "DDS" or "XPM".
+// Whether a coder is available depends on the ImageMagick build, libvips reports an error for unknown coders.
+func vipsSaveMagickToBuffer(in *C.VipsImage, format string, quality int) ([]byte, error) {
+	incOpCounter("save_magick_buffer")
+
+	if !magickFormatPattern.MatchString(format) {
+		return nil, fmt.Errorf("invalid magick format %q", format)
+	}
+
+	if !hasOperation("magicksave_buffer") {
+		return nil, ErrUnsupportedImageFormat
+	}
+
+	if !isMagickCoderAvailable(format) {
+		return nil, fmt.Errorf("%w: magick coder %q is not available", ErrUnsupportedImageFormat, format)
+	}
+
+	var ptr unsafe.Pointer
+	cLen := C.size_t(0)
+
+	cFormat := C.CString(format)
+	defer freeCString(cFormat)
+	qual := C.int(quality)
+
+	if err := C.save_magick_buffer(in, &ptr, &cLen, cFormat, qual); err != 0 {
 		return nil, handleSaveBufferError(ptr)
 	}
 
 	return toBuff(ptr, cLen), nil
 }
 
+var (
+	magickCoders     = make(map[string]bool)
+	magickCodersLock sync.Mutex
+)
+
+// isMagickCoderAvailable reports whether the ImageMagick build can write the given coder. ImageMagick
+// offers no way to list its coders through libvips, so a 1x1 pixel image is saved with it once and the
+// result is cached.
+func isMagickCoderAvailable(format string) bool {
+	format = strings.ToUpper(format)
+
+	magickCodersLock.Lock()
+	defer magickCodersLock.Unlock()
+
+	if available, ok := magickCoders[format]; ok {
+		return available
+	}
+
+	available := probeMagickCoder(format)
+	magickCoders[format] = available
+	return available
+}
+
+func probeMagickCoder(format string) bool {
+	xyz, err := vipsXYZ(1, 1)
+	if err != nil {
+		return false
+	}
+	defer clearImage(xyz)
+
+	band, err := vipsExtractBand(xyz, 0, 1)
+	if err != nil {
+		return false
+	}
+	defer clearImage(band)
+
+	pixel, err := vipsCast(band, BandFormatUchar)
+	if err != nil {
+		return false
+	}
+	defer clearImage(pixel)
+
+	var ptr unsafe.Pointer
+	cLen := C.size_t(0)
+
+	cFormat := C.CString(format)
+	defer freeCString(cFormat)
+
+	if err := C.save_magick_buffer(pixel, &ptr, &cLen, cFormat, 0); err != 0 {
+		govipsLog("govips", LogLevelInfo, fmt.Sprintf("magick coder is not available format=%s error=%v", format, handleSaveBufferError(ptr)))
+		return false
+	}
+	gFreePointer(ptr)
+
+	return cLen > 0
+}
+
 func toBuff(ptr unsafe.Pointer, cLen C.size_t) []byte {
 	buf := C.GoBytes(ptr, C.int(cLen))
 	gFreePointer(ptr)
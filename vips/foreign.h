@@ -1,6 +1,7 @@
 // https://libvips.github.io/libvips/API/current/VipsForeignSave.html
 
 #include <stdlib.h>
+#include <string.h>
 #include <vips/vips.h>
 #include <vips/foreign.h>
 
@@ -16,22 +17,49 @@ enum types {
 	SVG,
 	MAGICK,
 	HEIF,
-	BMP
+	BMP,
+	HDR,
+	EXR,
+	PNM,
+	QOI
+};
+
+enum density_units {
+	DENSITY_UNIT_INCH = 0,
+	DENSITY_UNIT_CENTIMETER
+};
+
+// matches VipsForeignHeifEncoder, which is only defined by libvips 8.13+
+enum heif_encoders {
+	HEIF_ENCODER_AUTO = 0,
+	HEIF_ENCODER_AOM,
+	HEIF_ENCODER_RAV1E,
+	HEIF_ENCODER_SVT,
+	HEIF_ENCODER_X265
 };
 
 int load_jpeg_buffer(void *buf, size_t len, VipsImage **out, int shrink, int fail, int autorotate);
-int load_png_buffer(void *buf, size_t len, VipsImage **out);
-int load_webp_buffer(void *buf, size_t len, VipsImage **out, int shrink);
+int load_png_buffer(void *buf, size_t len, VipsImage **out, int autorotate);
+int load_webp_buffer(void *buf, size_t len, VipsImage **out, int shrink, int page, int n, int autorotate);
 int load_tiff_buffer(void *buf, size_t len, VipsImage **out, int page, int n, int autorotate, int subifd);
 int load_gif_buffer(void *buf, size_t len, VipsImage **out, int page, int n);
 int load_pdf_buffer(void *buf, size_t len, VipsImage **out, int page, int n, double dpi, double scale);
 int load_svg_buffer(void *buf, size_t len, VipsImage **out, double dpi, double scale, int unlimited);
-int load_heif_buffer(void *buf, size_t len, VipsImage **out, int page, int n, int thumbnail);
+int load_heif_buffer(void *buf, size_t len, VipsImage **out, int page, int n, int thumbnail, int autorotate);
 int load_magick_buffer(void *buf, size_t len, VipsImage **out, int page, int n, char *density);
+int load_hdr_buffer(void *buf, size_t len, VipsImage **out);
+int load_exr_file(const char *filename, VipsImage **out);
+int load_ppm_file(const char *filename, VipsImage **out);
+int load_buffer_with_loader(const char *loader, void *buf, size_t len, VipsImage **out);
 
 // TODO: Pass options as discrete params objects based on types rather than long function signatures
-int save_jpeg_buffer(VipsImage* image, void **buf, size_t *len, int strip, int quality, int interlace);
+int save_jpeg_buffer(VipsImage* image, void **buf, size_t *len, int strip, int quality, int interlace, double density, int unit);
 int save_png_buffer(VipsImage *in, void **buf, size_t *len, int strip, int compression, int interlace);
-int save_webp_buffer(VipsImage *in, void **buf, size_t *len, int strip, int quality, int lossless, int effort);
-int save_heif_buffer(VipsImage *in, void **buf, size_t *len, int quality, int lossless);
-int save_tiff_buffer(VipsImage *in, void **buf, size_t *len, int strip, int quality, int lossless);
+int save_webp_buffer(VipsImage *in, void **buf, size_t *len, int strip, int quality, int lossless, int effort, int preset, int near_lossless, int exact);
+int save_heif_buffer(VipsImage *in, void **buf, size_t *len, int quality, int lossless, int encoder, int subsample);
+int save_tiff_buffer(VipsImage *in, void **buf, size_t *len, int strip, int quality, int lossless, int compression, int bitdepth);
+int save_tiff_file(VipsImage *in, const char *filename, int strip, int quality, int lossless, int compression, int bitdepth);
+int save_ppm_file(VipsImage *in, const char *filename, int strip);
+int save_magick_buffer(VipsImage *in, void **buf, size_t *len, const char *format, int quality);
+
+int transcode_gif_to_webp(void *buf, size_t len, void **out, size_t *out_len, int strip, int quality, int lossless, int effort, int loop);
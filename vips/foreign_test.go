@@ -1,10 +1,18 @@
 package vips
 
 import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color/palette"
+	"image/gif"
 	"io/ioutil"
 	"testing"
+	"unicode/utf16"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/image/bmp"
 )
 
 func Test_DetermineImageType__JPEG(t *testing.T) {
@@ -95,6 +103,53 @@ func Test_DetermineImageType__SVG_1(t *testing.T) {
 	assert.Equal(t, ImageTypeSVG, imageType)
 }
 
+func Test_DetermineImageType__SVG_BOM(t *testing.T) {
+	buf, err := ioutil.ReadFile(resources + "svg.svg")
+	require.NoError(t, err)
+
+	utf8 := append([]byte("\xEF\xBB\xBF"), buf...)
+	assert.Equal(t, ImageTypeSVG, DetermineImageType(utf8))
+
+	doc := `<?xml version="1.0" encoding="UTF-16"?><svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 10"></svg>`
+	units := utf16.Encode([]rune(doc))
+
+	le := []byte("\xFF\xFE")
+	be := []byte("\xFE\xFF")
+	for _, unit := range units {
+		le = append(le, byte(unit), byte(unit>>8))
+		be = append(be, byte(unit>>8), byte(unit))
+	}
+	assert.Equal(t, ImageTypeSVG, DetermineImageType(le))
+	assert.Equal(t, ImageTypeSVG, DetermineImageType(be))
+	assert.Equal(t, ImageTypeSVG, DetermineImageType(le[2:]))
+}
+
+func Test_DetermineImageType__Magick(t *testing.T) {
+	flif := []byte("FLIF\x44\x11\x00\x00\x00\x00\x00\x00")
+	assert.Equal(t, ImageTypeMagick, DetermineImageType(flif))
+
+	// SOI, SOF55 for a 1x1 grey frame and the start of scan
+	jpegLS := []byte("\xFF\xD8\xFF\xF7\x00\x0B\x08\x00\x01\x00\x01\x01\x01\x11\x00" +
+		"\xFF\xDA\x00\x08\x01\x01\x00\x00\x00\x00")
+	assert.Equal(t, ImageTypeMagick, DetermineImageType(jpegLS))
+
+	buf, err := ioutil.ReadFile(resources + "jpg-24bit.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, ImageTypeJPEG, DetermineImageType(buf))
+}
+
+func Test_AvailableOutputFormats(t *testing.T) {
+	Startup(nil)
+
+	formats := AvailableOutputFormats(ImageTypePNG)
+	assert.Contains(t, formats, ImageTypeJPEG)
+	assert.Contains(t, formats, ImageTypePNG)
+	assert.NotContains(t, formats, ImageTypeSVG)
+	assert.NotContains(t, formats, ImageTypePDF)
+
+	assert.Empty(t, AvailableOutputFormats(ImageTypeUnknown))
+}
+
 func Test_DetermineImageType__PDF(t *testing.T) {
 	Startup(&Config{})
 
@@ -116,3 +171,323 @@ func Test_DetermineImageType__BMP(t *testing.T) {
 	imageType := DetermineImageType(buf)
 	assert.Equal(t, ImageTypeBMP, imageType)
 }
+
+func Test_DetermineImageType__HDR(t *testing.T) {
+	Startup(&Config{})
+
+	buf, err := ioutil.ReadFile(resources + "hdr.hdr")
+	assert.NoError(t, err)
+	assert.NotNil(t, buf)
+
+	imageType := DetermineImageType(buf)
+	assert.Equal(t, ImageTypeHDR, imageType)
+}
+
+func Test_DetermineImageType__EXR(t *testing.T) {
+	buf := append([]byte("\x76\x2F\x31\x01\x02\x00\x00\x00"), make([]byte, 8)...)
+
+	imageType := DetermineImageType(buf)
+	assert.Equal(t, ImageTypeEXR, imageType)
+}
+
+func Test_NegotiateFormat(t *testing.T) {
+	Startup(nil)
+
+	candidates := []ImageType{ImageTypeWEBP, ImageTypePNG, ImageTypeJPEG}
+
+	assert.Equal(t, ImageTypeWEBP, NegotiateFormat("image/avif,image/webp,image/apng,image/*,*/*;q=0.8", candidates))
+	assert.Equal(t, ImageTypePNG, NegotiateFormat("image/webp;q=0.5, image/png", candidates))
+	assert.Equal(t, ImageTypePNG, NegotiateFormat("image/webp;q=0,image/*", candidates))
+	assert.Equal(t, ImageTypeWEBP, NegotiateFormat("*/*", candidates))
+	assert.Equal(t, ImageTypeJPEG, NegotiateFormat("text/html", []ImageType{ImageTypeWEBP}))
+	assert.Equal(t, ImageTypeJPEG, NegotiateFormat("", candidates))
+}
+
+func Test_NegotiateFormat__HEIF(t *testing.T) {
+	Startup(nil)
+
+	if !IsTypeSupported(ImageTypeHEIF) {
+		t.Skip("HEIF is not supported")
+	}
+
+	candidates := []ImageType{ImageTypeHEIF, ImageTypeWEBP, ImageTypeJPEG}
+
+	assert.Equal(t, ImageTypeHEIF, NegotiateFormat("image/heic,image/webp;q=0.9,image/*;q=0.8", candidates))
+	assert.Equal(t, ImageTypeHEIF, NegotiateFormat("image/heif,image/jpeg;q=0.5", candidates))
+	assert.Equal(t, ImageTypeWEBP, NegotiateFormat("image/heic;q=0.5,image/webp", candidates))
+
+	// default HEIF export is HEVC, which a client only accepting AVIF cannot decode
+	assert.Equal(t, ImageTypeWEBP, NegotiateFormat("image/avif,image/webp;q=0.9", candidates))
+	assert.Equal(t, ImageTypeJPEG, NegotiateFormat("image/avif", candidates))
+}
+
+func Test_ImageType_MIME(t *testing.T) {
+	assert.Equal(t, "image/webp", ImageTypeWEBP.MIME())
+	assert.Equal(t, "image/jpeg", ImageTypeJPEG.MIME())
+	assert.Equal(t, "", ImageTypeUnknown.MIME())
+}
+
+func Test_DetermineFileExt(t *testing.T) {
+	heic, err := ioutil.ReadFile(resources + "heic-24bit-exif.heic")
+	require.NoError(t, err)
+	assert.Equal(t, ".heic", DetermineFileExt(heic))
+
+	mif1, err := ioutil.ReadFile(resources + "heic-24bit.heic")
+	require.NoError(t, err)
+	assert.Equal(t, ".heif", DetermineFileExt(mif1))
+
+	png, err := ioutil.ReadFile(resources + "png-8bit.png")
+	require.NoError(t, err)
+	assert.Equal(t, ".png", DetermineFileExt(png))
+
+	assert.Equal(t, "", DetermineFileExt([]byte("not an image")))
+}
+
+func Test_BMP_OS2Header(t *testing.T) {
+	Startup(nil)
+
+	// 1x1 24-bit BMP with a 12 byte OS/2 BITMAPCOREHEADER
+	buf := []byte{
+		'B', 'M', 30, 0, 0, 0, 0, 0, 0, 0, 26, 0, 0, 0,
+		12, 0, 0, 0, 1, 0, 1, 0, 1, 0, 24, 0,
+		0, 0, 255, 0,
+	}
+
+	assert.Equal(t, ImageTypeBMP, DetermineImageType(buf))
+	assert.Equal(t, 12, bmpHeaderSize(buf))
+
+	_, err := bmpToPNG(buf)
+	assert.Equal(t, bmp.ErrUnsupported, err)
+
+	img, err := NewImageFromBuffer(buf)
+	if !IsTypeSupported(ImageTypeMagick) {
+		assert.Error(t, err)
+		return
+	}
+
+	require.NoError(t, err)
+	assert.Equal(t, ImageTypeMagick, img.Format())
+	assert.Equal(t, 1, img.Width())
+}
+
+func Test_BMP_DirectImport(t *testing.T) {
+	Startup(nil)
+
+	buf, err := ioutil.ReadFile(resources + "bmp.bmp")
+	require.NoError(t, err)
+
+	bridged, err := NewImageFromBuffer(buf)
+	require.NoError(t, err)
+	assert.Equal(t, ImageTypePNG, bridged.Format())
+
+	direct, err := NewImageFromBuffer(buf, DirectBMPImportOption(true))
+	require.NoError(t, err)
+	assert.Equal(t, bridged.Width(), direct.Width())
+	assert.Equal(t, bridged.Height(), direct.Height())
+
+	if IsTypeSupported(ImageTypeMagick) {
+		assert.Equal(t, ImageTypeMagick, direct.Format())
+	} else {
+		assert.Equal(t, ImageTypePNG, direct.Format())
+	}
+}
+
+func Test_SetBMPConversion(t *testing.T) {
+	Startup(nil)
+
+	buf, err := ioutil.ReadFile(resources + "bmp.bmp")
+	require.NoError(t, err)
+
+	SetBMPConversion(false)
+	defer SetBMPConversion(true)
+
+	_, err = NewImageFromBuffer(buf)
+	assert.Equal(t, ErrUnsupportedImageFormat, err)
+
+	direct, err := NewImageFromBuffer(buf, DirectBMPImportOption(true))
+	if IsTypeSupported(ImageTypeMagick) {
+		require.NoError(t, err)
+		assert.Equal(t, ImageTypeMagick, direct.Format())
+	} else {
+		assert.Equal(t, ErrUnsupportedImageFormat, err)
+	}
+
+	SetBMPConversion(true)
+
+	img, err := NewImageFromBuffer(buf)
+	require.NoError(t, err)
+	assert.Equal(t, ImageTypePNG, img.Format())
+}
+
+// qoiTestImage is a 3x2 RGBA QOI image using every op
+var qoiTestImage = []byte{
+	'q', 'o', 'i', 'f', 0, 0, 0, 3, 0, 0, 0, 2, 4, 0,
+	0xff, 255, 0, 0, 128, // rgba
+	0xc0,            // run of 1
+	0xfe, 0, 0, 255, // rgb
+	0x79,       // diff of 1, 0, -1
+	0x3d,       // index of the first pixel
+	0xa2, 0x88, // luma of 2, 2, 2
+	0, 0, 0, 0, 0, 0, 0, 1,
+}
+
+func Test_DecodeQOI(t *testing.T) {
+	pixels, width, height, channels, err := decodeQOI(qoiTestImage, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 3, width)
+	assert.Equal(t, 2, height)
+	assert.Equal(t, 4, channels)
+	assert.Equal(t, []byte{
+		255, 0, 0, 128, 255, 0, 0, 128, 0, 0, 255, 128,
+		1, 0, 254, 128, 255, 0, 0, 128, 1, 2, 2, 128,
+	}, pixels)
+
+	_, _, _, _, err = decodeQOI(qoiTestImage[:20], 0)
+	assert.Equal(t, errInvalidQOI, err)
+
+	huge := append([]byte(nil), qoiTestImage...)
+	huge[4] = 0xff
+	_, _, _, _, err = decodeQOI(huge, 0)
+	assert.Equal(t, errInvalidQOI, err)
+
+	_, _, _, _, err = decodeQOI(qoiTestImage, 5)
+	assert.True(t, errors.Is(err, ErrMaxRasterPixelsExceeded))
+	_, _, _, _, err = decodeQOI(qoiTestImage, 6)
+	assert.NoError(t, err)
+
+	// the limit is checked before the pixels are allocated
+	large := append([]byte(nil), qoiTestImage...)
+	copy(large[4:12], []byte{0, 0, 0x27, 0x10, 0, 0, 0x27, 0x11})
+	_, _, _, _, err = decodeQOI(large, defaultMaxRasterPixels)
+	assert.True(t, errors.Is(err, ErrMaxRasterPixelsExceeded))
+}
+
+func Test_QOI(t *testing.T) {
+	Startup(nil)
+
+	assert.Equal(t, ImageTypeQOI, DetermineImageType(qoiTestImage))
+	assert.True(t, IsTypeSupported(ImageTypeQOI))
+
+	img, err := NewImageFromBuffer(qoiTestImage)
+	require.NoError(t, err)
+	assert.Equal(t, ImageTypeQOI, img.Format())
+	assert.Equal(t, 3, img.Width())
+	assert.Equal(t, 2, img.Height())
+	assert.Equal(t, 4, img.Bands())
+
+	out, metadata, err := img.Export(nil)
+	require.NoError(t, err)
+	assert.Equal(t, ImageTypePNG, metadata.Format)
+	assert.Equal(t, ImageTypePNG, DetermineImageType(out))
+
+	_, err = NewImageFromBuffer(qoiTestImage, MaxRasterPixelsImportOption(5))
+	assert.True(t, errors.Is(err, ErrMaxRasterPixelsExceeded))
+}
+
+func Test_PNM(t *testing.T) {
+	Startup(nil)
+
+	buf := append([]byte("P6\n2 1\n255\n"), 255, 0, 0, 0, 0, 255)
+	assert.Equal(t, ImageTypePNM, DetermineImageType(buf))
+	assert.Equal(t, ImageTypeUnknown, DetermineImageType([]byte("PK\x03\x04")))
+
+	if !IsTypeSupported(ImageTypePNM) {
+		t.Skip("libvips was built without PNM support")
+	}
+
+	img, err := NewImageFromBuffer(buf)
+	require.NoError(t, err)
+	assert.Equal(t, ImageTypePNM, img.Format())
+	assert.Equal(t, 2, img.Width())
+	assert.Equal(t, 3, img.Bands())
+
+	out, _, err := img.Export(&ExportParams{Format: ImageTypePNM})
+	require.NoError(t, err)
+	assert.Equal(t, ImageTypePNM, DetermineImageType(out))
+	assert.Equal(t, "P6", string(out[:2]))
+}
+
+func Test_LoaderImportOption(t *testing.T) {
+	Startup(nil)
+
+	buf, err := ioutil.ReadFile(resources + "png-24bit.png")
+	require.NoError(t, err)
+
+	img, err := NewImageFromBuffer(buf, LoaderImportOption("pngload_buffer"))
+	require.NoError(t, err)
+	assert.Equal(t, ImageTypePNG, img.Format())
+	assert.Equal(t, 1920, img.Width())
+
+	_, err = NewImageFromBuffer(buf, LoaderImportOption("jpegload_buffer"))
+	assert.Error(t, err)
+
+	_, err = NewImageFromBuffer(buf, LoaderImportOption("jpegsave_buffer"))
+	assert.Error(t, err)
+
+	_, err = NewImageFromBuffer(buf, LoaderImportOption("nosuchload_buffer"))
+	assert.Error(t, err)
+
+	if IsTypeSupported(ImageTypeMagick) {
+		img, err = NewImageFromBuffer(buf, LoaderImportOption("magickload_buffer"))
+		require.NoError(t, err)
+		assert.Equal(t, ImageTypeMagick, img.Format())
+	}
+}
+
+func Test_IsComplete(t *testing.T) {
+	for _, file := range []string{"png-24bit.png", "jpg-24bit.jpg", "webp+alpha.webp", "tif.tif"} {
+		buf, err := ioutil.ReadFile(resources + file)
+		require.NoError(t, err)
+
+		assert.True(t, IsComplete(buf), file)
+		if DetermineImageType(buf) != ImageTypeTIFF {
+			assert.False(t, IsComplete(buf[:len(buf)-10]), file)
+		}
+	}
+
+	anim := &gif.GIF{Image: []*image.Paletted{image.NewPaletted(image.Rect(0, 0, 4, 4), palette.Plan9)}, Delay: []int{0}}
+	var buf bytes.Buffer
+	require.NoError(t, gif.EncodeAll(&buf, anim))
+	assert.True(t, IsComplete(buf.Bytes()))
+	assert.False(t, IsComplete(buf.Bytes()[:buf.Len()-1]))
+
+	assert.False(t, IsComplete([]byte("not an image at all")))
+}
+
+func Test_PassthroughError(t *testing.T) {
+	buf := []byte("not really an image")
+	var err error = &PassthroughError{Buf: buf, ImageType: ImageTypeHEIF}
+
+	assert.True(t, errors.Is(err, ErrPassthrough))
+
+	var passthrough *PassthroughError
+	require.True(t, errors.As(err, &passthrough))
+	assert.Equal(t, buf, passthrough.Buf)
+	assert.Equal(t, ImageTypeHEIF, passthrough.ImageType)
+}
+
+func Test_NewImageFromBuffer__Passthrough(t *testing.T) {
+	Startup(nil)
+
+	buf, err := ioutil.ReadFile(resources + "heic-24bit.heic")
+	require.NoError(t, err)
+	require.Equal(t, ImageTypeHEIF, DetermineImageType(buf))
+
+	// pretend this host lacks libheif, so the buffer is detected but cannot be loaded
+	supported := supportedImageTypes[ImageTypeHEIF]
+	supportedImageTypes[ImageTypeHEIF] = false
+	defer func() { supportedImageTypes[ImageTypeHEIF] = supported }()
+
+	img, err := NewImageFromBuffer(buf, PassthroughImportOption(true))
+	require.Error(t, err)
+	assert.Nil(t, img)
+	assert.True(t, errors.Is(err, ErrPassthrough))
+
+	var passthrough *PassthroughError
+	require.True(t, errors.As(err, &passthrough))
+	assert.Equal(t, buf, passthrough.Buf)
+	assert.Equal(t, ImageTypeHEIF, passthrough.ImageType)
+
+	_, err = NewImageFromBuffer(buf)
+	assert.Equal(t, ErrUnsupportedImageFormat, err)
+}
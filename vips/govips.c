@@ -29,4 +29,20 @@ void vips_unset_logging_handler(void)
 void vips_default_logging_handler(void)
 {
   g_log_set_default_handler(g_log_default_handler, NULL);
-}
\ No newline at end of file
+}
+/* Checks whether an operation has the given option, e.g. for options which were added in later
+   libvips versions. */
+int has_operation_property(const char *operation, const char *property)
+{
+  GType type = vips_type_find("VipsOperation", operation);
+  if (!type)
+  {
+    return 0;
+  }
+
+  gpointer class = g_type_class_ref(type);
+  int found = g_object_class_find_property(G_OBJECT_CLASS(class), property) != NULL;
+  g_type_class_unref(class);
+
+  return found;
+}
@@ -192,6 +192,18 @@ func Shutdown() {
 	running = false
 }
 
+// SetVectorEnabled toggles the SIMD vectorisation libvips uses to accelerate operations such as convolution
+// and resizing on capable CPUs. It is enabled by default. libvips has no OpenCL or GPU backend, so this is
+// the only hardware acceleration which can be toggled at runtime.
+func SetVectorEnabled(enabled bool) {
+	C.vips_vector_set_enabled(toGboolean(enabled))
+}
+
+// IsVectorEnabled reports whether libvips uses SIMD vectorisation.
+func IsVectorEnabled() bool {
+	return fromGboolean(C.vips_vector_isenabled())
+}
+
 // ShutdownThread clears the cache for for the given thread. This needs to be
 // called when a thread using vips exits.
 func ShutdownThread() {
@@ -238,6 +250,28 @@ func startupIfNeeded() {
 	}
 }
 
+// hasOperation checks whether libvips provides the operation with the given nickname, e.g. "magicksave_buffer"
+func hasOperation(name string) bool {
+	cType := C.CString("VipsOperation")
+	defer freeCString(cType)
+
+	cName := C.CString(name)
+	defer freeCString(cName)
+
+	return int(C.vips_type_find(cType, cName)) != 0
+}
+
+// hasOperationProperty checks whether the libvips operation supports the given option, e.g. "exact" for "webpsave_buffer"
+func hasOperationProperty(name, property string) bool {
+	cName := C.CString(name)
+	defer freeCString(cName)
+
+	cProperty := C.CString(property)
+	defer freeCString(cProperty)
+
+	return int(C.has_operation_property(cName, cProperty)) != 0
+}
+
 // InitTypes initializes caches and figures out which image types are supported
 func initTypes() {
 	once.Do(func() {
@@ -245,6 +279,10 @@ func initTypes() {
 		defer freeCString(cType)
 
 		for k, v := range ImageTypes {
+			if loader, ok := imageTypeLoaders[k]; ok {
+				v = loader
+			}
+
 			name := strings.ToLower("VipsForeignLoad" + v)
 			typeLoaders[name] = k
 			typeLoaders[name+"buffer"] = k
@@ -261,5 +299,8 @@ func initTypes() {
 				govipsLog("govips", LogLevelInfo, fmt.Sprintf("registered image type loader type=%s", v))
 			}
 		}
+
+		// QOI is decoded by govips itself
+		supportedImageTypes[ImageTypeQOI] = true
 	})
 }
@@ -19,4 +19,5 @@ static void null_logging_handler(
 
 void vips_set_logging_handler(void);
 void vips_unset_logging_handler(void);
-void vips_default_logging_handler(void);
\ No newline at end of file
+void vips_default_logging_handler(void);
+int has_operation_property(const char *operation, const char *property);
\ No newline at end of file
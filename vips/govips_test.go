@@ -2,6 +2,9 @@ package vips
 
 import (
 	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestInitConfig(t *testing.T) {
@@ -10,3 +13,17 @@ func TestInitConfig(t *testing.T) {
 	running = false
 	startupIfNeeded()
 }
+
+func TestSetVectorEnabled(t *testing.T) {
+	Startup(nil)
+
+	enabled := IsVectorEnabled()
+	defer SetVectorEnabled(enabled)
+
+	SetVectorEnabled(false)
+	assert.False(t, IsVectorEnabled())
+
+	img, err := NewImageFromFile(resources + "png-8bit.png")
+	require.NoError(t, err)
+	require.NoError(t, img.Resize(0.5, KernelLanczos3))
+}
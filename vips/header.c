@@ -9,10 +9,31 @@ gboolean remove_icc_profile(VipsImage *in) {
     return vips_image_remove(in, VIPS_META_ICC_NAME);
 }
 
+int get_icc_profile(VipsImage *in, const void **data, size_t *length) {
+	*length = 0;
+	if (vips_image_get_typeof(in, VIPS_META_ICC_NAME) == 0) {
+		return 0;
+	}
+
+	return vips_image_get_blob(in, VIPS_META_ICC_NAME, data, length);
+}
+
+void set_icc_profile(VipsImage *in, const void *data, size_t length) {
+	vips_image_set_blob_copy(in, VIPS_META_ICC_NAME, data, length);
+}
+
 unsigned long has_iptc(VipsImage *in) {
     return vips_image_get_typeof(in, VIPS_META_IPTC_NAME);
 }
 
+unsigned long has_field(VipsImage *in, const char *name) {
+	return vips_image_get_typeof(in, name);
+}
+
+int remove_field(VipsImage *in, const char *name) {
+	return vips_image_remove(in, name);
+}
+
 // won't remove the ICC profile and orientation
 void remove_metadata(VipsImage *in) {
     gchar ** fields = vips_image_get_fields(in);
@@ -29,6 +50,35 @@ void remove_metadata(VipsImage *in) {
     g_strfreev(fields);
 }
 
+// removes blob and string fields (e.g. XMP, EXIF, ICC profile) larger than max_bytes
+void remove_metadata_larger_than(VipsImage *in, size_t max_bytes) {
+    gchar ** fields = vips_image_get_fields(in);
+
+    for (int i=0; fields[i] != NULL; i++) {
+        GType type = vips_image_get_typeof(in, fields[i]);
+        size_t length = 0;
+
+        if (type == VIPS_TYPE_BLOB) {
+            const void *data;
+            if (vips_image_get_blob(in, fields[i], &data, &length)) {
+                continue;
+            }
+        } else if (type == G_TYPE_STRING) {
+            const char *str;
+            if (vips_image_get_string(in, fields[i], &str)) {
+                continue;
+            }
+            length = strlen(str);
+        }
+
+        if (length > max_bytes) {
+            vips_image_remove(in, fields[i]);
+        }
+    }
+
+    g_strfreev(fields);
+}
+
 int get_meta_orientation(VipsImage *in) {
 	int orientation = 0;
 	if (vips_image_get_typeof(in, VIPS_META_ORIENTATION) != 0) {
@@ -45,3 +95,143 @@ void remove_meta_orientation(VipsImage *in) {
 void set_meta_orientation(VipsImage *in, int orientation) {
 	vips_image_set_int(in, VIPS_META_ORIENTATION, orientation);
 }
+
+int get_page_height(VipsImage *in) {
+	return vips_image_get_page_height(in);
+}
+
+void set_page_height(VipsImage *in, int height) {
+	vips_image_set_int(in, VIPS_META_PAGE_HEIGHT, height);
+}
+
+int get_meta_delay(VipsImage *in, int **delay, int *n) {
+	*n = 0;
+	if (vips_image_get_typeof(in, "delay") == 0) {
+		return 0;
+	}
+
+	return vips_image_get_array_int(in, "delay", delay, n);
+}
+
+// keeps the page count and delays of the first n frames, e.g. after cutting an animation strip short
+void truncate_meta_frames(VipsImage *in, int n) {
+	int *delay;
+	int n_delay;
+
+	vips_image_set_int(in, VIPS_META_N_PAGES, n);
+
+	if (get_meta_delay(in, &delay, &n_delay) == 0 && n_delay > n) {
+		vips_image_set_array_int(in, "delay", delay, n);
+	}
+}
+
+// libvips before 8.12 reads the loop count from "gif-loop", later versions from "loop"
+void set_meta_loop(VipsImage *in, int loop) {
+	vips_image_set_int(in, "loop", loop);
+	vips_image_set_int(in, "gif-loop", loop);
+}
+
+// the background color of animated WebP images from the ANIM chunk as r, g, b, a
+int get_meta_webp_background(VipsImage *in, int **background, int *n) {
+	*n = 0;
+	if (vips_image_get_typeof(in, "webp-background") == 0) {
+		return 0;
+	}
+
+	return vips_image_get_array_int(in, "webp-background", background, n);
+}
+
+void set_meta_webp_background(VipsImage *in, int *background, int n) {
+	vips_image_set_array_int(in, "webp-background", background, n);
+}
+
+int get_meta_exif(VipsImage *in, const void **data, size_t *length) {
+	*length = 0;
+	if (vips_image_get_typeof(in, VIPS_META_EXIF_NAME) == 0) {
+		return 0;
+	}
+
+	return vips_image_get_blob(in, VIPS_META_EXIF_NAME, data, length);
+}
+
+void set_meta_exif(VipsImage *in, const void *data, size_t length) {
+	vips_image_set_blob_copy(in, VIPS_META_EXIF_NAME, data, length);
+}
+
+// libvips writes the parsed exif-ifd1-* fields back into the EXIF data on save, remove them with the thumbnail
+void remove_meta_exif_ifd1(VipsImage *in) {
+	gchar ** fields = vips_image_get_fields(in);
+
+	for (int i=0; fields[i] != NULL; i++) {
+		if (vips_isprefix("exif-ifd1-", fields[i])) {
+			vips_image_remove(in, fields[i]);
+		}
+	}
+
+	g_strfreev(fields);
+}
+
+// the JPEG loader stores every COM marker as jpeg-comment-0, jpeg-comment-1, ... and the saver writes them back
+int get_meta_jpeg_comment(VipsImage *in, const char **comment) {
+	if (vips_image_get_typeof(in, "jpeg-comment-0") == 0) {
+		return 1;
+	}
+
+	return vips_image_get_string(in, "jpeg-comment-0", comment);
+}
+
+void set_meta_jpeg_comment(VipsImage *in, const char *comment) {
+	gchar ** fields = vips_image_get_fields(in);
+
+	for (int i=0; fields[i] != NULL; i++) {
+		if (vips_isprefix("jpeg-comment-", fields[i])) {
+			vips_image_remove(in, fields[i]);
+		}
+	}
+
+	g_strfreev(fields);
+
+	if (comment[0] != '\0') {
+		vips_image_set_string(in, "jpeg-comment-0", comment);
+	}
+}
+
+// libvips keeps PNG tEXt, zTXt and iTXt chunks as png-comment-N-KEY fields and writes them back on save.
+// returns the n names of these fields, free with g_strfreev
+gchar **get_meta_png_text_fields(VipsImage *in, int *n) {
+	gchar ** fields = vips_image_get_fields(in);
+	*n = 0;
+
+	for (int i=0; fields[i] != NULL; i++) {
+		if (vips_isprefix("png-comment-", fields[i])) {
+			fields[(*n)++] = fields[i];
+		} else {
+			g_free(fields[i]);
+		}
+	}
+	fields[*n] = NULL;
+
+	return fields;
+}
+
+int get_meta_string(VipsImage *in, const char *name, const char **value) {
+	return vips_image_get_string(in, name, value);
+}
+
+void remove_meta_png_text(VipsImage *in) {
+	int n;
+	gchar ** fields = get_meta_png_text_fields(in, &n);
+
+	for (int i=0; fields[i] != NULL; i++) {
+		vips_image_remove(in, fields[i]);
+	}
+
+	g_strfreev(fields);
+}
+
+void set_meta_png_text(VipsImage *in, int index, const char *key, const char *value) {
+	char name[256];
+
+	vips_snprintf(name, sizeof(name), "png-comment-%d-%s", index, key);
+	vips_image_set_string(in, name, value);
+}
@@ -4,6 +4,12 @@ package vips
 // #include "header.h"
 import "C"
 
+import (
+	"sort"
+	"strings"
+	"unsafe"
+)
+
 func vipsHasICCProfile(in *C.VipsImage) bool {
 	return int(C.has_icc_profile(in)) != 0
 }
@@ -12,6 +18,44 @@ func vipsRemoveICCProfile(in *C.VipsImage) bool {
 	return fromGboolean(C.remove_icc_profile(in))
 }
 
+func vipsHasField(in *C.VipsImage, name string) bool {
+	cName := C.CString(name)
+	defer freeCString(cName)
+
+	return int(C.has_field(in, cName)) != 0
+}
+
+func vipsRemoveField(in *C.VipsImage, name string) bool {
+	cName := C.CString(name)
+	defer freeCString(cName)
+
+	return fromGboolean(C.remove_field(in, cName))
+}
+
+// vipsGetICCProfile returns a copy of the embedded ICC profile
+func vipsGetICCProfile(in *C.VipsImage) ([]byte, bool) {
+	var data unsafe.Pointer
+	var length C.size_t
+
+	if err := C.get_icc_profile(in, &data, &length); err != 0 || length == 0 {
+		return nil, false
+	}
+
+	return C.GoBytes(data, C.int(length)), true
+}
+
+// vipsSetICCRenderingIntent sets the rendering intent of the embedded ICC profile, images without one are left as is
+func vipsSetICCRenderingIntent(in *C.VipsImage, intent RenderingIntent) {
+	profile, ok := vipsGetICCProfile(in)
+	if !ok {
+		return
+	}
+
+	if profile, ok = setICCRenderingIntent(profile, intent); ok {
+		C.set_icc_profile(in, unsafe.Pointer(&profile[0]), C.size_t(len(profile)))
+	}
+}
+
 func vipsHasIPTC(in *C.VipsImage) bool {
 	return int(C.has_iptc(in)) != 0
 }
@@ -20,6 +64,10 @@ func vipsRemoveMetadata(in *C.VipsImage) {
 	C.remove_metadata(in)
 }
 
+func vipsRemoveMetadataLargerThan(in *C.VipsImage, maxBytes int) {
+	C.remove_metadata_larger_than(in, C.size_t(maxBytes))
+}
+
 func vipsGetMetaOrientation(in *C.VipsImage) int {
 	return int(C.get_meta_orientation(in))
 }
@@ -31,3 +79,133 @@ func vipsRemoveMetaOrientation(in *C.VipsImage) {
 func vipsSetMetaOrientation(in *C.VipsImage, orientation int) {
 	C.set_meta_orientation(in, C.int(orientation))
 }
+
+func vipsGetPageHeight(in *C.VipsImage) int {
+	return int(C.get_page_height(in))
+}
+
+func vipsSetPageHeight(in *C.VipsImage, height int) {
+	C.set_page_height(in, C.int(height))
+}
+
+func vipsGetMetaDelay(in *C.VipsImage) []int {
+	var cDelay *C.int
+	var n C.int
+
+	if err := C.get_meta_delay(in, &cDelay, &n); err != 0 || n == 0 {
+		return nil
+	}
+
+	cDelays := (*[1 << 28]C.int)(unsafe.Pointer(cDelay))[:n:n]
+	delays := make([]int, len(cDelays))
+	for i, d := range cDelays {
+		delays[i] = int(d)
+	}
+
+	return delays
+}
+
+func vipsTruncateMetaFrames(in *C.VipsImage, n int) {
+	C.truncate_meta_frames(in, C.int(n))
+}
+
+func vipsSetMetaLoop(in *C.VipsImage, loop int) {
+	C.set_meta_loop(in, C.int(loop))
+}
+
+func vipsGetMetaWebPBackground(in *C.VipsImage) (ColorRGBA, bool) {
+	var cBackground *C.int
+	var n C.int
+
+	if err := C.get_meta_webp_background(in, &cBackground, &n); err != 0 || n != 4 {
+		return ColorRGBA{}, false
+	}
+
+	b := (*[4]C.int)(unsafe.Pointer(cBackground))
+	return ColorRGBA{R: uint8(b[0]), G: uint8(b[1]), B: uint8(b[2]), A: uint8(b[3])}, true
+}
+
+func vipsSetMetaWebPBackground(in *C.VipsImage, color ColorRGBA) {
+	background := [4]C.int{C.int(color.R), C.int(color.G), C.int(color.B), C.int(color.A)}
+	C.set_meta_webp_background(in, &background[0], 4)
+}
+
+// vipsRemoveEXIFThumbnail removes the embedded thumbnail from the EXIF data of the image, keeping other EXIF fields
+func vipsRemoveEXIFThumbnail(in *C.VipsImage) {
+	var data unsafe.Pointer
+	var length C.size_t
+
+	if err := C.get_meta_exif(in, &data, &length); err != 0 || length == 0 {
+		return
+	}
+
+	exif, ok := removeEXIFThumbnail(C.GoBytes(data, C.int(length)))
+	if !ok {
+		return
+	}
+
+	C.set_meta_exif(in, unsafe.Pointer(&exif[0]), C.size_t(len(exif)))
+	C.remove_meta_exif_ifd1(in)
+}
+
+func vipsGetMetaJPEGComment(in *C.VipsImage) (string, bool) {
+	var comment *C.char
+
+	if err := C.get_meta_jpeg_comment(in, &comment); err != 0 {
+		return "", false
+	}
+
+	return C.GoString(comment), true
+}
+
+// vipsSetMetaJPEGComment replaces all JPEG comments of the image, an empty comment removes them
+func vipsSetMetaJPEGComment(in *C.VipsImage, comment string) {
+	cComment := C.CString(comment)
+	defer freeCString(cComment)
+
+	C.set_meta_jpeg_comment(in, cComment)
+}
+
+// pngTextPrefix is the prefix of the png-comment-N-KEY fields libvips stores PNG text chunks in
+const pngTextPrefix = "png-comment-"
+
+func vipsGetMetaPNGText(in *C.VipsImage) map[string]string {
+	var n C.int
+	fields := C.get_meta_png_text_fields(in, &n)
+	defer C.g_strfreev(fields)
+
+	text := make(map[string]string)
+	for _, field := range (*[1 << 20]*C.char)(unsafe.Pointer(fields))[:n:n] {
+		var value *C.char
+		if err := C.get_meta_string(in, field, &value); err != 0 {
+			continue
+		}
+
+		// skip the index, which only keeps the fields of repeated keys apart
+		name := strings.TrimPrefix(C.GoString(field), pngTextPrefix)
+		if i := strings.IndexByte(name, '-'); i >= 0 {
+			text[name[i+1:]] = C.GoString(value)
+		}
+	}
+
+	return text
+}
+
+// vipsSetMetaPNGText replaces the PNG text chunks of the image, in the order of the sorted keys
+func vipsSetMetaPNGText(in *C.VipsImage, text map[string]string) {
+	C.remove_meta_png_text(in)
+
+	keys := make([]string, 0, len(text))
+	for key := range text {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for i, key := range keys {
+		cKey := C.CString(key)
+		cValue := C.CString(text[key])
+		C.set_meta_png_text(in, C.int(i), cKey, cValue)
+		freeCString(cKey)
+		freeCString(cValue)
+	}
+}
@@ -6,12 +6,39 @@
 
 unsigned long has_icc_profile(VipsImage *in);
 int remove_icc_profile(VipsImage *in);
+int get_icc_profile(VipsImage *in, const void **data, size_t *length);
+void set_icc_profile(VipsImage *in, const void *data, size_t length);
 
 unsigned long has_iptc(VipsImage *in);
 
+unsigned long has_field(VipsImage *in, const char *name);
+int remove_field(VipsImage *in, const char *name);
+
 // won't remove the ICC profile
 void remove_metadata(VipsImage *in);
+void remove_metadata_larger_than(VipsImage *in, size_t max_bytes);
 
 int get_meta_orientation(VipsImage *in);
 void remove_meta_orientation(VipsImage *in);
 void set_meta_orientation(VipsImage *in, int orientation);
+
+int get_page_height(VipsImage *in);
+void set_page_height(VipsImage *in, int height);
+int get_meta_delay(VipsImage *in, int **delay, int *n);
+void truncate_meta_frames(VipsImage *in, int n);
+void set_meta_loop(VipsImage *in, int loop);
+
+int get_meta_webp_background(VipsImage *in, int **background, int *n);
+void set_meta_webp_background(VipsImage *in, int *background, int n);
+
+int get_meta_exif(VipsImage *in, const void **data, size_t *length);
+void set_meta_exif(VipsImage *in, const void *data, size_t length);
+void remove_meta_exif_ifd1(VipsImage *in);
+
+int get_meta_jpeg_comment(VipsImage *in, const char **comment);
+void set_meta_jpeg_comment(VipsImage *in, const char *comment);
+
+gchar **get_meta_png_text_fields(VipsImage *in, int *n);
+int get_meta_string(VipsImage *in, const char *name, const char **value);
+void remove_meta_png_text(VipsImage *in);
+void set_meta_png_text(VipsImage *in, int index, const char *key, const char *value);
@@ -0,0 +1,58 @@
+#include "histogram.h"
+
+// stretches the levels so that low_percent of the pixels are black and high_percent are white.
+// The levels are measured on the luminance and applied to all color bands, alpha is left unchanged.
+int auto_levels(VipsImage *in, VipsImage **out, double low_percent, double high_percent) {
+	VipsImage *base = vips_image_new();
+	VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 8);
+
+	int bands = vips_image_hasalpha(in) ? in->Bands - 1 : in->Bands;
+	double max = vips_interpretation_max_alpha(in->Type);
+	int low, high;
+
+	if (
+		vips_extract_band(in, &t[0], 0, "n", bands, NULL) ||
+		vips_colourspace(t[0], &t[1], bands >= 3 ? VIPS_INTERPRETATION_B_W : t[0]->Type, NULL) ||
+		vips_percent(t[1], low_percent, &low, NULL) ||
+		vips_percent(t[1], 100.0 - high_percent, &high, NULL)
+		) {
+		g_object_unref(base);
+		return 1;
+	}
+
+	if (high <= low) {
+		g_object_unref(base);
+		return vips_copy(in, out, NULL);
+	}
+
+	double scale = max / (high - low);
+
+	if (
+		vips_linear1(t[0], &t[2], scale, -low * scale, NULL) ||
+		vips_cast(t[2], &t[3], in->BandFmt, NULL)
+		) {
+		g_object_unref(base);
+		return 1;
+	}
+
+	if (bands < in->Bands) {
+		if (
+			vips_extract_band(in, &t[4], bands, "n", in->Bands - bands, NULL) ||
+			vips_bandjoin2(t[3], t[4], &t[5], NULL)
+			) {
+			g_object_unref(base);
+			return 1;
+		}
+	} else {
+		t[5] = t[3];
+		g_object_ref(t[5]);
+	}
+
+	if (vips_copy(t[5], out, "interpretation", in->Type, NULL)) {
+		g_object_unref(base);
+		return 1;
+	}
+
+	g_object_unref(base);
+	return 0;
+}
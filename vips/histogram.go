@@ -0,0 +1,17 @@
+package vips
+
+// #cgo pkg-config: vips
+// #include "histogram.h"
+import "C"
+
+// https://libvips.github.io/libvips/API/current/libvips-histogram.html#vips-percent
+func vipsAutoLevels(in *C.VipsImage, lowPercent, highPercent float64) (*C.VipsImage, error) {
+	incOpCounter("auto_levels")
+	var out *C.VipsImage
+
+	if err := C.auto_levels(in, &out, C.double(lowPercent), C.double(highPercent)); err != 0 {
+		return nil, handleImageError(out)
+	}
+
+	return out, nil
+}
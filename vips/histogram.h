@@ -0,0 +1,7 @@
+// https://libvips.github.io/libvips/API/current/libvips-histogram.html
+
+#include <stdlib.h>
+#include <vips/vips.h>
+
+
+int auto_levels(VipsImage *in, VipsImage **out, double low_percent, double high_percent);
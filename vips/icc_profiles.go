@@ -3,7 +3,10 @@ package vips
 import (
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 )
 
 // ATTRIBUTION:
@@ -651,10 +654,109 @@ var genericGrayGamma22ICCProfile = []byte{
 
 const genericGrayGamma22ICCProfileLength = 3588
 
+// The following micro icc profiles are matrix/TRC profiles computed from the published primaries of Display P3
+// (sRGB transfer curve) and of Adobe RGB (1998) (gamma 563/256), both with a D65 white point adapted to D50 with
+// Bradford, in the layout of the Compact-ICC-Profiles above. They are released under CC0.
+var displayP3V2MicroICCProfile = []byte{
+	0x00, 0x00, 0x02, 0x14, 0x00, 0x00, 0x00, 0x00, 0x02, 0x10, 0x00, 0x00,
+	0x6d, 0x6e, 0x74, 0x72, 0x52, 0x47, 0x42, 0x20, 0x58, 0x59, 0x5a, 0x20,
+	0x07, 0xea, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x61, 0x63, 0x73, 0x70, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xf6, 0xd6,
+	0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0xd3, 0x2d, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x09,
+	0x64, 0x65, 0x73, 0x63, 0x00, 0x00, 0x00, 0xf0, 0x00, 0x00, 0x00, 0x65,
+	0x63, 0x70, 0x72, 0x74, 0x00, 0x00, 0x01, 0x58, 0x00, 0x00, 0x00, 0x0c,
+	0x77, 0x74, 0x70, 0x74, 0x00, 0x00, 0x01, 0x64, 0x00, 0x00, 0x00, 0x14,
+	0x72, 0x58, 0x59, 0x5a, 0x00, 0x00, 0x01, 0x78, 0x00, 0x00, 0x00, 0x14,
+	0x67, 0x58, 0x59, 0x5a, 0x00, 0x00, 0x01, 0x8c, 0x00, 0x00, 0x00, 0x14,
+	0x62, 0x58, 0x59, 0x5a, 0x00, 0x00, 0x01, 0xa0, 0x00, 0x00, 0x00, 0x14,
+	0x72, 0x54, 0x52, 0x43, 0x00, 0x00, 0x01, 0xb4, 0x00, 0x00, 0x00, 0x60,
+	0x67, 0x54, 0x52, 0x43, 0x00, 0x00, 0x01, 0xb4, 0x00, 0x00, 0x00, 0x60,
+	0x62, 0x54, 0x52, 0x43, 0x00, 0x00, 0x01, 0xb4, 0x00, 0x00, 0x00, 0x60,
+	0x64, 0x65, 0x73, 0x63, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x0b,
+	0x44, 0x69, 0x73, 0x70, 0x6c, 0x61, 0x79, 0x20, 0x50, 0x33, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x74, 0x65, 0x78, 0x74,
+	0x00, 0x00, 0x00, 0x00, 0x43, 0x43, 0x30, 0x00, 0x58, 0x59, 0x5a, 0x20,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xf6, 0xd6, 0x00, 0x01, 0x00, 0x00,
+	0x00, 0x00, 0xd3, 0x2d, 0x58, 0x59, 0x5a, 0x20, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x83, 0xdf, 0x00, 0x00, 0x3d, 0xbf, 0xff, 0xff, 0xff, 0xbb,
+	0x58, 0x59, 0x5a, 0x20, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x4a, 0xbf,
+	0x00, 0x00, 0xb1, 0x37, 0x00, 0x00, 0x0a, 0xb9, 0x58, 0x59, 0x5a, 0x20,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x28, 0x38, 0x00, 0x00, 0x11, 0x0b,
+	0x00, 0x00, 0xc8, 0xb9, 0x63, 0x75, 0x72, 0x76, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x2a, 0x00, 0x00, 0x00, 0x7c, 0x00, 0xf8, 0x01, 0x9c,
+	0x02, 0x75, 0x03, 0x83, 0x04, 0xc9, 0x06, 0x4e, 0x08, 0x12, 0x0a, 0x18,
+	0x0c, 0x62, 0x0e, 0xf4, 0x11, 0xcf, 0x14, 0xf6, 0x18, 0x6a, 0x1c, 0x2e,
+	0x20, 0x43, 0x24, 0xac, 0x29, 0x6a, 0x2e, 0x7e, 0x33, 0xeb, 0x39, 0xb3,
+	0x3f, 0xd6, 0x46, 0x57, 0x4d, 0x36, 0x54, 0x76, 0x5c, 0x17, 0x64, 0x1d,
+	0x6c, 0x86, 0x75, 0x56, 0x7e, 0x8d, 0x88, 0x2c, 0x92, 0x36, 0x9c, 0xab,
+	0xa7, 0x8c, 0xb2, 0xdb, 0xbe, 0x99, 0xca, 0xc7, 0xd7, 0x65, 0xe4, 0x77,
+	0xf1, 0xf9, 0xff, 0xff,
+}
+
+const displayP3V2MicroICCProfileLength = 532
+
+var adobeRGBCompatV2MicroICCProfile = []byte{
+	0x00, 0x00, 0x01, 0xd4, 0x00, 0x00, 0x00, 0x00, 0x02, 0x10, 0x00, 0x00,
+	0x6d, 0x6e, 0x74, 0x72, 0x52, 0x47, 0x42, 0x20, 0x58, 0x59, 0x5a, 0x20,
+	0x07, 0xea, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x61, 0x63, 0x73, 0x70, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xf6, 0xd6,
+	0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0xd3, 0x2d, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x09,
+	0x64, 0x65, 0x73, 0x63, 0x00, 0x00, 0x00, 0xf0, 0x00, 0x00, 0x00, 0x76,
+	0x63, 0x70, 0x72, 0x74, 0x00, 0x00, 0x01, 0x68, 0x00, 0x00, 0x00, 0x0c,
+	0x77, 0x74, 0x70, 0x74, 0x00, 0x00, 0x01, 0x74, 0x00, 0x00, 0x00, 0x14,
+	0x72, 0x58, 0x59, 0x5a, 0x00, 0x00, 0x01, 0x88, 0x00, 0x00, 0x00, 0x14,
+	0x67, 0x58, 0x59, 0x5a, 0x00, 0x00, 0x01, 0x9c, 0x00, 0x00, 0x00, 0x14,
+	0x62, 0x58, 0x59, 0x5a, 0x00, 0x00, 0x01, 0xb0, 0x00, 0x00, 0x00, 0x14,
+	0x72, 0x54, 0x52, 0x43, 0x00, 0x00, 0x01, 0xc4, 0x00, 0x00, 0x00, 0x0e,
+	0x67, 0x54, 0x52, 0x43, 0x00, 0x00, 0x01, 0xc4, 0x00, 0x00, 0x00, 0x0e,
+	0x62, 0x54, 0x52, 0x43, 0x00, 0x00, 0x01, 0xc4, 0x00, 0x00, 0x00, 0x0e,
+	0x64, 0x65, 0x73, 0x63, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x1c,
+	0x41, 0x64, 0x6f, 0x62, 0x65, 0x20, 0x52, 0x47, 0x42, 0x20, 0x28, 0x31,
+	0x39, 0x39, 0x38, 0x29, 0x20, 0x63, 0x6f, 0x6d, 0x70, 0x61, 0x74, 0x69,
+	0x62, 0x6c, 0x65, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x74, 0x65, 0x78, 0x74, 0x00, 0x00, 0x00, 0x00, 0x43, 0x43, 0x30, 0x00,
+	0x58, 0x59, 0x5a, 0x20, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xf6, 0xd6,
+	0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0xd3, 0x2d, 0x58, 0x59, 0x5a, 0x20,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x9c, 0x18, 0x00, 0x00, 0x4f, 0xa5,
+	0x00, 0x00, 0x04, 0xfc, 0x58, 0x59, 0x5a, 0x20, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x34, 0x8d, 0x00, 0x00, 0xa0, 0x2c, 0x00, 0x00, 0x0f, 0x95,
+	0x58, 0x59, 0x5a, 0x20, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x26, 0x31,
+	0x00, 0x00, 0x10, 0x2f, 0x00, 0x00, 0xbe, 0x9c, 0x63, 0x75, 0x72, 0x76,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x02, 0x33, 0x00, 0x00,
+}
+
+const adobeRGBCompatV2MicroICCProfileLength = 468
+
 const sRGBV2MicroICCProfilePath = "srgb_v2_micro.icc"
 const sGrayV2MicroICCProfilePath = "sgray_v2_micro.icc"
 const sRGBIEC6196621ICCProfilePath = "srgb_iec61966_2_1.icc"
 const genericGrayGamma22ICCProfilePath = "generic_gray_gamma_2_2.icc"
+const displayP3V2MicroICCProfilePath = "display_p3_v2_micro.icc"
+const adobeRGBCompatV2MicroICCProfilePath = "adobe_rgb_compat_v2_micro.icc"
 
 var temporaryDirectory string
 
@@ -684,4 +786,80 @@ func initializeICCProfiles() {
 	if err != nil {
 		panic(fmt.Sprintf("Couldn't store temporary file for ICC profile 4: %v", err.Error()))
 	}
+
+	err = ioutil.WriteFile(filepath.Join(temporaryDirectory, displayP3V2MicroICCProfilePath), displayP3V2MicroICCProfile, 0600)
+	if err != nil {
+		panic(fmt.Sprintf("Couldn't store temporary file for ICC profile 5: %v", err.Error()))
+	}
+
+	err = ioutil.WriteFile(filepath.Join(temporaryDirectory, adobeRGBCompatV2MicroICCProfilePath), adobeRGBCompatV2MicroICCProfile, 0600)
+	if err != nil {
+		panic(fmt.Sprintf("Couldn't store temporary file for ICC profile 6: %v", err.Error()))
+	}
+}
+
+// builtinICCProfiles maps the names accepted by ExportParams.ICCProfile to the profiles shipped with govips.
+var builtinICCProfiles = map[string]string{
+	"srgb":       sRGBIEC6196621ICCProfilePath,
+	"srgb-micro": sRGBV2MicroICCProfilePath,
+	"gray":       genericGrayGamma22ICCProfilePath,
+	"gray-micro": sGrayV2MicroICCProfilePath,
+	"p3":         displayP3V2MicroICCProfilePath,
+	"adobe-rgb":  adobeRGBCompatV2MicroICCProfilePath,
+}
+
+var (
+	namedICCProfiles   = map[string]string{}
+	namedICCProfilesMu sync.RWMutex
+)
+
+// RegisterICCProfile makes an ICC profile available under the given name for ExportParams.ICCProfile,
+// e.g. a printer profile, which govips doesn't ship. Names are case-insensitive and registering a
+// name again replaces the previous profile. Built-in names cannot be replaced.
+func RegisterICCProfile(name string, profile []byte) error {
+	name = strings.ToLower(name)
+	if name == "" || len(profile) == 0 {
+		return fmt.Errorf("ICC profile name and data must not be empty")
+	}
+	if _, ok := builtinICCProfiles[name]; ok {
+		return fmt.Errorf("cannot replace built-in ICC profile %q", name)
+	}
+
+	namedICCProfilesMu.Lock()
+	defer namedICCProfilesMu.Unlock()
+
+	file, err := ioutil.TempFile(temporaryDirectory, "named-*.icc")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := file.Write(profile); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+
+	if previous, ok := namedICCProfiles[name]; ok {
+		os.Remove(previous)
+	}
+	namedICCProfiles[name] = file.Name()
+
+	return nil
+}
+
+// iccProfilePath resolves a built-in or registered profile name to the file holding the profile.
+func iccProfilePath(name string) (string, error) {
+	name = strings.ToLower(name)
+	if path, ok := builtinICCProfiles[name]; ok {
+		return filepath.Join(temporaryDirectory, path), nil
+	}
+
+	namedICCProfilesMu.RLock()
+	defer namedICCProfilesMu.RUnlock()
+
+	if path, ok := namedICCProfiles[name]; ok {
+		return path, nil
+	}
+
+	return "", fmt.Errorf("%w: %q", ErrUnknownICCProfile, name)
 }
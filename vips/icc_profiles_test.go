@@ -13,6 +13,8 @@ func Test_ICCProfileLengths(t *testing.T) {
 	assert.Equal(t, len(sGrayV2MicroICCProfile), sGrayV2MicroICCProfileLength)
 	assert.Equal(t, len(sRGBIEC6196621ICCProfile), sRGBIEC6196621ICCProfileLength)
 	assert.Equal(t, len(genericGrayGamma22ICCProfile), genericGrayGamma22ICCProfileLength)
+	assert.Equal(t, len(displayP3V2MicroICCProfile), displayP3V2MicroICCProfileLength)
+	assert.Equal(t, len(adobeRGBCompatV2MicroICCProfile), adobeRGBCompatV2MicroICCProfileLength)
 }
 
 func Test_ICCProfileInitialisation(t *testing.T) {
@@ -33,4 +35,23 @@ func Test_ICCProfileInitialisation(t *testing.T) {
 	grayProfile2, err := ioutil.ReadFile(filepath.Join(temporaryDirectory, genericGrayGamma22ICCProfilePath))
 	assert.NoError(t, err)
 	assert.Equal(t, genericGrayGamma22ICCProfile, grayProfile2)
+
+	p3Profile, err := ioutil.ReadFile(filepath.Join(temporaryDirectory, displayP3V2MicroICCProfilePath))
+	assert.NoError(t, err)
+	assert.Equal(t, displayP3V2MicroICCProfile, p3Profile)
+
+	adobeProfile, err := ioutil.ReadFile(filepath.Join(temporaryDirectory, adobeRGBCompatV2MicroICCProfilePath))
+	assert.NoError(t, err)
+	assert.Equal(t, adobeRGBCompatV2MicroICCProfile, adobeProfile)
+}
+
+func Test_SetICCRenderingIntent(t *testing.T) {
+	profile, ok := setICCRenderingIntent(sRGBIEC6196621ICCProfile, RenderingIntentAbsolute)
+	assert.True(t, ok)
+	assert.Equal(t, []byte{0, 0, 0, 3}, profile[64:68])
+	assert.Equal(t, len(sRGBIEC6196621ICCProfile), len(profile))
+	assert.NotEqual(t, profile[64:68], sRGBIEC6196621ICCProfile[64:68])
+
+	_, ok = setICCRenderingIntent([]byte("not a profile"), RenderingIntentAbsolute)
+	assert.False(t, ok)
 }
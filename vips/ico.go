@@ -0,0 +1,92 @@
+package vips
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// icoMaxSize is the largest icon size an ICO directory entry can describe
+const icoMaxSize = 256
+
+// ExportICO returns a multi-resolution ICO file, e.g. a favicon with the sizes 16, 32 and 48. Each size is a
+// square PNG compressed entry between 1 and 256 pixels. Non-square images are fitted and centered on a
+// transparent background.
+func (r *ImageRef) ExportICO(sizes []int) ([]byte, error) {
+	if len(sizes) == 0 {
+		return nil, fmt.Errorf("no ICO sizes given")
+	}
+
+	entries := make([][]byte, len(sizes))
+	for i, size := range sizes {
+		if size < 1 || size > icoMaxSize {
+			return nil, fmt.Errorf("invalid ICO size %d, it must be between 1 and %d", size, icoMaxSize)
+		}
+
+		entry, err := r.icoEntry(size)
+		if err != nil {
+			return nil, err
+		}
+		entries[i] = entry
+	}
+
+	return writeICO(sizes, entries), nil
+}
+
+// icoEntry returns the image as size x size sRGB PNG with alpha
+func (r *ImageRef) icoEntry(size int) ([]byte, error) {
+	icon, err := r.Copy()
+	if err != nil {
+		return nil, err
+	}
+	defer icon.Close()
+
+	if err := icon.ToColorSpace(InterpretationSRGB); err != nil {
+		return nil, err
+	}
+	if err := icon.AddAlpha(); err != nil {
+		return nil, err
+	}
+	if err := icon.Thumbnail(size, size, InterestingNone); err != nil {
+		return nil, err
+	}
+	if icon.Width() != size || icon.Height() != size {
+		if err := icon.Embed((size-icon.Width())/2, (size-icon.Height())/2, size, size, ExtendBlack); err != nil {
+			return nil, err
+		}
+	}
+
+	params := NewDefaultPNGExportParams()
+	params.StripMetadata = true
+
+	buf, _, err := icon.Export(params)
+	return buf, err
+}
+
+// writeICO packs the PNG entries into an ICO container, see
+// https://docs.microsoft.com/en-us/previous-versions/ms997538(v=msdn.10)
+func writeICO(sizes []int, entries [][]byte) []byte {
+	var buf bytes.Buffer
+
+	// ICONDIR: reserved, type 1 for icons and the number of entries
+	_ = binary.Write(&buf, binary.LittleEndian, []uint16{0, 1, uint16(len(entries))})
+
+	offset := 6 + 16*len(entries)
+	for i, entry := range entries {
+		// a width and height of 0 means 256 pixels
+		dimension := byte(sizes[i] % icoMaxSize)
+
+		// ICONDIRENTRY: width, height, palette size, reserved, color planes, bits per pixel, size and offset
+		buf.Write([]byte{dimension, dimension, 0, 0})
+		_ = binary.Write(&buf, binary.LittleEndian, []uint16{1, 32})
+		_ = binary.Write(&buf, binary.LittleEndian, []uint32{uint32(len(entry)), uint32(offset)})
+
+		offset += len(entry)
+	}
+
+	for _, entry := range entries {
+		buf.Write(entry)
+	}
+
+	return buf.Bytes()
+}
@@ -0,0 +1,54 @@
+package vips
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImageRef_ExportICO(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "png-8bit.png")
+	require.NoError(t, err)
+
+	sizes := []int{16, 32, 48, 256}
+	buf, err := img.ExportICO(sizes)
+	require.NoError(t, err)
+
+	require.True(t, len(buf) > 6+16*len(sizes))
+	assert.Equal(t, uint16(1), binary.LittleEndian.Uint16(buf[2:4]))
+	assert.Equal(t, uint16(len(sizes)), binary.LittleEndian.Uint16(buf[4:6]))
+
+	for i, size := range sizes {
+		entry := buf[6+16*i : 6+16*(i+1)]
+		assert.Equal(t, byte(size%256), entry[0])
+		assert.Equal(t, byte(size%256), entry[1])
+
+		length := binary.LittleEndian.Uint32(entry[8:12])
+		offset := binary.LittleEndian.Uint32(entry[12:16])
+		require.True(t, int(offset+length) <= len(buf))
+
+		config, err := png.DecodeConfig(bytes.NewReader(buf[offset : offset+length]))
+		require.NoError(t, err)
+		assert.Equal(t, size, config.Width)
+		assert.Equal(t, size, config.Height)
+	}
+}
+
+func TestImageRef_ExportICO__InvalidSize(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "png-8bit.png")
+	require.NoError(t, err)
+
+	_, err = img.ExportICO(nil)
+	assert.Error(t, err)
+
+	_, err = img.ExportICO([]int{16, 512})
+	assert.Error(t, err)
+}
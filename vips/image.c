@@ -8,3 +8,36 @@ void clear_image(VipsImage **image) {
 	// https://developer.gnome.org/gobject/stable/gobject-The-Base-Object-Type.html#g-clear-object
 	if (G_IS_OBJECT(*image)) g_clear_object(image);
 }
+
+int copy_image_memory(VipsImage *in, VipsImage **out) {
+	*out = vips_image_copy_memory(in);
+	return *out == NULL ? -1 : 0;
+}
+
+// unlike vips_copy, the new image is never shared via the operation cache, so it can be killed safely
+int copy_image_private(VipsImage *in, VipsImage **out) {
+	*out = vips_image_new();
+	if (vips_image_write(in, *out)) {
+		g_object_unref(*out);
+		*out = NULL;
+		return -1;
+	}
+	return 0;
+}
+
+// the pixels are copied, so the caller's buffer may be released once the image is created
+int image_new_from_memory(const void *data, size_t len, int width, int height, int bands, VipsBandFormat format, VipsImage **out) {
+	*out = vips_image_new_from_memory_copy(data, len, width, height, bands, format);
+	if (*out == NULL) {
+		return -1;
+	}
+
+	int is16bit = format == VIPS_FORMAT_USHORT;
+	if (bands <= 2) {
+		(*out)->Type = is16bit ? VIPS_INTERPRETATION_GREY16 : VIPS_INTERPRETATION_B_W;
+	} else if (bands <= 4) {
+		(*out)->Type = is16bit ? VIPS_INTERPRETATION_RGB16 : VIPS_INTERPRETATION_sRGB;
+	}
+
+	return 0;
+}
@@ -6,16 +6,25 @@ import "C"
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"image"
 	"io"
 	"io/ioutil"
+	"math"
+	"os"
 	"runtime"
 	"sync"
 	"unsafe"
 )
 
+const mmPerInch = 25.4
+
 // PreMultiplicationState stores the premultiplication band format of the image
 type PreMultiplicationState struct {
 	bandFormat BandFormat
@@ -35,35 +44,110 @@ type ImageRef struct {
 }
 
 // ImageMetadata is a data structure holding the width, height, orientation and other metadata of the picture.
+// Bands and Colorspace are the number of bands and the interpretation of the image, e.g. to tell LAB from sRGB.
+// JPEGVariant is only set by Metadata for images loaded from a JPEG buffer.
 type ImageMetadata struct {
 	Format      ImageType
 	Width       int
 	Height      int
+	Bands       int
 	Colorspace  Interpretation
 	Orientation int
+	JPEGVariant JPEGVariant
 }
 
 // ExportParams are options when exporting an image to file or buffer.
+// Quality is the JPEG, WebP and HEIF quality from 1 to 100, 0 uses the libvips default. Compression is the PNG
+// zlib level from 0 to 9. Export to these formats fails for values outside those ranges.
+// Effort is the WebP compression effort from 0 (fastest) to 6 (smallest output). It is the same setting as the
+// libwebp method (cwebp -m), so cwebp settings carry over unchanged. WebP export fails for values outside that range.
+// Background, if set, is the color transparent areas are flattened against when
+// exporting an image with alpha to a format without alpha support (e.g. JPEG).
+// MagickFormat is the ImageMagick coder (e.g. "DDS") used when exporting to ImageTypeMagick.
+// Formats libvips cannot save on this host, such as GIF, are encoded with the Go encoder registered with
+// RegisterEncoder for them, otherwise they are exported as JPEG.
+// MaxMetadataBytes, if positive, drops metadata fields such as XMP, EXIF or ICC profiles larger than the given size.
+// TiffCompression and Bitdepth control TIFF output, e.g. bilevel CCITT G4 faxes with TiffCompressionCCITTFax4 and 1.
+// TiffSampleFormat casts TIFF samples to 8-bit, 16-bit or 32-bit float without rescaling the values, so float
+// rasters such as elevation data round-trip without quantization.
+// Loop, if set, is the number of times animated output is played, 0 loops forever. If nil, the loop count of
+// the source is kept.
+// TargetSSIM, if positive, makes JPEG export pick the lowest quality whose SSIM against the image
+// reaches the target (e.g. 0.98) instead of using Quality.
+// StripEXIFThumbnail removes the preview image embedded in the EXIF data while keeping the other EXIF fields.
+// Density, if positive, is the JFIF density of JPEG output in dots per DensityUnit (e.g. 300 DPI), regardless
+// of the image resolution.
+// Exact keeps the RGB values of fully transparent pixels in WebP output, e.g. for texture atlases. By default
+// libwebp changes them to improve compression. It requires libvips 8.15, otherwise export fails with ErrWebPExactUnsupported.
+// Lossless WebP output keeps the pixels whatever the Quality, libwebp uses it as the compression effort instead:
+// higher values are slower and smaller, so Quality 100 with Effort 6 gives the smallest lossless files.
+// NearLossless preprocesses the pixels to compress better, with Quality as the amount of change allowed; it
+// implies Lossless, and Quality 100 is rejected as it would change nothing. WebPPreset tunes lossy libwebp
+// output for the content, e.g. WebPPresetIcon or WebPPresetDrawing for graphics with few colors. Presets do not
+// affect lossless output, so they are rejected with Lossless or NearLossless. libvips does not expose the libwebp
+// color cache.
+// ICCProfile, if set, converts the image to the named profile and embeds it. The shipped profiles are "srgb",
+// "srgb-micro", "gray", "gray-micro", "p3" and "adobe-rgb"; others can be added with RegisterICCProfile. The
+// profile is dropped again when StripMetadata is set.
+// RenderingIntent, if set, is used for the ICCProfile conversion and written to the header of the embedded
+// profile, e.g. RenderingIntentRelative for print-to-screen conversions. Images without a profile are left as is.
+// HeifEncoder picks the libheif encoder for HEIF output. HeifEncoderAuto keeps the libvips default of HEVC
+// compression, the AV1 encoders HeifEncoderAOM, HeifEncoderRav1e and HeifEncoderSVT produce AVIF and
+// HeifEncoderX265 produces HEVC. Setting an encoder requires libvips 8.13, otherwise export fails with
+// ErrHEIFEncoderUnsupported.
+// HeifSubsampleMode sets the chroma subsampling of HEIF output. libheif has no separate chroma quality, but
+// SubsampleModeOn halves the chroma resolution to save bytes while Quality keeps the luma sharp, e.g. for text
+// in screenshots, and SubsampleModeOff keeps full chroma at lower qualities. It requires libvips 8.13, otherwise
+// export fails with ErrHEIFSubsampleModeUnsupported.
 type ExportParams struct {
-	Format        ImageType
-	Quality       int
-	Compression   int
-	Interlaced    bool
-	Lossless      bool
-	Effort        int
-	StripMetadata bool
+	Format             ImageType
+	Quality            int
+	Compression        int
+	Interlaced         bool
+	Lossless           bool
+	Effort             int
+	StripMetadata      bool
+	Background         *Color
+	MagickFormat       string
+	MaxMetadataBytes   int
+	TiffCompression    TiffCompression
+	TiffSampleFormat   TiffSampleFormat
+	Bitdepth           int
+	Loop               *int
+	TargetSSIM         float64
+	StripEXIFThumbnail bool
+	Density            float64
+	DensityUnit        DensityUnit
+	Exact              bool
+	NearLossless       bool
+	WebPPreset         WebPPreset
+	ICCProfile         string
+	RenderingIntent    RenderingIntent
+	HeifEncoder        HeifEncoder
+	HeifSubsampleMode  SubsampleMode
 }
 
 // ImportOptions are options when importing an image from file or buffer.
 type ImportOptions struct {
-	imageType ImageType
-	params    importParams
+	imageType      ImageType
+	passthrough    bool
+	colorspace     Interpretation
+	raw            bool
+	directBMP      bool
+	loader         string
+	premultiplied  bool
+	invertCMYK     bool
+	precision      ProcessingPrecision
+	maxPixels      int
+	maxFrames      int
+	truncateFrames bool
+	params         importParams
 }
 
 type importParams struct {
 	shrink     int     // jpeg
 	fail       bool    // jpeg
-	autorotate bool    // jpeg, tiff
+	autorotate bool    // jpeg, png, webp, tiff, heif
 	page       int     // webp, tiff, gif, pdf, heif, magick
 	n          int     // webp, tiff, gif, pdf, heif, magick
 	scale      float64 // webp, pdf, svg
@@ -77,6 +161,28 @@ type importParams struct {
 // ImportOption configures ImportOptions.
 type ImportOption func(options *ImportOptions)
 
+var (
+	defaultImportOptions     []ImportOption
+	defaultImportOptionsLock sync.RWMutex
+)
+
+// SetDefaultImportOptions sets import options which are applied to every load before the options
+// passed to the individual call, so per-call options still take precedence. Calling it again
+// replaces the previous defaults; call it without arguments to clear them.
+func SetDefaultImportOptions(o ...ImportOption) {
+	defaultImportOptionsLock.Lock()
+	defer defaultImportOptionsLock.Unlock()
+
+	defaultImportOptions = append([]ImportOption(nil), o...)
+}
+
+func getDefaultImportOptions() []ImportOption {
+	defaultImportOptionsLock.RLock()
+	defer defaultImportOptionsLock.RUnlock()
+
+	return defaultImportOptions
+}
+
 // ImageTypeImportOption sets the image type import option. This can for example be used to force loading an image with
 // the "magick" loader. If unset, the image type is automatically detected.
 func ImageTypeImportOption(imageType ImageType) ImportOption {
@@ -85,6 +191,101 @@ func ImageTypeImportOption(imageType ImageType) ImportOption {
 	}
 }
 
+// PassthroughImportOption makes loading an image which is recognized by DetermineImageType, but cannot
+// be processed by libvips on this host (e.g. HEIF without libheif), return a *PassthroughError holding
+// the original bytes and type instead of ErrUnsupportedImageFormat. Check for it with errors.Is(err, ErrPassthrough).
+func PassthroughImportOption(passthrough bool) ImportOption {
+	return func(o *ImportOptions) {
+		o.passthrough = passthrough
+	}
+}
+
+// ColorspaceImportOption converts every loaded image to the given color space, e.g. InterpretationSRGB.
+// Embedded ICC profiles are taken into account for the conversion. By default images are left as-is.
+func ColorspaceImportOption(interpretation Interpretation) ImportOption {
+	return func(o *ImportOptions) {
+		o.colorspace = interpretation
+	}
+}
+
+// RawDecodeImportOption loads images with their native interpretation and bit depth, without any of the
+// normalization govips applies after decoding: images are not autorotated (including HEIF, which is autorotated
+// by default), and ColorspaceImportOption, PremultipliedAlphaImportOption, InvertedCMYKImportOption and
+// ProcessingPrecisionImportOption are ignored. Note that BMP images are converted via PNG unless
+// DirectBMPImportOption is set.
+func RawDecodeImportOption(raw bool) ImportOption {
+	return func(o *ImportOptions) {
+		o.raw = raw
+	}
+}
+
+// DirectBMPImportOption loads BMP images with the libvips magick loader when it is available, instead of
+// decoding them with Go and handing them to libvips as PNG. This avoids the double conversion and keeps
+// exotic BMPs intact. BMPs which magick fails to load are still converted via PNG.
+func DirectBMPImportOption(direct bool) ImportOption {
+	return func(o *ImportOptions) {
+		o.directBMP = direct
+	}
+}
+
+// LoaderImportOption pins the libvips buffer loader operation used to load the image, e.g. "magickload_buffer"
+// for DNG files which would otherwise be read by "tiffload_buffer". This bypasses image type detection and
+// the loader runs with its default options, so the other param options are ignored.
+func LoaderImportOption(loader string) ImportOption {
+	return func(o *ImportOptions) {
+		o.loader = loader
+	}
+}
+
+// PremultipliedAlphaImportOption declares that the color of the source is premultiplied by alpha, as delivered
+// by some renderers, and converts it to the straight alpha libvips operations expect on load.
+func PremultipliedAlphaImportOption(premultiplied bool) ImportOption {
+	return func(o *ImportOptions) {
+		o.premultiplied = premultiplied
+	}
+}
+
+// InvertedCMYKImportOption declares that the ink of CMYK images is stored inverted, as written by some Adobe
+// applications, and inverts the C, M, Y and K bands on load so the colors don't come out as a negative. TIFF
+// has no reliable tag for this, so it has to be set explicitly. Images which are not CMYK are not changed.
+func InvertedCMYKImportOption(inverted bool) ImportOption {
+	return func(o *ImportOptions) {
+		o.invertCMYK = inverted
+	}
+}
+
+// ProcessingPrecisionImportOption converts images to 8-bit, 16-bit or float right after decoding, so that the
+// following operations run on the narrower format, e.g. ProcessingPrecision8 for thumbnails of 16-bit images
+// which are exported as 8-bit anyway. Pass it to SetDefaultImportOptions to apply it to every load.
+func ProcessingPrecisionImportOption(precision ProcessingPrecision) ImportOption {
+	return func(o *ImportOptions) {
+		o.precision = precision
+	}
+}
+
+// MaxRasterPixelsImportOption limits the number of pixels an SVG or PDF page may be rasterized to, so that
+// a tiny document with a huge viewBox or page size fails with ErrMaxRasterPixelsExceeded instead of
+// exhausting memory. The limit applies to each page loaded, not to their total. It also applies to QOI images,
+// which govips decodes in full while loading. By default SVGs and QOI images are limited to 100 million pixels
+// and PDFs are not limited; pass 0 to disable the limit.
+func MaxRasterPixelsImportOption(pixels int) ImportOption {
+	return func(o *ImportOptions) {
+		o.maxPixels = pixels
+	}
+}
+
+// MaxFramesImportOption limits the number of frames loaded from animated or multi-page images, e.g. GIF, WebP
+// or TIFF loaded with NParamImportOption(-1), so that files with thousands of frames cannot exhaust memory.
+// The frames are counted from the header before decoding. Loading fails with ErrMaxFramesExceeded if there are
+// more frames, or keeps only the first frames along with their delays if truncate is set. Pass 0 to disable
+// the limit.
+func MaxFramesImportOption(frames int, truncate bool) ImportOption {
+	return func(o *ImportOptions) {
+		o.maxFrames = frames
+		o.truncateFrames = truncate
+	}
+}
+
 // ShrinkParamImportOption sets the "shrink" parameter (supported by: jpeg).
 func ShrinkParamImportOption(shrink int) ImportOption {
 	return func(o *ImportOptions) {
@@ -99,7 +300,11 @@ func FailParamImportOption(fail bool) ImportOption {
 	}
 }
 
-// AutorotateParamImportOption sets the "autorotate" parameter (supported by: jpeg, tiff).
+// AutorotateParamImportOption sets the "autorotate" parameter (supported by: jpeg, png, webp, tiff, heif).
+// JPEG, PNG (eXIf chunk), WebP and TIFF are rotated according to their EXIF orientation. Animated PNG and WebP
+// images loaded with more than one page are not rotated. For HEIF, autorotate controls whether the
+// container level rotation and mirroring (irot/imir boxes) are applied, it defaults to true. Disable it to keep
+// the unrotated pixels, the orientation metadata then describes the container transforms.
 func AutorotateParamImportOption(autorotate bool) ImportOption {
 	return func(o *ImportOptions) {
 		o.params.autorotate = autorotate
@@ -120,6 +325,16 @@ func NParamImportOption(n int) ImportOption {
 	}
 }
 
+// PageRangeImportOption loads the pages [start, end) into a single tall strip by setting the
+// "page" and "n" parameters (supported by: webp, tiff, gif, pdf, heif, magick). Use PageHeight on the
+// loaded image to get the height of a single page.
+func PageRangeImportOption(start, end int) ImportOption {
+	return func(o *ImportOptions) {
+		o.params.page = start
+		o.params.n = end - start
+	}
+}
+
 // ScaleParamImportOption sets the "scale" parameter (supported by: webp, pdf, svg).
 func ScaleParamImportOption(scale float64) ImportOption {
 	return func(o *ImportOptions) {
@@ -228,7 +443,8 @@ func NewImageFromFile(file string, o ...ImportOption) (*ImageRef, error) {
 	return NewImageFromBuffer(buf, o...)
 }
 
-// NewImageFromBuffer loads an image buffer and creates a new Image
+// NewImageFromBuffer loads an image buffer and creates a new Image. The image is decoded lazily when it is
+// first used and the decode cannot be cancelled, see NewImageFromBufferContext for that.
 func NewImageFromBuffer(buf []byte, o ...ImportOption) (*ImageRef, error) {
 	startupIfNeeded()
 
@@ -243,12 +459,335 @@ func NewImageFromBuffer(buf []byte, o ...ImportOption) (*ImageRef, error) {
 	return ref, nil
 }
 
+// NewImageFromBufferContext loads an image from the buffer and decodes it into memory, aborting the decode
+// when the context is cancelled or its deadline passes, e.g. when the client disconnected. This bounds the time
+// spent rasterizing complex SVG and PDF documents, which libvips otherwise renders lazily on first use.
+// libvips checks for cancellation between tiles, so a single tile still renders to completion.
+// The error is the context's error if the decode was aborted. NewImageFromBuffer and NewThumbnailFromBuffer
+// cannot be cancelled.
+func NewImageFromBufferContext(ctx context.Context, buf []byte, o ...ImportOption) (*ImageRef, error) {
+	startupIfNeeded()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	image, format, err := vipsLoadFromBuffer(buf, o...)
+	if err != nil {
+		return nil, err
+	}
+	defer clearImage(image)
+
+	decoded, err := vipsCopyImageMemoryContext(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+
+	return newImageRef(decoded, format, buf), nil
+}
+
+// LoadImageRegion loads only the given area of an image. libvips decodes lazily, so for tiled formats such as
+// tiled TIFF, PDF, SVG and HEIF only the tiles overlapping the area are decoded. The area is then copied to
+// memory, so the returned image does not keep the rest of the decode pipeline alive.
+// Strip based formats such as JPEG and PNG are still decoded up to the bottom of the area.
+func LoadImageRegion(buf []byte, left, top, width, height int, o ...ImportOption) (*ImageRef, error) {
+	startupIfNeeded()
+
+	image, format, err := vipsLoadFromBuffer(buf, o...)
+	if err != nil {
+		return nil, err
+	}
+	defer clearImage(image)
+
+	if left < 0 || top < 0 || width <= 0 || height <= 0 ||
+		left+width > int(image.Xsize) || top+height > int(image.Ysize) {
+		return nil, fmt.Errorf("region %dx%d+%d+%d is outside of the %dx%d image",
+			width, height, left, top, int(image.Xsize), int(image.Ysize))
+	}
+
+	area, err := vipsExtractArea(image, left, top, width, height)
+	if err != nil {
+		return nil, err
+	}
+	defer clearImage(area)
+
+	region, err := vipsCopyImageMemory(area)
+	if err != nil {
+		return nil, err
+	}
+
+	return newImageRef(region, format, buf), nil
+}
+
+// NewThumbnailFromBuffer loads a thumbnail of the image that fits within the given width and height, see
+// ImageRef.Thumbnail for the crop strategies. Unlike loading the image and calling Thumbnail, the image is
+// shrunk while it is decoded: JPEG, WebP, HEIF, PDF and SVG are shrunk on load, other formats such as PNG and
+// GIF are decoded with sequential access and streamed through the shrink, so memory use is bounded by the
+// thumbnail size rather than the image size. The image is rotated according to its EXIF orientation.
+// The decode cannot be cancelled, unlike with NewImageFromBufferContext.
+func NewThumbnailFromBuffer(buf []byte, width, height int, crop Interesting, opts ...ResizeOption) (*ImageRef, error) {
+	startupIfNeeded()
+
+	if len(buf) == 0 {
+		return nil, ErrUnsupportedImageFormat
+	}
+
+	image, err := vipsThumbnailFromBuffer(buf, width, height, crop, newResizeOptions(opts).linear)
+	if err != nil {
+		return nil, err
+	}
+
+	return newImageRef(image, DetermineImageType(buf), buf), nil
+}
+
+// LoadImageFromRawData creates an image from uncompressed pixels, e.g. camera frames, without encoding
+// and decoding them. data holds width * height pixels of bands samples in the given format, interleaved and
+// in native byte order. The pixels are copied, since libvips may not keep references to Go memory.
+// Images with up to 4 bands are interpreted as grey or sRGB, depending on the number of bands.
+func LoadImageFromRawData(data []byte, width, height, bands int, format BandFormat) (*ImageRef, error) {
+	startupIfNeeded()
+
+	if width <= 0 || height <= 0 || bands <= 0 {
+		return nil, fmt.Errorf("invalid raw image of %dx%d pixels with %d bands", width, height, bands)
+	}
+
+	size := width * height * bands * int(C.vips_format_sizeof(C.VipsBandFormat(format)))
+	if size <= 0 || len(data) != size {
+		return nil, fmt.Errorf("raw image of %dx%d pixels with %d bands needs %d bytes, got %d",
+			width, height, bands, size, len(data))
+	}
+
+	out, err := vipsImageFromMemory(data, width, height, bands, format)
+	if err != nil {
+		return nil, err
+	}
+
+	return newImageRef(out, ImageTypeUnknown, nil), nil
+}
+
+// LoadImageFromRawDataWithByteOrder is like LoadImageFromRawData, but the samples are stored in the given byte
+// order instead of the native one, e.g. binary.BigEndian for 16-bit big-endian sensor dumps. Complex samples
+// are swapped per component.
+func LoadImageFromRawDataWithByteOrder(data []byte, width, height, bands int, format BandFormat, order binary.ByteOrder) (*ImageRef, error) {
+	size := int(C.vips_format_sizeof(C.VipsBandFormat(format)))
+	if format == BandFormatComplex || format == BandFormatDpComplex {
+		size /= 2
+	}
+
+	if size > 1 && isBigEndian(order) != isBigEndian(nativeByteOrder) {
+		data = swapBytes(data, size)
+	}
+
+	return LoadImageFromRawData(data, width, height, bands, format)
+}
+
+// nativeByteOrder is the byte order of the host, which libvips uses for the samples in memory
+var nativeByteOrder = func() binary.ByteOrder {
+	probe := uint16(1)
+	if *(*byte)(unsafe.Pointer(&probe)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}()
+
+func isBigEndian(order binary.ByteOrder) bool {
+	probe := make([]byte, 2)
+	order.PutUint16(probe, 1)
+	return probe[1] == 1
+}
+
+// swapBytes returns a copy of data with the byte order of each sample of the given size reversed
+func swapBytes(data []byte, size int) []byte {
+	swapped := make([]byte, len(data))
+	for i := 0; i+size <= len(data); i += size {
+		for j := 0; j < size; j++ {
+			swapped[i+j] = data[i+size-1-j]
+		}
+	}
+	return swapped
+}
+
+// LoadPDFPages renders the pages [start, end) of a PDF into a single tall strip, decoding the document once.
+// It returns the strip along with the height of a single page.
+func LoadPDFPages(buf []byte, start, end int, o ...ImportOption) (*ImageRef, int, error) {
+	if start < 0 || end <= start {
+		return nil, 0, fmt.Errorf("invalid page range [%d, %d)", start, end)
+	}
+
+	if DetermineImageType(buf) != ImageTypePDF {
+		return nil, 0, ErrUnsupportedImageFormat
+	}
+
+	ref, err := NewImageFromBuffer(buf, append(o, PageRangeImportOption(start, end))...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return ref, ref.PageHeight(), nil
+}
+
+// LoadPDFAllPages renders all pages of a PDF into a single tall strip, e.g. for a continuous scrolling preview.
+// It returns the strip along with the height of a single page. If the pages differ in size, the strip is as wide
+// as the widest page and the returned page height is the height of the whole strip.
+func LoadPDFAllPages(buf []byte, o ...ImportOption) (*ImageRef, int, error) {
+	if DetermineImageType(buf) != ImageTypePDF {
+		return nil, 0, ErrUnsupportedImageFormat
+	}
+
+	ref, err := NewImageFromBuffer(buf, append(o, PageParamImportOption(0), NParamImportOption(-1))...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return ref, ref.PageHeight(), nil
+}
+
+// LoadFirstFrame loads only the first frame of an animated image, e.g. as a static poster, which is cheaper
+// than decoding all frames. Page options in o are overridden. Other images are loaded as usual.
+func LoadFirstFrame(buf []byte, o ...ImportOption) (*ImageRef, error) {
+	return NewImageFromBuffer(buf, append(o, PageParamImportOption(0), NParamImportOption(1))...)
+}
+
+// GIFFrame is a single frame of an animated GIF along with its delay in milliseconds.
+type GIFFrame struct {
+	Image *ImageRef
+	Delay int
+}
+
+// LoadGIFFrames loads all frames of an animated GIF and returns them as separate images,
+// instead of a single tall strip with the frames stacked vertically.
+func LoadGIFFrames(buf []byte) ([]GIFFrame, error) {
+	startupIfNeeded()
+
+	if DetermineImageType(buf) != ImageTypeGIF {
+		return nil, ErrUnsupportedImageFormat
+	}
+
+	strip, _, err := vipsLoadFromBuffer(buf, NParamImportOption(-1))
+	if err != nil {
+		return nil, err
+	}
+	defer clearImage(strip)
+
+	width := int(strip.Xsize)
+	pageHeight := vipsGetPageHeight(strip)
+	pages := int(strip.Ysize) / pageHeight
+	delays := vipsGetMetaDelay(strip)
+
+	frames := make([]GIFFrame, 0, pages)
+	for i := 0; i < pages; i++ {
+		out, err := vipsExtractArea(strip, 0, i*pageHeight, width, pageHeight)
+		if err != nil {
+			return nil, err
+		}
+
+		frame := GIFFrame{Image: newImageRef(out, ImageTypeGIF, buf)}
+		if i < len(delays) {
+			frame.Delay = delays[i]
+		}
+		frames = append(frames, frame)
+	}
+
+	return frames, nil
+}
+
+// JoinFramesToStrip joins equally sized frames vertically into a single tall strip with the page height,
+// number of pages and delays set, ready to be exported as an animated GIF or WebP. This is the inverse of
+// LoadGIFFrames. delays are in milliseconds per frame and may be nil to leave them unset.
+func JoinFramesToStrip(frames []*ImageRef, delays []int) (*ImageRef, error) {
+	if len(frames) == 0 {
+		return nil, errors.New("no frames to join")
+	}
+	if len(delays) != 0 && len(delays) != len(frames) {
+		return nil, fmt.Errorf("got %d delays for %d frames", len(delays), len(frames))
+	}
+
+	width, height := frames[0].Width(), frames[0].Height()
+	ins := make([]*C.VipsImage, len(frames))
+	for i, frame := range frames {
+		if frame.Width() != width || frame.Height() != height {
+			return nil, fmt.Errorf("frame %d is %dx%d, expected %dx%d", i, frame.Width(), frame.Height(), width, height)
+		}
+		ins[i] = frame.image
+	}
+
+	out, err := vipsJoinFrames(ins, delays)
+	if err != nil {
+		return nil, err
+	}
+
+	return newImageRef(out, frames[0].Format(), nil), nil
+}
+
+// ExportMultiPageTIFF combines separately generated pages into a single multi-page TIFF, e.g. to bundle
+// scanned fax pages. libvips requires all pages of a TIFF to have the same size. params control the TIFF
+// output as in Export, their Format is ignored. If params is nil, the default export params are used.
+func ExportMultiPageTIFF(pages []*ImageRef, params *ExportParams) ([]byte, error) {
+	if len(pages) == 0 {
+		return nil, errors.New("no pages to export")
+	}
+
+	width, height := pages[0].Width(), pages[0].Height()
+	ins := make([]*C.VipsImage, len(pages))
+	for i, page := range pages {
+		if page.Width() != width || page.Height() != height {
+			return nil, fmt.Errorf("page %d is %dx%d, expected %dx%d", i, page.Width(), page.Height(), width, height)
+		}
+		ins[i] = page.image
+	}
+
+	// tiffsave writes every page-height rows of the joined image as a separate page
+	out, err := vipsJoinFrames(ins, nil)
+	if err != nil {
+		return nil, err
+	}
+	joined := newImageRef(out, ImageTypeTIFF, nil)
+	defer joined.Close()
+
+	p := NewDefaultExportParams()
+	if params != nil {
+		copied := *params
+		p = &copied
+	}
+	p.Format = ImageTypeTIFF
+
+	buf, _, err := joined.Export(p)
+	return buf, err
+}
+
+// TranscodeGIFToWebP transcodes an (animated) GIF to an animated WebP. The frames are decoded sequentially
+// and streamed into the WebP encoder, so the full animation strip is never held in memory at once.
+// If params is nil, the default WebP export params are used. Only StripMetadata, Quality, Lossless, Effort
+// and Loop are applied; WebPPreset, NearLossless and Exact are ignored.
+func TranscodeGIFToWebP(buf []byte, params *ExportParams) ([]byte, error) {
+	startupIfNeeded()
+
+	if DetermineImageType(buf) != ImageTypeGIF || !IsTypeSupported(ImageTypeGIF) || !IsTypeSupported(ImageTypeWEBP) {
+		return nil, ErrUnsupportedImageFormat
+	}
+
+	if params == nil {
+		params = NewDefaultWEBPExportParams()
+	}
+
+	// a negative loop count keeps the loop count of the GIF
+	loop := -1
+	if params.Loop != nil {
+		loop = *params.Loop
+	}
+
+	return vipsTranscodeGIFToWebP(buf, params.StripMetadata, params.Quality, params.Lossless, params.Effort, loop)
+}
+
 // Metadata returns the metadata (ImageMetadata struct) of the associated ImageRef
 func (r *ImageRef) Metadata() *ImageMetadata {
 	return &ImageMetadata{
-		Format: r.Format(),
-		Width:  r.Width(),
-		Height: r.Height(),
+		Format:      r.Format(),
+		Width:       r.Width(),
+		Height:      r.Height(),
+		Bands:       r.Bands(),
+		Colorspace:  r.ColorSpace(),
+		JPEGVariant: DetermineJPEGVariant(r.buf),
 	}
 }
 
@@ -320,11 +859,64 @@ func (r *ImageRef) Height() int {
 	return int(r.image.Ysize)
 }
 
+// PageHeight returns the height of a single page for multi-page images loaded as a tall strip.
+// For single page images this is the image height.
+func (r *ImageRef) PageHeight() int {
+	return vipsGetPageHeight(r.image)
+}
+
+// Pages returns the number of pages for multi-page images loaded as a tall strip. For single page images this is 1.
+func (r *ImageRef) Pages() int {
+	return r.Height() / r.PageHeight()
+}
+
+// SetPageHeight sets the height of a single page, e.g. to treat a strip built with other operations as
+// a multi-page image. The image height must be a multiple of the page height.
+func (r *ImageRef) SetPageHeight(height int) error {
+	if height <= 0 || r.Height()%height != 0 {
+		return fmt.Errorf("page height %d does not divide the image height %d", height, r.Height())
+	}
+
+	out, err := vipsCopyImage(r.image)
+	if err != nil {
+		return err
+	}
+
+	vipsSetPageHeight(out, height)
+
+	r.setImage(out)
+	return nil
+}
+
+// ExtractPage returns the page with the given zero-based index of a multi-page image loaded as a tall strip,
+// e.g. a single page of a multi-page TIFF. The image itself is left unchanged.
+func (r *ImageRef) ExtractPage(index int) (*ImageRef, error) {
+	pageHeight := r.PageHeight()
+	if index < 0 || index >= r.Pages() {
+		return nil, fmt.Errorf("page %d is out of range, the image has %d pages", index, r.Pages())
+	}
+
+	out, err := vipsExtractArea(r.image, 0, index*pageHeight, r.Width(), pageHeight)
+	if err != nil {
+		return nil, err
+	}
+
+	return newImageRef(out, r.format, r.buf), nil
+}
+
 // Bands returns the number of bands for this image.
 func (r *ImageRef) Bands() int {
 	return int(r.image.Bands)
 }
 
+// SizeInBytes returns the size of the decoded pixels in bytes (width * height * bands * sample size),
+// e.g. to bound an in-memory image cache. libvips evaluates lazily, so this is the size the image
+// takes once materialized rather than the memory currently allocated.
+func (r *ImageRef) SizeInBytes() int64 {
+	return int64(r.image.Xsize) * int64(r.image.Ysize) * int64(r.image.Bands) *
+		int64(C.vips_format_sizeof(C.VipsBandFormat(r.image.BandFmt)))
+}
+
 // HasProfile returns if the image has an ICC profile embedded.
 func (r *ImageRef) HasProfile() bool {
 	return vipsHasICCProfile(r.image)
@@ -335,12 +927,19 @@ func (r *ImageRef) HasICCProfile() bool {
 	return r.HasProfile()
 }
 
+// ICCProfile returns a copy of the embedded ICC profile, e.g. to register it with RegisterICCProfile and
+// embed it in other images on export via ExportParams.ICCProfile.
+func (r *ImageRef) ICCProfile() ([]byte, bool) {
+	return vipsGetICCProfile(r.image)
+}
+
 // HasIPTC returns a boolean whether the image in question has IPTC data associated with it.
 func (r *ImageRef) HasIPTC() bool {
 	return vipsHasIPTC(r.image)
 }
 
-// HasAlpha returns if the image has an alpha layer.
+// HasAlpha returns if the image has an alpha layer. The interpretation is taken into account, e.g. a
+// 4 band CMYK image has no alpha while a 4 band sRGB image does.
 func (r *ImageRef) HasAlpha() bool {
 	return vipsHasAlpha(r.image)
 }
@@ -363,41 +962,149 @@ func (r *ImageRef) SetOrientation(orientation int) error {
 	return nil
 }
 
-// RemoveOrientation removes the EXIF orientation information of the image.
-func (r *ImageRef) RemoveOrientation() error {
+// WebPBackground returns the background color of an animated WebP, which is read on load and written
+// back when exporting to WebP. The canvas size needs no extra handling: libvips renders every frame onto
+// the full canvas, so Width and PageHeight are the canvas size and frame offsets are kept.
+func (r *ImageRef) WebPBackground() (ColorRGBA, bool) {
+	return vipsGetMetaWebPBackground(r.image)
+}
+
+// SetWebPBackground sets the background color written when exporting an animated WebP.
+func (r *ImageRef) SetWebPBackground(color ColorRGBA) error {
 	out, err := vipsCopyImage(r.image)
 	if err != nil {
 		return err
 	}
 
-	vipsRemoveMetaOrientation(out)
+	vipsSetMetaWebPBackground(out, color)
 
 	r.setImage(out)
 	return nil
 }
 
-// ResX returns the X resolution
-func (r *ImageRef) ResX() float64 {
-	return float64(r.image.Xres)
+// JPEGComment returns the text of the first COM marker of a JPEG image, which is read on load and written
+// back when exporting to JPEG unless StripMetadata is set.
+func (r *ImageRef) JPEGComment() (string, bool) {
+	return vipsGetMetaJPEGComment(r.image)
 }
 
-// ResY returns the Y resolution
-func (r *ImageRef) ResY() float64 {
-	return float64(r.image.Yres)
-}
+// SetJPEGComment replaces the JPEG comments of the image with the given text, an empty comment removes them.
+func (r *ImageRef) SetJPEGComment(comment string) error {
+	out, err := vipsCopyImage(r.image)
+	if err != nil {
+		return err
+	}
 
-// OffsetX returns the X offset
-func (r *ImageRef) OffsetX() int {
-	return int(r.image.Xoffset)
+	vipsSetMetaJPEGComment(out, comment)
+
+	r.setImage(out)
+	return nil
 }
 
-// OffsetY returns the Y offset
-func (r *ImageRef) OffsetY() int {
-	return int(r.image.Yoffset)
+// PNGText returns the key-value pairs of the PNG text chunks (tEXt, zTXt and iTXt) such as "Software"
+// or "Comment", which are read on load and written back when exporting to PNG unless StripMetadata is set.
+func (r *ImageRef) PNGText() map[string]string {
+	return vipsGetMetaPNGText(r.image)
 }
 
-// BandFormat returns the current band format
-func (r *ImageRef) BandFormat() BandFormat {
+// SetPNGText replaces the PNG text chunks of the image. To keep the existing chunks, add to the map
+// returned by PNGText. Keys must be 1-79 Latin-1 characters as required by PNG.
+func (r *ImageRef) SetPNGText(text map[string]string) error {
+	for key := range text {
+		if len(key) == 0 || len(key) > 79 {
+			return fmt.Errorf("invalid PNG text key %q", key)
+		}
+	}
+
+	out, err := vipsCopyImage(r.image)
+	if err != nil {
+		return err
+	}
+
+	vipsSetMetaPNGText(out, text)
+
+	r.setImage(out)
+	return nil
+}
+
+// HasField checks whether the image has the metadata field with the given libvips name, e.g. "exif-ifd3-GPSLatitude".
+func (r *ImageRef) HasField(name string) bool {
+	return vipsHasField(r.image, name)
+}
+
+// RemoveField removes a single metadata field by its libvips name and keeps all others, e.g. the GPS coordinates
+// "exif-ifd3-GPSLatitude" and "exif-ifd3-GPSLongitude" while keeping the orientation and ICC profile. EXIF fields
+// are named "exif-ifdN-Tag", where ifd0 is the main image, ifd2 the Exif and ifd3 the GPS IFD; libvips drops
+// removed EXIF tags from the EXIF data on save. Removing a field which does not exist is not an error.
+func (r *ImageRef) RemoveField(name string) error {
+	out, err := vipsCopyImage(r.image)
+	if err != nil {
+		return err
+	}
+
+	vipsRemoveField(out, name)
+
+	r.setImage(out)
+	return nil
+}
+
+// RemoveOrientation removes the EXIF orientation information of the image.
+func (r *ImageRef) RemoveOrientation() error {
+	out, err := vipsCopyImage(r.image)
+	if err != nil {
+		return err
+	}
+
+	vipsRemoveMetaOrientation(out)
+
+	r.setImage(out)
+	return nil
+}
+
+// ResX returns the X resolution
+func (r *ImageRef) ResX() float64 {
+	return float64(r.image.Xres)
+}
+
+// ResY returns the Y resolution
+func (r *ImageRef) ResY() float64 {
+	return float64(r.image.Yres)
+}
+
+// ResolutionDPI returns the horizontal and vertical resolution in dots per inch.
+// libvips stores the resolution in pixels per millimetre, see ResX and ResY.
+func (r *ImageRef) ResolutionDPI() (x, y float64) {
+	return r.ResX() * mmPerInch, r.ResY() * mmPerInch
+}
+
+// SetResolutionDPI sets the horizontal and vertical resolution in dots per inch.
+// The resolution is written by the JPEG, PNG and TIFF savers.
+func (r *ImageRef) SetResolutionDPI(x, y float64) error {
+	if x <= 0 || y <= 0 {
+		return errors.New("resolution must be positive")
+	}
+
+	out, err := vipsCopyImageResolution(r.image, x/mmPerInch, y/mmPerInch)
+	if err != nil {
+		return err
+	}
+
+	r.setImage(out)
+	return nil
+}
+
+// OffsetX returns the X offset
+func (r *ImageRef) OffsetX() int {
+	return int(r.image.Xoffset)
+}
+
+// OffsetY returns the Y offset
+func (r *ImageRef) OffsetY() int {
+	return int(r.image.Yoffset)
+}
+
+// BandFormat returns the current band format
+func (r *ImageRef) BandFormat() BandFormat {
 	return BandFormat(int(r.image.BandFmt))
 }
 
@@ -431,7 +1138,8 @@ func (r *ImageRef) Export(params *ExportParams) ([]byte, *ImageMetadata, error)
 		switch r.format {
 		case ImageTypeJPEG:
 			p = NewDefaultJPEGExportParams()
-		case ImageTypePNG:
+		case ImageTypePNG, ImageTypeQOI, ImageTypeMagick:
+			// QOI and formats only ImageMagick reads, e.g. FLIF or JPEG-LS, can't be saved, PNG keeps them lossless
 			p = NewDefaultPNGExportParams()
 		case ImageTypeWEBP:
 			p = NewDefaultWEBPExportParams()
@@ -442,6 +1150,9 @@ func (r *ImageRef) Export(params *ExportParams) ([]byte, *ImageMetadata, error)
 
 	if p.Format == ImageTypeUnknown {
 		p.Format = r.format
+		if p.Format == ImageTypeMagick && p.MagickFormat == "" {
+			p.Format = ImageTypePNG
+		}
 	}
 
 	// the exported buf is not necessarily in same format as the original buf, might default to JPEG as well.
@@ -454,6 +1165,7 @@ func (r *ImageRef) Export(params *ExportParams) ([]byte, *ImageMetadata, error)
 		Format:      format,
 		Width:       r.Width(),
 		Height:      r.Height(),
+		Bands:       r.Bands(),
 		Colorspace:  r.ColorSpace(),
 		Orientation: r.GetOrientation(),
 	}
@@ -461,6 +1173,130 @@ func (r *ImageRef) Export(params *ExportParams) ([]byte, *ImageMetadata, error)
 	return buf, metadata, nil
 }
 
+// ExportReader exports the image like Export, but returns a reader over the output. TIFF output whose
+// uncompressed pixel data is larger than spillThreshold bytes is written to a temporary file instead of
+// memory, which is removed when the reader is closed. Other formats are always encoded in memory.
+// The reader must be closed.
+func (r *ImageRef) ExportReader(params *ExportParams, spillThreshold int64) (io.ReadCloser, *ImageMetadata, error) {
+	p := params
+	if p == nil {
+		p = NewDefaultExportParams()
+	}
+
+	format := p.Format
+	if format == ImageTypeUnknown {
+		format = r.format
+	}
+
+	if format != ImageTypeTIFF || r.SizeInBytes() <= spillThreshold {
+		buf, metadata, err := r.Export(params)
+		if err != nil {
+			return nil, nil, err
+		}
+		return ioutil.NopCloser(bytes.NewReader(buf)), metadata, nil
+	}
+
+	fileParams := *p
+	fileParams.Format = format
+
+	file, err := ioutil.TempFile("", "govips-*"+format.FileExt())
+	if err != nil {
+		return nil, nil, err
+	}
+	name := file.Name()
+	file.Close()
+
+	format, err = r.exportFile(&fileParams, name)
+	if err != nil {
+		os.Remove(name)
+		return nil, nil, err
+	}
+
+	file, err = os.Open(name)
+	if err != nil {
+		os.Remove(name)
+		return nil, nil, err
+	}
+
+	metadata := &ImageMetadata{
+		Format:      format,
+		Width:       r.Width(),
+		Height:      r.Height(),
+		Bands:       r.Bands(),
+		Colorspace:  r.ColorSpace(),
+		Orientation: r.GetOrientation(),
+	}
+
+	return &tempFileReader{File: file}, metadata, nil
+}
+
+// tempFileReader removes the temporary file it reads from when closed
+type tempFileReader struct {
+	*os.File
+}
+
+func (t *tempFileReader) Close() error {
+	err := t.File.Close()
+	if removeErr := os.Remove(t.Name()); err == nil {
+		err = removeErr
+	}
+	return err
+}
+
+// ExportDataURI exports the image like Export and returns it as base64 data URI with the media type of the
+// output, e.g. for inlining small images in HTML or CSS. Export fails with ErrDataURITooLarge if the encoded
+// image is larger than maxBytes, pass 0 to disable the limit.
+func (r *ImageRef) ExportDataURI(params *ExportParams, maxBytes int) (string, error) {
+	buf, metadata, err := r.Export(params)
+	if err != nil {
+		return "", err
+	}
+
+	if maxBytes > 0 && len(buf) > maxBytes {
+		return "", fmt.Errorf("%w: %d bytes is larger than %d bytes", ErrDataURITooLarge, len(buf), maxBytes)
+	}
+
+	mime := metadata.Format.MIME()
+	if mime == "" {
+		return "", fmt.Errorf("no media type for image type %s", ImageTypes[metadata.Format])
+	}
+
+	return "data:" + mime + ";base64," + base64.StdEncoding.EncodeToString(buf), nil
+}
+
+// EncodeResult holds an encoded image along with its geometry, so it does not need to be decoded again
+// for logging or metrics. For animated output, Height is the height of a single frame.
+type EncodeResult struct {
+	Bytes  []byte
+	Width  int
+	Height int
+	Pages  int
+	Type   ImageType
+}
+
+// Encode exports the image like Export, but reports the encoded dimensions and frame count.
+func (r *ImageRef) Encode(params *ExportParams) (*EncodeResult, error) {
+	buf, metadata, err := r.Export(params)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &EncodeResult{
+		Bytes:  buf,
+		Width:  r.Width(),
+		Height: r.Height(),
+		Pages:  1,
+		Type:   metadata.Format,
+	}
+
+	if supportsAnimation(metadata.Format) {
+		result.Height = r.PageHeight()
+		result.Pages = r.Height() / result.Height
+	}
+
+	return result, nil
+}
+
 // CompositeMulti composites the given overlay image on top of the associated image with provided blending mode.
 func (r *ImageRef) CompositeMulti(ins []*ImageComposite) error {
 	out, err := vipsComposite(toVipsCompositeStructs(r, ins))
@@ -501,6 +1337,40 @@ func (r *ImageRef) ExtractBand(band int, num int) error {
 	return nil
 }
 
+// SelectBands replaces the image with the given bands in the given order, e.g. SelectBands(3, 2, 1) for a
+// false color composite of a multispectral image. Bands are numbered from 0.
+func (r *ImageRef) SelectBands(bands ...int) error {
+	if len(bands) == 0 {
+		return errors.New("no bands selected")
+	}
+
+	selected := make([]*C.VipsImage, 0, len(bands))
+	defer func() {
+		for _, band := range selected {
+			clearImage(band)
+		}
+	}()
+
+	for _, band := range bands {
+		if band < 0 || band >= r.Bands() {
+			return fmt.Errorf("band %d out of range for image with %d bands", band, r.Bands())
+		}
+
+		out, err := vipsExtractBand(r.image, band, 1)
+		if err != nil {
+			return err
+		}
+		selected = append(selected, out)
+	}
+
+	out, err := vipsBandJoin(selected)
+	if err != nil {
+		return err
+	}
+	r.setImage(out)
+	return nil
+}
+
 // BandJoin joins a set of images together, bandwise.
 func (r *ImageRef) BandJoin(images ...*ImageRef) error {
 	vipsImages := []*C.VipsImage{r.image}
@@ -540,6 +1410,21 @@ func (r *ImageRef) AddAlpha() error {
 	return nil
 }
 
+// RemoveAlpha removes the alpha channel of the associated image, without flattening. Use Flatten to
+// composite transparent areas against a background color instead.
+func (r *ImageRef) RemoveAlpha() error {
+	if !vipsHasAlpha(r.image) {
+		return nil
+	}
+
+	out, err := vipsExtractBand(r.image, 0, r.Bands()-1)
+	if err != nil {
+		return err
+	}
+	r.setImage(out)
+	return nil
+}
+
 // PremultiplyAlpha premultiplies the alpha channel.
 // See https://libvips.github.io/libvips/API/current/libvips-conversion.html#vips-premultiply
 func (r *ImageRef) PremultiplyAlpha() error {
@@ -672,6 +1557,50 @@ func (r *ImageRef) AutoRotate() error {
 	return nil
 }
 
+// exifOrientations maps the EXIF orientations to the rotation and subsequent horizontal flip which make the image upright
+var exifOrientations = map[int]struct {
+	angle Angle
+	flip  bool
+}{
+	2: {Angle0, true},
+	3: {Angle180, false},
+	4: {Angle180, true},
+	5: {Angle90, true},
+	6: {Angle90, false},
+	7: {Angle270, true},
+	8: {Angle270, false},
+}
+
+// ApplyOrientation rotates and flips the image upright according to its EXIF orientation and resets the
+// orientation to 1. Unlike AutoRotate, all eight orientations are applied, including the mirrored ones.
+// It is meant for images loaded with autorotate disabled, to show the original pixels first and correct
+// them on demand. Images without or with an invalid orientation are left unchanged.
+func (r *ImageRef) ApplyOrientation() error {
+	transform, ok := exifOrientations[r.GetOrientation()]
+	if !ok {
+		return nil
+	}
+
+	out, err := vipsRotate(r.image, transform.angle)
+	if err != nil {
+		return err
+	}
+
+	if transform.flip {
+		flipped, err := vipsFlip(out, DirectionHorizontal)
+		clearImage(out)
+		if err != nil {
+			return err
+		}
+		out = flipped
+	}
+
+	vipsSetMetaOrientation(out, 1)
+
+	r.setImage(out)
+	return nil
+}
+
 // ExtractArea crops the image to a specified area
 func (r *ImageRef) ExtractArea(left, top, width, height int) error {
 	out, err := vipsExtractArea(r.image, left, top, width, height)
@@ -682,6 +1611,65 @@ func (r *ImageRef) ExtractArea(left, top, width, height int) error {
 	return nil
 }
 
+// TileEdge controls how Tiles handles tiles at the right and bottom edges which are smaller than the tile size
+type TileEdge int
+
+// TileEdge enum
+const (
+	TileEdgeClip TileEdge = iota // edge tiles are smaller than the requested tile size
+	TileEdgePad                  // edge tiles are padded with black to the full tile size
+)
+
+// Tiles splits the image into a grid of tiles of the given size. Neighbouring tiles overlap by
+// overlap pixels. Tiles are returned row by row and the image itself is left unchanged.
+func (r *ImageRef) Tiles(tileWidth, tileHeight, overlap int, edge TileEdge) ([]*ImageRef, error) {
+	if tileWidth <= 0 || tileHeight <= 0 || overlap < 0 || overlap >= tileWidth || overlap >= tileHeight {
+		return nil, fmt.Errorf("invalid tile size %dx%d with overlap %d", tileWidth, tileHeight, overlap)
+	}
+
+	width, height := r.Width(), r.Height()
+	var tiles []*ImageRef
+
+	for top := 0; ; top += tileHeight - overlap {
+		for left := 0; ; left += tileWidth - overlap {
+			w := tileWidth
+			if left+w > width {
+				w = width - left
+			}
+			h := tileHeight
+			if top+h > height {
+				h = height - top
+			}
+
+			out, err := vipsExtractArea(r.image, left, top, w, h)
+			if err != nil {
+				return nil, err
+			}
+
+			if edge == TileEdgePad && (w < tileWidth || h < tileHeight) {
+				padded, err := vipsEmbed(out, 0, 0, tileWidth, tileHeight, ExtendBlack)
+				clearImage(out)
+				if err != nil {
+					return nil, err
+				}
+				out = padded
+			}
+
+			tiles = append(tiles, newImageRef(out, r.format, r.buf))
+
+			if left+tileWidth >= width {
+				break
+			}
+		}
+
+		if top+tileHeight >= height {
+			break
+		}
+	}
+
+	return tiles, nil
+}
+
 // RemoveICCProfile removes the ICC Profile information from the image.
 // Typically browsers and other software assume images without profile to be in the sRGB color space.
 func (r *ImageRef) RemoveICCProfile() error {
@@ -865,8 +1853,13 @@ func (r *ImageRef) DrawRect(ink ColorRGBA, left int, top int, width int, height
 	return nil
 }
 
-// Resize resizes the image based on the scale, maintaining aspect ratio
-func (r *ImageRef) Resize(scale float64, kernel Kernel) error {
+// Resize resizes the image based on the scale, maintaining aspect ratio. See WithLinearResize for resizing in
+// linear light.
+func (r *ImageRef) Resize(scale float64, kernel Kernel, opts ...ResizeOption) error {
+	if newResizeOptions(opts).linear {
+		return r.resizeLinear(scale, -1, kernel)
+	}
+
 	err := r.PremultiplyAlpha()
 	if err != nil {
 		return err
@@ -883,20 +1876,72 @@ func (r *ImageRef) Resize(scale float64, kernel Kernel) error {
 
 // ResizeWithVScale resizes the image with both horizontal as well as vertical scaling.
 // The parameters are the scaling factors.
-func (r *ImageRef) ResizeWithVScale(hScale, vScale float64, kernel Kernel) error {
+// Like Resize, alpha is premultiplied while resampling so that transparent pixels don't bleed into the edges.
+func (r *ImageRef) ResizeWithVScale(hScale, vScale float64, kernel Kernel, opts ...ResizeOption) error {
+	if newResizeOptions(opts).linear {
+		return r.resizeLinear(hScale, vScale, kernel)
+	}
+
+	err := r.PremultiplyAlpha()
+	if err != nil {
+		return err
+	}
+
 	out, err := vipsResizeWithVScale(r.image, hScale, vScale, kernel)
 	if err != nil {
 		return err
 	}
 	r.setImage(out)
+
+	return r.UnpremultiplyAlpha()
+}
+
+// resizeLinear resizes in linear light where the color space allows it, alpha is premultiplied in the process
+func (r *ImageRef) resizeLinear(scale, vscale float64, kernel Kernel) error {
+	if r.preMultiplication != nil || !canResizeLinear(r.image) {
+		if vscale > 0 {
+			return r.ResizeWithVScale(scale, vscale, kernel)
+		}
+		return r.Resize(scale, kernel)
+	}
+
+	out, err := vipsResizeLinear(r.image, scale, vscale, kernel)
+	if err != nil {
+		return err
+	}
+	r.setImage(out)
+	return nil
+}
+
+// Normalize stretches the contrast so that the darkest pixel becomes black and the brightest white.
+func (r *ImageRef) Normalize() error {
+	return r.AutoLevels(0, 0)
+}
+
+// AutoLevels stretches the contrast so that lowPercent of the pixels become black and highPercent become
+// white, e.g. AutoLevels(1, 1) to clean up scanned documents before OCR. Levels are measured on the luminance
+// and applied equally to all color bands, so colors are not shifted. Alpha is left unchanged.
+func (r *ImageRef) AutoLevels(lowPercent, highPercent float64) error {
+	if lowPercent < 0 || highPercent < 0 || lowPercent+highPercent >= 100 {
+		return fmt.Errorf("invalid auto levels percentages %f and %f", lowPercent, highPercent)
+	}
+
+	out, err := vipsAutoLevels(r.image, lowPercent, highPercent)
+	if err != nil {
+		return err
+	}
+	r.setImage(out)
 	return nil
 }
 
 // Thumbnail resizes the image to the given width and height.
-// If crop is true the returned image size will be exactly the given height and width,
-// otherwise the width and height will be within the given parameters.
-func (r *ImageRef) Thumbnail(width, height int, crop Interesting) error {
-	out, err := vipsThumbnail(r.image, width, height, crop)
+// With InterestingNone the image is resized to fit within the given width and height. Any other
+// Interesting strategy fills the box and crops the overflow, so the returned image size will be
+// exactly the given width and height: InterestingCentre keeps the centre, InterestingEntropy and
+// InterestingAttention keep the most detailed or salient region (e.g. faces), InterestingLow and
+// InterestingHigh keep the top/left or bottom/right edge. See WithLinearResize for resizing in linear light.
+func (r *ImageRef) Thumbnail(width, height int, crop Interesting, opts ...ResizeOption) error {
+	out, err := vipsThumbnail(r.image, width, height, crop, newResizeOptions(opts).linear)
 	if err != nil {
 		return err
 	}
@@ -977,17 +2022,337 @@ func (r *ImageRef) Label(labelParams *LabelParams) error {
 	return nil
 }
 
+// DrawText renders the text and composites it onto the image, e.g. for captions or watermarks. Images with an
+// alpha channel keep it, images which are not sRGB are converted to sRGB. Pass nil to use NewDefaultTextOptions.
+// Empty text leaves the image unchanged.
+func (r *ImageRef) DrawText(text string, opts *TextOptions) error {
+	if opts == nil {
+		opts = NewDefaultTextOptions()
+	}
+	if text == "" {
+		return nil
+	}
+
+	out, err := vipsDrawText(r.image, text, opts)
+	if err != nil {
+		return err
+	}
+	r.setImage(out)
+	return nil
+}
+
+// ToneMap converts a high dynamic range image, e.g. loaded from HDR or EXR, to 8-bit sRGB for display.
+// Pass nil to use NewDefaultToneMapParams.
+func (r *ImageRef) ToneMap(params *ToneMapParams) error {
+	if params == nil {
+		params = NewDefaultToneMapParams()
+	}
+
+	out, err := vipsToneMap(r.image, params)
+	if err != nil {
+		return err
+	}
+	r.setImage(out)
+	return nil
+}
+
 // ToBytes writes the image to memory in VIPs format and returns the raw bytes, useful for storage.
 func (r *ImageRef) ToBytes() ([]byte, error) {
-	var cSize C.size_t
-	cData := C.vips_image_write_to_memory(r.image, &cSize)
-	if cData == nil {
-		return nil, errors.New("failed to write image to memory")
+	return vipsWriteToMemory(r.image)
+}
+
+// RGBABytes returns the decoded pixels as contiguous 8-bit RGBA (width*height*4 bytes) along with the
+// stride in bytes, e.g. for uploading as a GPU texture. The image is converted to sRGB with alpha as needed.
+func (r *ImageRef) RGBABytes() ([]byte, int, error) {
+	rgba, err := vipsToRGBA8(r.image)
+	if err != nil {
+		return nil, 0, err
 	}
-	defer C.free(cData)
+	defer clearImage(rgba)
 
-	bytes := C.GoBytes(unsafe.Pointer(cData), C.int(cSize))
-	return bytes, nil
+	pixels, err := vipsWriteToMemory(rgba)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return pixels, int(rgba.Xsize) * 4, nil
+}
+
+// SSIM returns the mean structural similarity between the luminance of the image and other, from 1 for
+// identical images down to 0. Both images must have the same dimensions.
+func (r *ImageRef) SSIM(other *ImageRef) (float64, error) {
+	if r.Width() != other.Width() || r.Height() != other.Height() {
+		return 0, fmt.Errorf("cannot compare images of different size %dx%d and %dx%d",
+			r.Width(), r.Height(), other.Width(), other.Height())
+	}
+
+	return vipsSSIM(r.image, other.image)
+}
+
+// PixelsDifferBeyond reports whether the CIEDE2000 color difference of any pixel of a and b exceeds maxDeltaE,
+// e.g. to reject an optimized image which drifted visibly from its source. A difference of about 1 is just
+// noticeable, 2 to 3 is perceptible at a glance. Alpha and other extra bands are not compared. Both images must
+// have the same dimensions.
+func PixelsDifferBeyond(a, b *ImageRef, maxDeltaE float64) (bool, error) {
+	if a.Width() != b.Width() || a.Height() != b.Height() {
+		return false, fmt.Errorf("cannot compare images of different size %dx%d and %dx%d",
+			a.Width(), a.Height(), b.Width(), b.Height())
+	}
+
+	maxDelta, err := vipsMaxDeltaE00(a.image, b.image)
+	if err != nil {
+		return false, err
+	}
+
+	return maxDelta > maxDeltaE, nil
+}
+
+// HasNonFinite reports whether a float image contains NaN or infinite samples, which encoders handle
+// inconsistently. Integer images never do.
+func (r *ImageRef) HasNonFinite() (bool, error) {
+	if !r.isFloat() {
+		return false, nil
+	}
+
+	return vipsFindNonFinite(r.image)
+}
+
+// ReplaceNonFinite replaces NaN and infinite samples of a float image with value, e.g. 0 or a no-data
+// marker, so that they don't corrupt the output when saving as TIFF. Integer images are left unchanged.
+func (r *ImageRef) ReplaceNonFinite(value float64) error {
+	if !r.isFloat() {
+		return nil
+	}
+
+	out, err := vipsReplaceNonFinite(r.image, value)
+	if err != nil {
+		return err
+	}
+	r.setImage(out)
+	return nil
+}
+
+func (r *ImageRef) isFloat() bool {
+	format := r.BandFormat()
+	return format == BandFormatFloat || format == BandFormatDouble
+}
+
+// UniqueColors counts the distinct 8-bit RGBA colors of the image, stopping as soon as more than limit
+// colors are found. The returned bool is false if the limit was exceeded, in which case the count is limit+1.
+// E.g. UniqueColors(256) tells whether the image can be saved as a palette PNG without losing colors.
+func (r *ImageRef) UniqueColors(limit int) (int, bool, error) {
+	rgba, err := vipsToRGBA8(r.image)
+	if err != nil {
+		return 0, false, err
+	}
+	defer clearImage(rgba)
+
+	pixels, err := vipsWriteToMemory(rgba)
+	if err != nil {
+		return 0, false, err
+	}
+
+	colors := make(map[uint32]struct{})
+	for i := 0; i+4 <= len(pixels); i += 4 {
+		colors[binary.BigEndian.Uint32(pixels[i:i+4])] = struct{}{}
+		if len(colors) > limit {
+			return len(colors), false, nil
+		}
+	}
+
+	return len(colors), true, nil
+}
+
+// AverageColor returns the mean 8-bit sRGB color of the image, weighted by alpha so that transparent
+// pixels don't darken the result. A is the mean opacity.
+func (r *ImageRef) AverageColor() (ColorRGBA, error) {
+	pixels, _, _, err := r.colorSample()
+	if err != nil {
+		return ColorRGBA{}, err
+	}
+
+	var red, green, blue, alpha float64
+	for i := 0; i+4 <= len(pixels); i += 4 {
+		a := float64(pixels[i+3])
+		red += float64(pixels[i]) * a
+		green += float64(pixels[i+1]) * a
+		blue += float64(pixels[i+2]) * a
+		alpha += a
+	}
+
+	if alpha == 0 {
+		return ColorRGBA{}, nil
+	}
+
+	return ColorRGBA{
+		R: uint8(math.Round(red / alpha)),
+		G: uint8(math.Round(green / alpha)),
+		B: uint8(math.Round(blue / alpha)),
+		A: uint8(math.Round(alpha / float64(len(pixels)/4))),
+	}, nil
+}
+
+// DominantColor returns the most frequent color of the image. Colors are grouped into a histogram of
+// 16 levels per channel and the mean of the fullest bucket is returned, ignoring mostly transparent pixels.
+// A fully transparent image returns a zero ColorRGBA.
+func (r *ImageRef) DominantColor() (ColorRGBA, error) {
+	pixels, _, _, err := r.colorSample()
+	if err != nil {
+		return ColorRGBA{}, err
+	}
+
+	var counts [4096]int
+	var sums [4096][3]int
+	for i := 0; i+4 <= len(pixels); i += 4 {
+		if pixels[i+3] < 128 {
+			continue
+		}
+		bucket := int(pixels[i]>>4)<<8 | int(pixels[i+1]>>4)<<4 | int(pixels[i+2]>>4)
+		counts[bucket]++
+		sums[bucket][0] += int(pixels[i])
+		sums[bucket][1] += int(pixels[i+1])
+		sums[bucket][2] += int(pixels[i+2])
+	}
+
+	dominant := 0
+	for bucket, count := range counts {
+		if count > counts[dominant] {
+			dominant = bucket
+		}
+	}
+
+	count := counts[dominant]
+	if count == 0 {
+		return ColorRGBA{}, nil
+	}
+
+	return ColorRGBA{
+		R: uint8(sums[dominant][0] / count),
+		G: uint8(sums[dominant][1] / count),
+		B: uint8(sums[dominant][2] / count),
+		A: 255,
+	}, nil
+}
+
+// BlurHash returns the BlurHash placeholder string of the image with xComp horizontal and yComp vertical
+// components, each between 1 and 9. E.g. 4 and 3 suit landscape images. The image is reduced before encoding.
+func (r *ImageRef) BlurHash(xComp, yComp int) (string, error) {
+	pixels, width, height, err := r.colorSample()
+	if err != nil {
+		return "", err
+	}
+
+	return encodeBlurHash(pixels, width, height, xComp, yComp)
+}
+
+// colorSampleSize is the longest side images are reduced to before their colors are analyzed.
+const colorSampleSize = 100
+
+// colorSample returns the 8-bit RGBA pixels of the image reduced to at most colorSampleSize pixels per side,
+// along with the reduced dimensions.
+func (r *ImageRef) colorSample() ([]byte, int, int, error) {
+	in := r.image
+
+	longest := r.Width()
+	if r.Height() > longest {
+		longest = r.Height()
+	}
+
+	if longest > colorSampleSize {
+		resized, err := vipsResize(in, float64(colorSampleSize)/float64(longest), KernelLinear)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		defer clearImage(resized)
+		in = resized
+	}
+
+	rgba, err := vipsToRGBA8(in)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer clearImage(rgba)
+
+	pixels, err := vipsWriteToMemory(rgba)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	return pixels, int(rgba.Xsize), int(rgba.Ysize), nil
+}
+
+// ContentHash returns a hex encoded SHA-256 hash of the decoded pixels, normalized to 8-bit sRGB with alpha.
+// Two images with the same pixels have the same hash regardless of the format they were stored in.
+func (r *ImageRef) ContentHash() (string, error) {
+	rgba, err := vipsToRGBA8(r.image)
+	if err != nil {
+		return "", err
+	}
+	defer clearImage(rgba)
+
+	pixels, err := vipsWriteToMemory(rgba)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	_ = binary.Write(hash, binary.BigEndian, [2]uint32{uint32(rgba.Xsize), uint32(rgba.Ysize)})
+	hash.Write(pixels)
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// PerceptualHash returns a 64-bit difference hash (dHash) of the image. Visually similar images,
+// e.g. the same photo re-encoded in another format or quality, have hashes with a small Hamming distance.
+func (r *ImageRef) PerceptualHash() (uint64, error) {
+	const hashWidth, hashHeight = 9, 8
+
+	grey, err := vipsToColorSpace(r.image, InterpretationBW)
+	if err != nil {
+		return 0, err
+	}
+	defer clearImage(grey)
+
+	luma, err := vipsExtractBand(grey, 0, 1)
+	if err != nil {
+		return 0, err
+	}
+	defer clearImage(luma)
+
+	hScale := float64(hashWidth) / float64(luma.Xsize)
+	vScale := float64(hashHeight) / float64(luma.Ysize)
+	small, err := vipsResizeWithVScale(luma, hScale, vScale, KernelLinear)
+	if err != nil {
+		return 0, err
+	}
+	defer clearImage(small)
+
+	small8, err := vipsCast(small, BandFormatUchar)
+	if err != nil {
+		return 0, err
+	}
+	defer clearImage(small8)
+
+	if int(small8.Xsize) != hashWidth || int(small8.Ysize) != hashHeight {
+		return 0, fmt.Errorf("unexpected hash image size %dx%d", int(small8.Xsize), int(small8.Ysize))
+	}
+
+	pixels, err := vipsWriteToMemory(small8)
+	if err != nil {
+		return 0, err
+	}
+
+	var hash uint64
+	for y := 0; y < hashHeight; y++ {
+		for x := 0; x < hashWidth-1; x++ {
+			hash <<= 1
+			if pixels[y*hashWidth+x] < pixels[y*hashWidth+x+1] {
+				hash |= 1
+			}
+		}
+	}
+
+	return hash, nil
 }
 
 // ToImage converts a VIPs image to a golang image.Image object, useful for interoperability with other golang libraries
@@ -1024,32 +2389,328 @@ func (r *ImageRef) setImage(image *C.VipsImage) {
 
 func (r *ImageRef) exportBuffer(params *ExportParams) ([]byte, ImageType, error) {
 	var buf []byte
-	var err error
 
+	format, err := r.exportImage(params, func(in *C.VipsImage, format ImageType) error {
+		if encoder, ok := fallbackEncoder(format); ok {
+			var err error
+			buf, err = vipsEncodeWithGo(in, encoder, params)
+			return err
+		}
+
+		var err error
+		switch format {
+		case ImageTypeWEBP:
+			buf, err = vipsSaveWebPToBuffer(in, params.StripMetadata, params.Quality, params.Lossless, params.Effort, params.WebPPreset, params.NearLossless, params.Exact)
+		case ImageTypePNG:
+			buf, err = vipsSavePNGToBuffer(in, params.StripMetadata, params.Compression, params.Interlaced)
+		case ImageTypeTIFF:
+			buf, err = vipsSaveTIFFToBuffer(in, params.StripMetadata, params.Quality, params.Lossless, params.TiffCompression, params.Bitdepth, params.TiffSampleFormat)
+		case ImageTypeHEIF:
+			buf, err = vipsSaveHEIFToBuffer(in, params.Quality, params.Lossless, params.HeifEncoder, params.HeifSubsampleMode)
+		case ImageTypeMagick:
+			buf, err = vipsSaveMagickToBuffer(in, params.MagickFormat, params.Quality)
+		case ImageTypePNM:
+			buf, err = vipsSavePNMToBuffer(in, params.StripMetadata)
+		default:
+			if params.TargetSSIM > 0 {
+				buf, err = vipsSaveJPEGToBufferWithTargetSSIM(in, params.TargetSSIM, params.StripMetadata, params.Interlaced, params.Density, params.DensityUnit)
+			} else {
+				buf, err = vipsSaveJPEGToBuffer(in, params.Quality, params.StripMetadata, params.Interlaced, params.Density, params.DensityUnit)
+			}
+		}
+		return err
+	})
+
+	if err != nil {
+		return nil, ImageTypeUnknown, err
+	}
+
+	return buf, format, nil
+}
+
+// exportFile saves the image to the given file. Only TIFF output is supported.
+func (r *ImageRef) exportFile(params *ExportParams, file string) (ImageType, error) {
+	return r.exportImage(params, func(in *C.VipsImage, format ImageType) error {
+		if format != ImageTypeTIFF {
+			return fmt.Errorf("cannot save %#v to a file", ImageTypes[format])
+		}
+		return vipsSaveTIFFToFile(in, file, params.StripMetadata, params.Quality, params.Lossless, params.TiffCompression, params.Bitdepth, params.TiffSampleFormat)
+	})
+}
+
+// exportImage applies the export params which are independent of the output format and passes the
+// resulting image to save along with the format it is saved as.
+func (r *ImageRef) exportImage(params *ExportParams, save func(in *C.VipsImage, format ImageType) error) (ImageType, error) {
 	format := params.Format
-	if format != ImageTypeUnknown && !IsTypeSupported(format) {
-		return nil, ImageTypeUnknown, fmt.Errorf("cannot save to %#v", ImageTypes[format])
+	_, fallback := fallbackEncoder(format)
+	if format != ImageTypeUnknown && !IsTypeSupported(format) && !fallback {
+		return ImageTypeUnknown, fmt.Errorf("cannot save to %#v", ImageTypes[format])
 	}
 
-	switch format {
-	case ImageTypeWEBP:
-		buf, err = vipsSaveWebPToBuffer(r.image, params.StripMetadata, params.Quality, params.Lossless, params.Effort)
-	case ImageTypePNG:
-		buf, err = vipsSavePNGToBuffer(r.image, params.StripMetadata, params.Compression, params.Interlaced)
-	case ImageTypeTIFF:
-		buf, err = vipsSaveTIFFToBuffer(r.image, params.StripMetadata, params.Quality, params.Lossless)
-	case ImageTypeHEIF:
-		buf, err = vipsSaveHEIFToBuffer(r.image, params.Quality, params.Lossless)
-	default:
-		format = ImageTypeJPEG
-		buf, err = vipsSaveJPEGToBuffer(r.image, params.Quality, params.StripMetadata, params.Interlaced)
+	in := r.image
+
+	if params.MaxMetadataBytes > 0 {
+		trimmed, err := vipsCopyImage(in)
+		if err != nil {
+			return ImageTypeUnknown, err
+		}
+		defer clearImage(trimmed)
+
+		vipsRemoveMetadataLargerThan(trimmed, params.MaxMetadataBytes)
+		in = trimmed
+	}
+
+	if params.StripEXIFThumbnail {
+		stripped, err := vipsCopyImage(in)
+		if err != nil {
+			return ImageTypeUnknown, err
+		}
+		defer clearImage(stripped)
+
+		vipsRemoveEXIFThumbnail(stripped)
+		in = stripped
 	}
 
+	if params.ICCProfile != "" {
+		profilePath, err := iccProfilePath(params.ICCProfile)
+		if err != nil {
+			return ImageTypeUnknown, err
+		}
+
+		transformed, err := vipsTransformToICCProfile(in, profilePath, params.RenderingIntent)
+		if err != nil {
+			return ImageTypeUnknown, err
+		}
+		defer clearImage(transformed)
+		in = transformed
+	}
+
+	if params.RenderingIntent != RenderingIntentDefault && vipsHasICCProfile(in) {
+		tagged, err := vipsCopyImage(in)
+		if err != nil {
+			return ImageTypeUnknown, err
+		}
+		defer clearImage(tagged)
+
+		vipsSetICCRenderingIntent(tagged, params.RenderingIntent)
+		in = tagged
+	}
+
+	// formats without an alpha channel are flattened against the requested background,
+	// otherwise libvips composites transparent areas against black
+	if params.Background != nil && !supportsAlpha(format) && vipsHasAlpha(in) {
+		flattened, err := vipsFlatten(in, params.Background)
+		if err != nil {
+			return ImageTypeUnknown, err
+		}
+		defer clearImage(flattened)
+		in = flattened
+	}
+
+	if supportsAnimation(format) && params.Loop != nil {
+		looped, err := vipsCopyImage(in)
+		if err != nil {
+			return ImageTypeUnknown, err
+		}
+		defer clearImage(looped)
+
+		vipsSetMetaLoop(looped, *params.Loop)
+		in = looped
+	}
+
+	// a registered Go encoder saves the image as the requested type
+	if !fallback {
+		format = exportFormat(format)
+	}
+
+	// savers would otherwise silently drop the extra bands of multispectral images
+	if maxBands := maxExportBands(format); maxBands > 0 && int(in.Bands) > maxBands {
+		return ImageTypeUnknown, fmt.Errorf("%w: %d bands cannot be saved as %s", ErrTooManyBands, in.Bands, ImageTypes[format])
+	}
+
+	if err := save(in, format); err != nil {
+		return ImageTypeUnknown, err
+	}
+
+	return format, nil
+}
+
+// exportFormat returns the format an image is saved as. Types without a saver are exported as JPEG.
+func exportFormat(imageType ImageType) ImageType {
+	switch imageType {
+	case ImageTypeWEBP, ImageTypePNG, ImageTypeTIFF, ImageTypeHEIF, ImageTypeMagick, ImageTypePNM:
+		return imageType
+	}
+	return ImageTypeJPEG
+}
+
+// maxExportBands returns the maximum number of bands the saver for the given image type can store,
+// 0 means any number of bands (TIFF).
+func maxExportBands(imageType ImageType) int {
+	switch imageType {
+	case ImageTypeJPEG, ImageTypePNG, ImageTypeWEBP, ImageTypeHEIF, ImageTypePNM:
+		return 4
+	}
+	return 0
+}
+
+// supportsAlpha reports whether the saver used for the given image type can store an alpha channel.
+// Unknown types are exported as JPEG and therefore have no alpha support. Magick is passed the alpha
+// channel and leaves it to the coder, which drops it if the format cannot store it.
+func supportsAlpha(imageType ImageType) bool {
+	switch imageType {
+	case ImageTypeWEBP, ImageTypePNG, ImageTypeTIFF, ImageTypeHEIF, ImageTypeMagick:
+		return true
+	}
+	return false
+}
+
+// vipsEncodeWithGo encodes the image with a Go encoder, which is passed the pixels as 8-bit sRGB with alpha
+func vipsEncodeWithGo(in *C.VipsImage, encoder Encoder, params *ExportParams) ([]byte, error) {
+	rgba, err := vipsToRGBA8(in)
 	if err != nil {
-		return nil, ImageTypeUnknown, err
+		return nil, err
 	}
+	defer clearImage(rgba)
 
-	return buf, format, nil
+	pixels, err := vipsWriteToMemory(rgba)
+	if err != nil {
+		return nil, err
+	}
+
+	img := &image.NRGBA{
+		Pix:    pixels,
+		Stride: int(rgba.Xsize) * 4,
+		Rect:   image.Rect(0, 0, int(rgba.Xsize), int(rgba.Ysize)),
+	}
+
+	var buf bytes.Buffer
+	if err := encoder(&buf, img, params); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// vipsToRGBA8 returns a copy of the image converted to 4 band, 8-bit sRGB
+func vipsToRGBA8(in *C.VipsImage) (*C.VipsImage, error) {
+	srgb, err := vipsToColorSpace(in, InterpretationSRGB)
+	if err != nil {
+		return nil, err
+	}
+
+	if !vipsHasAlpha(srgb) {
+		withAlpha, err := vipsAddAlpha(srgb)
+		clearImage(srgb)
+		if err != nil {
+			return nil, err
+		}
+		srgb = withAlpha
+	}
+
+	if BandFormat(srgb.BandFmt) == BandFormatUchar {
+		return srgb, nil
+	}
+
+	out, err := vipsCast(srgb, BandFormatUchar)
+	clearImage(srgb)
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+func vipsCopyImageMemory(in *C.VipsImage) (*C.VipsImage, error) {
+	incOpCounter("copy_memory")
+	var out *C.VipsImage
+
+	if err := C.copy_image_memory(in, &out); err != 0 {
+		return nil, handleImageError(out)
+	}
+
+	return out, nil
+}
+
+// vipsCopyImagePrivate returns a lazy copy of the image which, unlike vipsCopyImage, is not shared via the
+// operation cache
+func vipsCopyImagePrivate(in *C.VipsImage) (*C.VipsImage, error) {
+	incOpCounter("copy_private")
+	var out *C.VipsImage
+
+	if err := C.copy_image_private(in, &out); err != 0 {
+		return nil, handleImageError(out)
+	}
+
+	return out, nil
+}
+
+// vipsCopyImageMemoryContext is vipsCopyImageMemory, but sets the kill flag of a private copy of the image
+// when the context is done, which makes libvips abort the evaluation at the next tile. The image itself may be
+// shared via the operation cache, so it is left untouched.
+func vipsCopyImageMemoryContext(ctx context.Context, in *C.VipsImage) (*C.VipsImage, error) {
+	private, err := vipsCopyImagePrivate(in)
+	if err != nil {
+		return nil, err
+	}
+	defer clearImage(private)
+
+	// a context which is already done kills the copy before the evaluation starts
+	if ctx.Err() != nil {
+		C.vips_image_set_kill(private, C.gboolean(1))
+	}
+
+	done := make(chan struct{})
+	killed := make(chan bool, 1)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			C.vips_image_set_kill(private, C.gboolean(1))
+			killed <- true
+		case <-done:
+			killed <- false
+		}
+	}()
+
+	out, err := vipsCopyImageMemory(private)
+	close(done)
+
+	if <-killed && err != nil {
+		return nil, ctx.Err()
+	}
+
+	return out, err
+}
+
+func vipsImageFromMemory(data []byte, width, height, bands int, format BandFormat) (*C.VipsImage, error) {
+	incOpCounter("new_from_memory")
+	var out *C.VipsImage
+
+	if err := C.image_new_from_memory(unsafe.Pointer(&data[0]), C.size_t(len(data)), C.int(width), C.int(height),
+		C.int(bands), C.VipsBandFormat(format), &out); err != 0 {
+		return nil, handleImageError(out)
+	}
+
+	return out, nil
+}
+
+func vipsWriteToMemory(in *C.VipsImage) ([]byte, error) {
+	var cSize C.size_t
+	cData := C.vips_image_write_to_memory(in, &cSize)
+	if cData == nil {
+		return nil, errors.New("failed to write image to memory")
+	}
+	defer C.free(cData)
+
+	bytes := C.GoBytes(unsafe.Pointer(cData), C.int(cSize))
+	return bytes, nil
+}
+
+// supportsAnimation reports whether the saver used for the given image type writes multi-page
+// images as an animation rather than a single tall image.
+func supportsAnimation(imageType ImageType) bool {
+	return imageType == ImageTypeWEBP
 }
 
 ///////////////
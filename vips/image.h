@@ -6,3 +6,8 @@
 int has_alpha_channel(VipsImage *image);
 
 void clear_image(VipsImage **image);
+
+int copy_image_memory(VipsImage *in, VipsImage **out);
+int copy_image_private(VipsImage *in, VipsImage **out);
+
+int image_new_from_memory(const void *data, size_t len, int width, int height, int bands, VipsBandFormat format, VipsImage **out);
@@ -523,7 +523,11 @@ func TestImage_Flatten(t *testing.T) {
 func TestImage_Tiff(t *testing.T) {
 	goldenTest(t, resources+"tif.tif", func(img *ImageRef) error {
 		return img.OptimizeICCProfile()
-	}, nil, nil)
+	}, func(result *ImageRef) {
+		x, y := result.ResolutionDPI()
+		assert.InDelta(t, 72, x, 0.01)
+		assert.InDelta(t, 72, y, 0.01)
+	}, nil)
 }
 
 func goldenTest(t *testing.T, file string, exec func(img *ImageRef) error, validate func(img *ImageRef), params *ExportParams) []byte {
@@ -2,14 +2,28 @@ package vips
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/png"
+	"io"
 	"io/ioutil"
+	"math/bits"
 	"os"
 	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/image/bmp"
 )
 
 func TestMain(m *testing.M) {
@@ -367,6 +381,110 @@ func TestImageRef_RemoveMetadata__RetainsProfile(t *testing.T) {
 	assert.True(t, image.HasICCProfile())
 }
 
+func TestImageRef_ICCProfile(t *testing.T) {
+	Startup(nil)
+
+	image, err := NewImageFromFile(resources + "jpg-24bit-icc-adobe-rgb.jpg")
+	require.NoError(t, err)
+
+	profile, ok := image.ICCProfile()
+	require.True(t, ok)
+	require.True(t, len(profile) > 128)
+	assert.Equal(t, "acsp", string(profile[36:40]))
+
+	sibling, err := NewImageFromFile(resources + "png-24bit.png")
+	require.NoError(t, err)
+	_, ok = sibling.ICCProfile()
+	assert.False(t, ok)
+
+	require.NoError(t, RegisterICCProfile("source-profile", profile))
+	params := NewDefaultJPEGExportParams()
+	params.ICCProfile = "source-profile"
+	buf, _, err := sibling.Export(params)
+	require.NoError(t, err)
+
+	embedded, err := NewImageFromBuffer(buf)
+	require.NoError(t, err)
+	embeddedProfile, ok := embedded.ICCProfile()
+	require.True(t, ok)
+	assert.Equal(t, profile, embeddedProfile)
+}
+
+func TestImageRef_RemoveField(t *testing.T) {
+	Startup(nil)
+
+	image, err := NewImageFromFile(resources + "orientation-issue-1.jpg")
+	require.NoError(t, err)
+	require.True(t, image.HasField("exif-ifd3-GPSLatitude"))
+	orientation := image.GetOrientation()
+
+	for _, field := range []string{"exif-ifd3-GPSLatitudeRef", "exif-ifd3-GPSLatitude", "exif-ifd3-GPSLongitudeRef", "exif-ifd3-GPSLongitude"} {
+		require.NoError(t, image.RemoveField(field))
+		assert.False(t, image.HasField(field))
+	}
+	require.NoError(t, image.RemoveField("no-such-field"))
+
+	buf, _, err := image.Export(NewDefaultJPEGExportParams())
+	require.NoError(t, err)
+
+	exported, err := NewImageFromBuffer(buf)
+	require.NoError(t, err)
+	assert.False(t, exported.HasField("exif-ifd3-GPSLatitude"))
+	assert.False(t, exported.HasField("exif-ifd3-GPSLongitude"))
+	assert.Equal(t, orientation, exported.GetOrientation())
+}
+
+func TestImageRef_ApplyOrientation(t *testing.T) {
+	Startup(nil)
+
+	src, err := NewImageFromFile(resources + "png-8bit.png")
+	require.NoError(t, err)
+
+	for orientation := 1; orientation <= 8; orientation++ {
+		img, err := src.Copy()
+		require.NoError(t, err)
+		require.NoError(t, img.SetOrientation(orientation))
+
+		require.NoError(t, img.ApplyOrientation())
+		assert.Equal(t, 1, img.GetOrientation())
+		if orientation >= 5 {
+			assert.Equal(t, 150, img.Width(), "orientation %d", orientation)
+			assert.Equal(t, 200, img.Height(), "orientation %d", orientation)
+		} else {
+			assert.Equal(t, 200, img.Width(), "orientation %d", orientation)
+			assert.Equal(t, 150, img.Height(), "orientation %d", orientation)
+		}
+	}
+
+	mirrored, err := src.Copy()
+	require.NoError(t, err)
+	require.NoError(t, mirrored.SetOrientation(2))
+	require.NoError(t, mirrored.ApplyOrientation())
+
+	flipped, err := src.Copy()
+	require.NoError(t, err)
+	require.NoError(t, flipped.Flip(DirectionHorizontal))
+
+	mirroredBytes, err := mirrored.ToBytes()
+	require.NoError(t, err)
+	flippedBytes, err := flipped.ToBytes()
+	require.NoError(t, err)
+	assert.Equal(t, flippedBytes, mirroredBytes)
+}
+
+func TestImageRef_ApplyOrientation__Unrotated(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources+"jpg-orientation-6.jpg", AutorotateParamImportOption(false))
+	require.NoError(t, err)
+	width, height := img.Width(), img.Height()
+
+	require.NoError(t, img.ApplyOrientation())
+	assert.Equal(t, 1, img.GetOrientation())
+	assert.Equal(t, height, img.Width())
+	assert.Equal(t, width, img.Height())
+}
+
 func TestImageRef_RemoveMetadata__RetainsOrientation(t *testing.T) {
 	Startup(nil)
 
@@ -460,6 +578,42 @@ func TestImageRef_Label(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestImageRef_DrawText(t *testing.T) {
+	Startup(nil)
+
+	image, err := NewImageFromFile(resources + "png-8bit+alpha.png")
+	require.NoError(t, err)
+	width, height, bands := image.Width(), image.Height(), image.Bands()
+	before, err := image.AverageColor()
+	require.NoError(t, err)
+
+	opts := NewDefaultTextOptions()
+	opts.Size = 40
+	opts.Width = width
+	opts.X, opts.Y = 10, 10
+	err = image.DrawText("govips <&> text", opts)
+	require.NoError(t, err)
+
+	assert.Equal(t, width, image.Width())
+	assert.Equal(t, height, image.Height())
+	assert.Equal(t, bands, image.Bands())
+	after, err := image.AverageColor()
+	require.NoError(t, err)
+	assert.NotEqual(t, before, after)
+
+	image, err = NewImageFromFile(resources + "jpg-24bit.jpg")
+	require.NoError(t, err)
+	require.NoError(t, image.DrawText("caption", nil))
+	assert.Equal(t, 3, image.Bands())
+}
+
+func Test_textFont(t *testing.T) {
+	assert.Equal(t, DefaultFont, textFont("", 0))
+	assert.Equal(t, "sans 24", textFont("", 24))
+	assert.Equal(t, "serif bold 12", textFont("serif bold 30", 12))
+	assert.Equal(t, "serif bold 12", textFont("serif bold", 12))
+}
+
 func TestImageRef_Composite(t *testing.T) {
 	Startup(nil)
 
@@ -685,6 +839,1756 @@ func TestXYZ(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestImageRef_Export__FlattenBackground(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "png-24bit+alpha.png")
+	require.NoError(t, err)
+	require.True(t, img.HasAlpha())
+
+	params := NewDefaultJPEGExportParams()
+	params.Background = &Color{R: 255, G: 255, B: 255}
+	buf, metadata, err := img.Export(params)
+	require.NoError(t, err)
+	assert.Equal(t, ImageTypeJPEG, metadata.Format)
+	assert.True(t, img.HasAlpha(), "source image is left untouched")
+
+	result, err := NewImageFromBuffer(buf)
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.Bands())
+}
+
+func TestLoadGIFFrames(t *testing.T) {
+	Startup(nil)
+
+	anim := &gif.GIF{}
+	for i := 0; i < 3; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, 16, 8), palette.Plan9)
+		frame.SetColorIndex(i, i, uint8(i+1))
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, 10*(i+1))
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, gif.EncodeAll(&buf, anim))
+
+	frames, err := LoadGIFFrames(buf.Bytes())
+	require.NoError(t, err)
+	require.Len(t, frames, 3)
+
+	for i, frame := range frames {
+		assert.Equal(t, 16, frame.Image.Width())
+		assert.Equal(t, 8, frame.Image.Height())
+		assert.Equal(t, 100*(i+1), frame.Delay)
+	}
+}
+
+func TestLoadGIFFrames__NotGIF(t *testing.T) {
+	Startup(nil)
+
+	raw, err := ioutil.ReadFile(resources + "png-24bit.png")
+	require.NoError(t, err)
+
+	_, err = LoadGIFFrames(raw)
+	assert.Equal(t, ErrUnsupportedImageFormat, err)
+}
+
+func TestLoadFirstFrame(t *testing.T) {
+	Startup(nil)
+
+	raw, err := ioutil.ReadFile(resources + "webp-animated+alpha.webp")
+	require.NoError(t, err)
+
+	all, err := NewImageFromBuffer(raw, NParamImportOption(-1))
+	require.NoError(t, err)
+	require.Greater(t, all.Height(), all.PageHeight())
+
+	poster, err := LoadFirstFrame(raw, NParamImportOption(-1))
+	require.NoError(t, err)
+	assert.Equal(t, all.PageHeight(), poster.Height())
+	assert.Equal(t, all.Width(), poster.Width())
+}
+
+func TestJoinFramesToStrip(t *testing.T) {
+	Startup(nil)
+
+	var frames []*ImageRef
+	for i := 0; i < 3; i++ {
+		frame, err := NewImageFromFile(resources + "png-24bit.png")
+		require.NoError(t, err)
+		frames = append(frames, frame)
+	}
+
+	strip, err := JoinFramesToStrip(frames, []int{100, 200, 300})
+	require.NoError(t, err)
+	assert.Equal(t, frames[0].Width(), strip.Width())
+	assert.Equal(t, 3*frames[0].Height(), strip.Height())
+	assert.Equal(t, frames[0].Height(), strip.PageHeight())
+	assert.Equal(t, []int{100, 200, 300}, vipsGetMetaDelay(strip.image))
+
+	buf, _, err := strip.Export(NewDefaultWEBPExportParams())
+	require.NoError(t, err)
+
+	animated, err := NewImageFromBuffer(buf, NParamImportOption(-1))
+	require.NoError(t, err)
+	assert.Equal(t, frames[0].Height(), animated.PageHeight())
+	assert.Equal(t, strip.Height(), animated.Height())
+
+	_, err = JoinFramesToStrip(frames, []int{100})
+	assert.Error(t, err)
+}
+
+func TestImageRef_WebP__DimensionExceeded(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "png-24bit.png")
+	require.NoError(t, err)
+
+	err = img.Embed(0, 0, 16384, 16, ExtendBlack)
+	require.NoError(t, err)
+
+	_, _, err = img.Export(NewDefaultWEBPExportParams())
+	assert.Equal(t, ErrWebPDimensionExceeded, err)
+}
+
+func TestImageRef_ContentHash(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "png-24bit.png")
+	require.NoError(t, err)
+
+	params := NewDefaultWEBPExportParams()
+	params.Lossless = true
+	buf, _, err := img.Export(params)
+	require.NoError(t, err)
+
+	reencoded, err := NewImageFromBuffer(buf)
+	require.NoError(t, err)
+
+	hash1, err := img.ContentHash()
+	require.NoError(t, err)
+	hash2, err := reencoded.ContentHash()
+	require.NoError(t, err)
+	assert.Equal(t, hash1, hash2)
+	assert.Len(t, hash1, 64)
+}
+
+func TestImageRef_PerceptualHash(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "jpg-24bit.jpg")
+	require.NoError(t, err)
+
+	params := NewDefaultJPEGExportParams()
+	params.Quality = 40
+	buf, _, err := img.Export(params)
+	require.NoError(t, err)
+
+	reencoded, err := NewImageFromBuffer(buf)
+	require.NoError(t, err)
+
+	hash1, err := img.PerceptualHash()
+	require.NoError(t, err)
+	hash2, err := reencoded.PerceptualHash()
+	require.NoError(t, err)
+
+	assert.LessOrEqual(t, bits.OnesCount64(hash1^hash2), 5)
+}
+
+func TestImageRef_ResolutionDPI(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "jpg-24bit.jpg")
+	require.NoError(t, err)
+
+	err = img.SetResolutionDPI(300, 150)
+	require.NoError(t, err)
+
+	x, y := img.ResolutionDPI()
+	assert.InDelta(t, 300, x, 0.001)
+	assert.InDelta(t, 150, y, 0.001)
+
+	for _, params := range []*ExportParams{NewDefaultJPEGExportParams(), NewDefaultPNGExportParams(), {Format: ImageTypeTIFF}} {
+		buf, _, err := img.Export(params)
+		require.NoError(t, err)
+
+		result, err := NewImageFromBuffer(buf)
+		require.NoError(t, err)
+
+		x, y := result.ResolutionDPI()
+		assert.InDelta(t, 300, x, 0.5, ImageTypes[params.Format])
+		assert.InDelta(t, 150, y, 0.5, ImageTypes[params.Format])
+	}
+}
+
+func TestLoadPDFPages(t *testing.T) {
+	Startup(nil)
+
+	raw, err := ioutil.ReadFile(resources + "pdf.pdf")
+	require.NoError(t, err)
+
+	img, pageHeight, err := LoadPDFPages(raw, 0, 1)
+	require.NoError(t, err)
+	require.NotNil(t, img)
+	assert.Equal(t, img.Height(), pageHeight)
+
+	_, _, err = LoadPDFPages(raw, 1, 1)
+	assert.Error(t, err)
+}
+
+func TestLoadPDFAllPages(t *testing.T) {
+	Startup(nil)
+
+	raw, err := ioutil.ReadFile(resources + "pdf.pdf")
+	require.NoError(t, err)
+
+	img, pageHeight, err := LoadPDFAllPages(raw)
+	require.NoError(t, err)
+	assert.Equal(t, img.PageHeight(), pageHeight)
+	assert.Equal(t, 0, img.Height()%pageHeight)
+
+	first, firstHeight, err := LoadPDFPages(raw, 0, 1)
+	require.NoError(t, err)
+	assert.Equal(t, first.Width(), img.Width())
+	assert.Equal(t, firstHeight, pageHeight)
+
+	png, err := ioutil.ReadFile(resources + "png-8bit.png")
+	require.NoError(t, err)
+	_, _, err = LoadPDFAllPages(png)
+	assert.Equal(t, ErrUnsupportedImageFormat, err)
+}
+
+func TestImageRef_Magick__InvalidFormat(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "png-24bit.png")
+	require.NoError(t, err)
+
+	if !IsTypeSupported(ImageTypeMagick) {
+		t.Skip("magick not supported")
+	}
+
+	_, _, err = img.Export(&ExportParams{Format: ImageTypeMagick, MagickFormat: "../dds"})
+	assert.Error(t, err)
+}
+
+func TestImageRef_Magick__UnavailableCoder(t *testing.T) {
+	Startup(nil)
+
+	if !hasOperation("magicksave_buffer") {
+		t.Skip("magicksave not supported")
+	}
+
+	img, err := NewImageFromFile(resources + "png-24bit.png")
+	require.NoError(t, err)
+
+	_, _, err = img.Export(&ExportParams{Format: ImageTypeMagick, MagickFormat: "NOSUCHCODER"})
+	assert.True(t, errors.Is(err, ErrUnsupportedImageFormat))
+}
+
+func TestImageRef_Magick__BMP(t *testing.T) {
+	Startup(nil)
+
+	if !hasOperation("magicksave_buffer") {
+		t.Skip("magicksave not supported")
+	}
+
+	img, err := NewImageFromFile(resources + "png-24bit.png")
+	require.NoError(t, err)
+
+	buf, metadata, err := img.Export(&ExportParams{Format: ImageTypeMagick, MagickFormat: "BMP"})
+	require.NoError(t, err)
+	assert.Equal(t, ImageTypeMagick, metadata.Format)
+	assert.Equal(t, ImageTypeBMP, DetermineImageType(buf))
+
+	config, err := bmp.DecodeConfig(bytes.NewReader(buf))
+	require.NoError(t, err)
+	assert.Equal(t, img.Width(), config.Width)
+	assert.Equal(t, img.Height(), config.Height)
+}
+
+func TestImageRef_Magick__KeepsAlpha(t *testing.T) {
+	Startup(nil)
+
+	if !hasOperation("magicksave_buffer") {
+		t.Skip("magicksave not supported")
+	}
+
+	img, err := NewImageFromFile(resources + "png-24bit+alpha.png")
+	require.NoError(t, err)
+	require.True(t, img.HasAlpha())
+
+	// PAM stores alpha, so the background must not be flattened into the image
+	buf, _, err := img.Export(&ExportParams{Format: ImageTypeMagick, MagickFormat: "PAM", Background: &Color{R: 255, G: 255, B: 255}})
+	require.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(buf, []byte("P7")))
+	assert.Contains(t, string(buf[:128]), "TUPLTYPE RGB_ALPHA")
+}
+
+func TestImageRef_Magick__ExportDefaultsToPNG(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "png-24bit.png")
+	require.NoError(t, err)
+
+	// as loaded from FLIF or JPEG-LS, which have no saver
+	img.format = ImageTypeMagick
+
+	buf, metadata, err := img.Export(nil)
+	require.NoError(t, err)
+	assert.Equal(t, ImageTypePNG, metadata.Format)
+	assert.Equal(t, ImageTypePNG, DetermineImageType(buf))
+
+	buf, metadata, err = img.Export(&ExportParams{Quality: 80})
+	require.NoError(t, err)
+	assert.Equal(t, ImageTypePNG, metadata.Format)
+	assert.Equal(t, ImageTypePNG, DetermineImageType(buf))
+}
+
+func TestImageRef_ColorspaceImportOption(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources+"jpg-32bit-cmyk-icc-swop.jpg", ColorspaceImportOption(InterpretationSRGB))
+	require.NoError(t, err)
+
+	assert.Equal(t, InterpretationSRGB, img.Interpretation())
+	assert.Equal(t, 3, img.Bands())
+}
+
+func TestImageRef_Export__MaxMetadataBytes(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "jpg-24bit-icc-adobe-rgb.jpg")
+	require.NoError(t, err)
+	require.True(t, img.HasICCProfile())
+
+	params := NewDefaultJPEGExportParams()
+	params.MaxMetadataBytes = 64
+	buf, _, err := img.Export(params)
+	require.NoError(t, err)
+	assert.True(t, img.HasICCProfile(), "source image is left untouched")
+
+	result, err := NewImageFromBuffer(buf)
+	require.NoError(t, err)
+	assert.False(t, result.HasICCProfile())
+}
+
+func TestTranscodeGIFToWebP(t *testing.T) {
+	Startup(nil)
+
+	anim := &gif.GIF{}
+	for i := 0; i < 4; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, 32, 32), palette.Plan9)
+		frame.SetColorIndex(i, i, uint8(i+1))
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, 5)
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, gif.EncodeAll(&buf, anim))
+
+	webp, err := TranscodeGIFToWebP(buf.Bytes(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, ImageTypeWEBP, DetermineImageType(webp))
+
+	result, err := NewImageFromBuffer(webp)
+	require.NoError(t, err)
+	assert.Equal(t, 32, result.Width())
+	assert.Equal(t, 32, result.Height())
+}
+
+func TestTranscodeGIFToWebP__DimensionExceeded(t *testing.T) {
+	Startup(nil)
+
+	anim := &gif.GIF{
+		Image:  []*image.Paletted{image.NewPaletted(image.Rect(0, 0, 16, 16), palette.Plan9)},
+		Delay:  []int{5},
+		Config: image.Config{Width: 16384, Height: 16},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, gif.EncodeAll(&buf, anim))
+
+	_, err := TranscodeGIFToWebP(buf.Bytes(), nil)
+	assert.Equal(t, ErrWebPDimensionExceeded, err)
+}
+
+func TestImageRef_RawDecodeImportOption(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources+"jpg-32bit-cmyk-icc-swop.jpg",
+		ColorspaceImportOption(InterpretationSRGB), RawDecodeImportOption(true))
+	require.NoError(t, err)
+	assert.Equal(t, InterpretationCMYK, img.Interpretation())
+	assert.Equal(t, 4, img.Bands())
+
+	raw, err := NewImageFromFile(resources+"jpg-32bit-cmyk-icc-swop.jpg", RawDecodeImportOption(true))
+	require.NoError(t, err)
+	rawPixels, err := raw.ToBytes()
+	require.NoError(t, err)
+
+	img, err = NewImageFromFile(resources+"jpg-32bit-cmyk-icc-swop.jpg", RawDecodeImportOption(true),
+		InvertedCMYKImportOption(true), ProcessingPrecisionImportOption(ProcessingPrecisionFloat))
+	require.NoError(t, err)
+	assert.Equal(t, BandFormatUchar, img.BandFormat())
+
+	pixels, err := img.ToBytes()
+	require.NoError(t, err)
+	assert.Equal(t, rawPixels, pixels)
+}
+
+func TestImageRef_Encode(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "png-24bit.png")
+	require.NoError(t, err)
+
+	result, err := img.Encode(NewDefaultJPEGExportParams())
+	require.NoError(t, err)
+	assert.NotEmpty(t, result.Bytes)
+	assert.Equal(t, ImageTypeJPEG, result.Type)
+	assert.Equal(t, img.Width(), result.Width)
+	assert.Equal(t, img.Height(), result.Height)
+	assert.Equal(t, 1, result.Pages)
+}
+
+func TestImageRef_TIFF__CCITTFax4(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "png-1bit.png")
+	require.NoError(t, err)
+
+	buf, _, err := img.Export(&ExportParams{
+		Format:          ImageTypeTIFF,
+		TiffCompression: TiffCompressionCCITTFax4,
+		Bitdepth:        1,
+	})
+	require.NoError(t, err)
+
+	uncompressed, _, err := img.Export(&ExportParams{Format: ImageTypeTIFF, Lossless: true})
+	require.NoError(t, err)
+	assert.Less(t, len(buf), len(uncompressed))
+
+	result, err := NewImageFromBuffer(buf)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Bands())
+	assert.Equal(t, img.Width(), result.Width())
+}
+
+func TestImageRef_TIFF__SampleFormat(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "png-24bit.png")
+	require.NoError(t, err)
+
+	err = img.Linear1(0.01, 0.5)
+	require.NoError(t, err)
+	require.Equal(t, BandFormatFloat, img.BandFormat())
+
+	formats := map[TiffSampleFormat]BandFormat{
+		TiffSampleFormatUint8:   BandFormatUchar,
+		TiffSampleFormatUint16:  BandFormatUshort,
+		TiffSampleFormatFloat32: BandFormatFloat,
+	}
+
+	for sampleFormat, bandFormat := range formats {
+		buf, _, err := img.Export(&ExportParams{
+			Format:           ImageTypeTIFF,
+			Lossless:         true,
+			TiffSampleFormat: sampleFormat,
+		})
+		require.NoError(t, err)
+
+		result, err := NewImageFromBuffer(buf, RawDecodeImportOption(true))
+		require.NoError(t, err)
+		assert.Equal(t, bandFormat, result.BandFormat())
+	}
+}
+
+func TestImageRef_ReplaceNonFinite(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "png-24bit.png")
+	require.NoError(t, err)
+
+	found, err := img.HasNonFinite()
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	// overflows the float samples to infinity
+	err = img.Linear1(1e300, 0)
+	require.NoError(t, err)
+	require.Equal(t, BandFormatFloat, img.BandFormat())
+
+	found, err = img.HasNonFinite()
+	require.NoError(t, err)
+	assert.True(t, found)
+
+	err = img.ReplaceNonFinite(0)
+	require.NoError(t, err)
+	assert.Equal(t, BandFormatFloat, img.BandFormat())
+
+	found, err = img.HasNonFinite()
+	require.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestExportMultiPageTIFF(t *testing.T) {
+	Startup(nil)
+
+	var pages []*ImageRef
+	for i := 0; i < 3; i++ {
+		page, err := NewImageFromFile(resources + "png-24bit.png")
+		require.NoError(t, err)
+		pages = append(pages, page)
+	}
+
+	buf, err := ExportMultiPageTIFF(pages, &ExportParams{Lossless: true})
+	require.NoError(t, err)
+	assert.Equal(t, ImageTypeTIFF, DetermineImageType(buf))
+
+	tiff, err := NewImageFromBuffer(buf, NParamImportOption(-1))
+	require.NoError(t, err)
+	assert.Equal(t, pages[0].Height(), tiff.PageHeight())
+	assert.Equal(t, 3*pages[0].Height(), tiff.Height())
+
+	small, err := NewImageFromFile(resources + "png-8bit.png")
+	require.NoError(t, err)
+
+	_, err = ExportMultiPageTIFF(append(pages, small), nil)
+	assert.Error(t, err)
+}
+
+func TestImageRef_RGBABytes(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "png-24bit.png")
+	require.NoError(t, err)
+
+	pixels, stride, err := img.RGBABytes()
+	require.NoError(t, err)
+	assert.Equal(t, img.Width()*4, stride)
+	assert.Equal(t, stride*img.Height(), len(pixels))
+	assert.Equal(t, uint8(255), pixels[3], "opaque alpha is added")
+}
+
+func TestImageRef_HEIF__Autorotate(t *testing.T) {
+	Startup(nil)
+
+	rotated, err := NewImageFromFile(resources + "heic-orientation-6.heic")
+	require.NoError(t, err)
+
+	unrotated, err := NewImageFromFile(resources+"heic-orientation-6.heic", AutorotateParamImportOption(false))
+	require.NoError(t, err)
+
+	assert.Equal(t, rotated.Width(), unrotated.Height())
+	assert.Equal(t, rotated.Height(), unrotated.Width())
+}
+
+func TestImageRef_Tiles(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "png-8bit.png")
+	require.NoError(t, err)
+	require.Equal(t, 200, img.Width())
+	require.Equal(t, 150, img.Height())
+
+	tiles, err := img.Tiles(64, 64, 0, TileEdgeClip)
+	require.NoError(t, err)
+	require.Len(t, tiles, 4*3)
+	assert.Equal(t, 8, tiles[3].Width())
+	assert.Equal(t, 22, tiles[11].Height())
+
+	tiles, err = img.Tiles(64, 64, 14, TileEdgePad)
+	require.NoError(t, err)
+	require.Len(t, tiles, 4*3)
+	for _, tile := range tiles {
+		assert.Equal(t, 64, tile.Width())
+		assert.Equal(t, 64, tile.Height())
+	}
+
+	_, err = img.Tiles(64, 64, 64, TileEdgeClip)
+	assert.Error(t, err)
+}
+
+func TestImageRef_SetDefaultImportOptions(t *testing.T) {
+	Startup(nil)
+
+	buf, err := ioutil.ReadFile(resources + "jpg-orientation-6.jpg")
+	require.NoError(t, err)
+
+	SetDefaultImportOptions(AutorotateParamImportOption(true))
+	defer SetDefaultImportOptions()
+
+	rotated, err := NewImageFromBuffer(buf)
+	require.NoError(t, err)
+	assert.NotEqual(t, 6, rotated.GetOrientation())
+
+	unrotated, err := NewImageFromBuffer(buf, AutorotateParamImportOption(false))
+	require.NoError(t, err)
+	assert.Equal(t, 6, unrotated.GetOrientation())
+	assert.Equal(t, rotated.Width(), unrotated.Height())
+	assert.Equal(t, rotated.Height(), unrotated.Width())
+}
+
+func TestImageRef_Autorotate__WEBP(t *testing.T) {
+	Startup(nil)
+
+	buf, err := ioutil.ReadFile(resources + "webp-orientation-6.webp")
+	require.NoError(t, err)
+
+	unrotated, err := NewImageFromBuffer(buf)
+	require.NoError(t, err)
+	assert.Equal(t, 6, unrotated.GetOrientation())
+
+	rotated, err := NewImageFromBuffer(buf, AutorotateParamImportOption(true))
+	require.NoError(t, err)
+	assert.NotEqual(t, 6, rotated.GetOrientation())
+	assert.Equal(t, unrotated.Width(), rotated.Height())
+	assert.Equal(t, unrotated.Height(), rotated.Width())
+}
+
+func TestImageRef_Autorotate__PNG(t *testing.T) {
+	Startup(nil)
+
+	buf, err := ioutil.ReadFile(resources + "png-orientation-6.png")
+	require.NoError(t, err)
+
+	unrotated, err := NewImageFromBuffer(buf)
+	require.NoError(t, err)
+	assert.Equal(t, 6, unrotated.GetOrientation())
+
+	rotated, err := NewImageFromBuffer(buf, AutorotateParamImportOption(true))
+	require.NoError(t, err)
+	assert.NotEqual(t, 6, rotated.GetOrientation())
+	assert.Equal(t, unrotated.Width(), rotated.Height())
+	assert.Equal(t, unrotated.Height(), rotated.Width())
+}
+
+func TestImageRef_HDR(t *testing.T) {
+	Startup(nil)
+
+	if !IsTypeSupported(ImageTypeHDR) {
+		t.Skip("radiance is not supported")
+	}
+
+	img, err := NewImageFromFile(resources + "hdr.hdr")
+	require.NoError(t, err)
+
+	assert.Equal(t, ImageTypeHDR, img.Format())
+	assert.Equal(t, 2, img.Width())
+	assert.Equal(t, 2, img.Height())
+	assert.Equal(t, 3, img.Bands())
+	assert.Equal(t, BandFormatFloat, img.BandFormat())
+}
+
+func TestImageRef_ToneMap(t *testing.T) {
+	Startup(nil)
+
+	if !IsTypeSupported(ImageTypeHDR) {
+		t.Skip("radiance is not supported")
+	}
+
+	for _, operator := range []ToneMapOperator{ToneMapReinhard, ToneMapDrago} {
+		img, err := NewImageFromFile(resources + "hdr.hdr")
+		require.NoError(t, err)
+
+		params := NewDefaultToneMapParams()
+		params.Operator = operator
+
+		err = img.ToneMap(params)
+		require.NoError(t, err)
+
+		assert.Equal(t, BandFormatUchar, img.BandFormat())
+		assert.Equal(t, InterpretationSRGB, img.Interpretation())
+		assert.Equal(t, 3, img.Bands())
+
+		_, _, err = img.Export(NewDefaultJPEGExportParams())
+		require.NoError(t, err)
+	}
+}
+
+func TestImageRef_SVG_MaxRasterPixels(t *testing.T) {
+	Startup(nil)
+
+	if !IsTypeSupported(ImageTypeSVG) {
+		t.Skip("svg is not supported")
+	}
+
+	huge := []byte(`<svg xmlns="http://www.w3.org/2000/svg" width="1" height="1" viewBox="0 0 1 1"></svg>`)
+
+	_, err := NewImageFromBuffer(huge, ScaleParamImportOption(100000))
+	assert.True(t, errors.Is(err, ErrMaxRasterPixelsExceeded))
+
+	img, err := NewImageFromBuffer(huge, ScaleParamImportOption(100))
+	require.NoError(t, err)
+	assert.Equal(t, 100, img.Width())
+
+	_, err = NewImageFromBuffer(huge, ScaleParamImportOption(100), MaxRasterPixelsImportOption(50*50))
+	assert.True(t, errors.Is(err, ErrMaxRasterPixelsExceeded))
+}
+
+func TestImageRef_PDF_MaxRasterPixels(t *testing.T) {
+	Startup(nil)
+
+	if !IsTypeSupported(ImageTypePDF) {
+		t.Skip("pdf is not supported")
+	}
+
+	raw, err := ioutil.ReadFile(resources + "pdf.pdf")
+	require.NoError(t, err)
+
+	// PDFs are not limited by default, e.g. pages rendered at a high DPI
+	img, err := NewImageFromBuffer(raw, DPIParamImportOption(3000))
+	require.NoError(t, err)
+	require.Greater(t, img.Width()*img.PageHeight(), 100000000)
+
+	// the limit applies to each page, not to the total of all pages
+	pages, err := NewImageFromBuffer(raw, NParamImportOption(-1))
+	require.NoError(t, err)
+	pixels := pages.Width() * pages.PageHeight()
+
+	_, err = NewImageFromBuffer(raw, NParamImportOption(-1), MaxRasterPixelsImportOption(pixels))
+	require.NoError(t, err)
+
+	_, err = NewImageFromBuffer(raw, NParamImportOption(-1), MaxRasterPixelsImportOption(pixels-1))
+	assert.True(t, errors.Is(err, ErrMaxRasterPixelsExceeded))
+}
+
+func TestImageRef_Thumbnail_Crop(t *testing.T) {
+	Startup(nil)
+
+	for _, crop := range []Interesting{InterestingCentre, InterestingEntropy, InterestingAttention, InterestingLow, InterestingHigh} {
+		img, err := NewImageFromFile(resources + "png-8bit.png")
+		require.NoError(t, err)
+
+		err = img.Thumbnail(64, 64, crop)
+		require.NoError(t, err)
+		assert.Equal(t, 64, img.Width())
+		assert.Equal(t, 64, img.Height())
+	}
+
+	img, err := NewImageFromFile(resources + "png-8bit.png")
+	require.NoError(t, err)
+
+	err = img.Thumbnail(64, 64, InterestingNone)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, img.Width(), 64)
+	assert.LessOrEqual(t, img.Height(), 64)
+	assert.NotEqual(t, img.Width(), img.Height())
+}
+
+func TestImageRef_UniqueColors(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "jpg-24bit.jpg")
+	require.NoError(t, err)
+
+	count, ok, err := img.UniqueColors(256)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, 257, count)
+
+	err = img.Thumbnail(1, 1, InterestingCentre)
+	require.NoError(t, err)
+
+	count, ok, err = img.UniqueColors(256)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 1, count)
+}
+
+func TestImageRef_SSIM(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "jpg-24bit.jpg")
+	require.NoError(t, err)
+
+	same, err := img.Copy()
+	require.NoError(t, err)
+
+	ssim, err := img.SSIM(same)
+	require.NoError(t, err)
+	assert.InDelta(t, 1.0, ssim, 0.0001)
+
+	err = same.GaussianBlur(4)
+	require.NoError(t, err)
+
+	ssim, err = img.SSIM(same)
+	require.NoError(t, err)
+	assert.Less(t, ssim, 0.9)
+
+	small, err := NewImageFromFile(resources + "png-8bit.png")
+	require.NoError(t, err)
+
+	_, err = img.SSIM(small)
+	assert.Error(t, err)
+}
+
+func TestPixelsDifferBeyond(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "jpg-24bit.jpg")
+	require.NoError(t, err)
+
+	same, err := img.Copy()
+	require.NoError(t, err)
+
+	differ, err := PixelsDifferBeyond(img, same, 0.5)
+	require.NoError(t, err)
+	assert.False(t, differ)
+
+	buf, _, err := img.Export(&ExportParams{Format: ImageTypeJPEG, Quality: 5})
+	require.NoError(t, err)
+	degraded, err := NewImageFromBuffer(buf)
+	require.NoError(t, err)
+
+	differ, err = PixelsDifferBeyond(img, degraded, 2)
+	require.NoError(t, err)
+	assert.True(t, differ)
+
+	differ, err = PixelsDifferBeyond(img, degraded, 200)
+	require.NoError(t, err)
+	assert.False(t, differ)
+
+	small, err := NewImageFromFile(resources + "png-8bit.png")
+	require.NoError(t, err)
+
+	_, err = PixelsDifferBeyond(img, small, 2)
+	assert.Error(t, err)
+}
+
+func TestImageRef_JPEG_TargetSSIM(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "jpg-24bit.jpg")
+	require.NoError(t, err)
+
+	params := NewDefaultJPEGExportParams()
+	params.TargetSSIM = 0.95
+
+	buf, _, err := img.Export(params)
+	require.NoError(t, err)
+
+	encoded, err := NewImageFromBuffer(buf)
+	require.NoError(t, err)
+
+	ssim, err := img.SSIM(encoded)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, ssim, 0.95)
+
+	params.TargetSSIM = 0
+	params.Quality = 100
+	maxQuality, _, err := img.Export(params)
+	require.NoError(t, err)
+	assert.Less(t, len(buf), len(maxQuality))
+}
+
+func TestImageRef_HEIF_Alpha(t *testing.T) {
+	Startup(nil)
+
+	if !IsTypeSupported(ImageTypeHEIF) {
+		t.Skip("heif is not supported")
+	}
+
+	// a half transparent color, which comes back darkened if the samples are stored premultiplied
+	src := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			src.SetNRGBA(x, y, color.NRGBA{R: 200, G: 100, B: 50, A: 128})
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, src))
+
+	img, err := NewImageFromBuffer(buf.Bytes())
+	require.NoError(t, err)
+
+	params := NewDefaultExportParams()
+	params.Format = ImageTypeHEIF
+	params.Quality = 90
+
+	heif, _, err := img.Export(params)
+	require.NoError(t, err)
+
+	decoded, err := NewImageFromBuffer(heif)
+	require.NoError(t, err)
+	require.True(t, decoded.HasAlpha())
+
+	average, err := decoded.AverageColor()
+	require.NoError(t, err)
+	assert.InDelta(t, 200, int(average.R), 8)
+	assert.InDelta(t, 100, int(average.G), 8)
+	assert.InDelta(t, 50, int(average.B), 8)
+	assert.InDelta(t, 128, int(average.A), 8)
+}
+
+func TestImageRef_HEIF_Encoder(t *testing.T) {
+	Startup(nil)
+
+	if !IsTypeSupported(ImageTypeHEIF) {
+		t.Skip("heif is not supported")
+	}
+
+	img, err := NewImageFromFile(resources + "jpg-24bit.jpg")
+	require.NoError(t, err)
+
+	params := NewDefaultExportParams()
+	params.Format = ImageTypeHEIF
+	params.HeifEncoder = HeifEncoderAOM
+
+	buf, metadata, err := img.Export(params)
+	if !hasOperationProperty("heifsave_buffer", "encoder") {
+		assert.Equal(t, ErrHEIFEncoderUnsupported, err)
+		return
+	}
+	if err != nil {
+		t.Skip("libheif was built without the aom encoder")
+	}
+	assert.Equal(t, ImageTypeHEIF, metadata.Format)
+	assert.Equal(t, avif, buf[8:12])
+}
+
+func TestImageRef_HEIF_SubsampleMode(t *testing.T) {
+	Startup(nil)
+
+	if !IsTypeSupported(ImageTypeHEIF) {
+		t.Skip("heif is not supported")
+	}
+
+	img, err := NewImageFromFile(resources + "jpg-24bit.jpg")
+	require.NoError(t, err)
+
+	params := NewDefaultExportParams()
+	params.Format = ImageTypeHEIF
+	params.Quality = 50
+	params.HeifSubsampleMode = SubsampleModeOff
+
+	full, metadata, err := img.Export(params)
+	if !hasOperationProperty("heifsave_buffer", "subsample_mode") {
+		assert.Equal(t, ErrHEIFSubsampleModeUnsupported, err)
+		return
+	}
+	require.NoError(t, err)
+	assert.Equal(t, ImageTypeHEIF, metadata.Format)
+
+	params.HeifSubsampleMode = SubsampleModeOn
+	subsampled, _, err := img.Export(params)
+	require.NoError(t, err)
+	assert.NotEqual(t, full, subsampled)
+}
+
+func TestImageRef_ExportReader(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "png-24bit.png")
+	require.NoError(t, err)
+
+	params := NewDefaultExportParams()
+	params.Format = ImageTypeTIFF
+
+	reader, metadata, err := img.ExportReader(params, 0)
+	require.NoError(t, err)
+	assert.Equal(t, ImageTypeTIFF, metadata.Format)
+
+	spilled, ok := reader.(*tempFileReader)
+	require.True(t, ok)
+
+	buf, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, ImageTypeTIFF, DetermineImageType(buf))
+
+	require.NoError(t, reader.Close())
+	_, err = os.Stat(spilled.Name())
+	assert.True(t, os.IsNotExist(err))
+
+	reader, metadata, err = img.ExportReader(params, 1<<30)
+	require.NoError(t, err)
+	defer reader.Close()
+
+	_, ok = reader.(*tempFileReader)
+	assert.False(t, ok)
+
+	inMemory, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, ImageTypeTIFF, DetermineImageType(inMemory))
+}
+
+func TestImageRef_Multiband(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "png-24bit.png")
+	require.NoError(t, err)
+
+	err = img.BandJoinConst([]float64{10, 20, 30, 40, 50})
+	require.NoError(t, err)
+	require.Equal(t, 8, img.Bands())
+
+	params := NewDefaultExportParams()
+	params.Format = ImageTypeTIFF
+
+	buf, _, err := img.Export(params)
+	require.NoError(t, err)
+
+	multiband, err := NewImageFromBuffer(buf)
+	require.NoError(t, err)
+	assert.Equal(t, 8, multiband.Bands())
+
+	_, _, err = multiband.Export(NewDefaultPNGExportParams())
+	assert.True(t, errors.Is(err, ErrTooManyBands))
+
+	err = multiband.SelectBands(7, 2, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 3, multiband.Bands())
+
+	_, _, err = multiband.Export(NewDefaultPNGExportParams())
+	assert.NoError(t, err)
+
+	assert.Error(t, multiband.SelectBands(3))
+}
+
+func TestImageRef_WebP_Exact(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "png-24bit+alpha.png")
+	require.NoError(t, err)
+
+	params := NewDefaultWEBPExportParams()
+	params.Lossless = true
+	params.Exact = true
+
+	buf, _, err := img.Export(params)
+	if !hasOperationProperty("webpsave_buffer", "exact") {
+		assert.Equal(t, ErrWebPExactUnsupported, err)
+		return
+	}
+	require.NoError(t, err)
+
+	exact, err := NewImageFromBuffer(buf)
+	require.NoError(t, err)
+
+	original, err := img.ToBytes()
+	require.NoError(t, err)
+	decoded, err := exact.ToBytes()
+	require.NoError(t, err)
+	assert.Equal(t, original, decoded)
+}
+
+func TestImageRef_WebP_LosslessTuning(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "png-8bit.png")
+	require.NoError(t, err)
+
+	params := NewDefaultWEBPExportParams()
+	params.Lossless = true
+	params.Quality = 100
+	params.Effort = 6
+
+	buf, _, err := img.Export(params)
+	require.NoError(t, err)
+
+	lossless, err := NewImageFromBuffer(buf)
+	require.NoError(t, err)
+	differ, err := PixelsDifferBeyond(img, lossless, 0)
+	require.NoError(t, err)
+	assert.False(t, differ)
+
+	params = NewDefaultWEBPExportParams()
+	params.NearLossless = true
+	params.Quality = 60
+
+	buf, _, err = img.Export(params)
+	require.NoError(t, err)
+	assert.Equal(t, ImageTypeWEBP, DetermineImageType(buf))
+
+	params.WebPPreset = WebPPreset(42)
+	_, _, err = img.Export(params)
+	assert.Error(t, err)
+
+	// presets only tune lossy output
+	params.WebPPreset = WebPPresetIcon
+	_, _, err = img.Export(params)
+	assert.Error(t, err)
+
+	params.NearLossless = false
+	params.Lossless = true
+	_, _, err = img.Export(params)
+	assert.Error(t, err)
+
+	params.Lossless = false
+	_, _, err = img.Export(params)
+	assert.NoError(t, err)
+
+	params = NewDefaultWEBPExportParams()
+	params.NearLossless = true
+	params.Quality = 100
+	_, _, err = img.Export(params)
+	assert.Error(t, err)
+}
+
+func TestImageRef_AutoLevels(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "png-24bit.png")
+	require.NoError(t, err)
+
+	// reduce the contrast to the range 64 - 191
+	err = img.Linear1(0.5, 64)
+	require.NoError(t, err)
+
+	buf, _, err := img.Export(NewDefaultPNGExportParams())
+	require.NoError(t, err)
+
+	levels := func(img *ImageRef) (byte, byte) {
+		pixels, _, err := img.RGBABytes()
+		require.NoError(t, err)
+
+		low, high := byte(255), byte(0)
+		for i := 0; i < len(pixels); i += 4 {
+			for _, v := range pixels[i : i+3] {
+				if v < low {
+					low = v
+				}
+				if v > high {
+					high = v
+				}
+			}
+		}
+		return low, high
+	}
+
+	flat, err := NewImageFromBuffer(buf)
+	require.NoError(t, err)
+	low, high := levels(flat)
+	assert.GreaterOrEqual(t, low, byte(64))
+	assert.LessOrEqual(t, high, byte(191))
+
+	err = flat.Normalize()
+	require.NoError(t, err)
+	low, high = levels(flat)
+	assert.Less(t, low, byte(32))
+	assert.Greater(t, high, byte(223))
+
+	assert.Error(t, flat.AutoLevels(60, 40))
+}
+
+func TestLoadImageRegion(t *testing.T) {
+	Startup(nil)
+
+	buf, err := ioutil.ReadFile(resources + "png-24bit.png")
+	require.NoError(t, err)
+
+	region, err := LoadImageRegion(buf, 10, 20, 64, 32)
+	require.NoError(t, err)
+	assert.Equal(t, 64, region.Width())
+	assert.Equal(t, 32, region.Height())
+	assert.Equal(t, ImageTypePNG, region.Format())
+
+	full, err := NewImageFromBuffer(buf)
+	require.NoError(t, err)
+	err = full.ExtractArea(10, 20, 64, 32)
+	require.NoError(t, err)
+
+	expected, err := full.ToBytes()
+	require.NoError(t, err)
+	actual, err := region.ToBytes()
+	require.NoError(t, err)
+	assert.Equal(t, expected, actual)
+
+	_, err = LoadImageRegion(buf, 0, 0, full.Width()*100, 1)
+	assert.Error(t, err)
+}
+
+func TestImageRef_Export_ICCProfile(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "png-24bit.png")
+	require.NoError(t, err)
+	require.False(t, img.HasICCProfile())
+
+	params := NewDefaultJPEGExportParams()
+	params.ICCProfile = "sRGB"
+
+	buf, _, err := img.Export(params)
+	require.NoError(t, err)
+
+	embedded, err := NewImageFromBuffer(buf)
+	require.NoError(t, err)
+	assert.True(t, embedded.HasICCProfile())
+
+	for _, name := range []string{"p3", "adobe-rgb"} {
+		params.ICCProfile = name
+		buf, _, err = img.Export(params)
+		require.NoError(t, err)
+
+		embedded, err = NewImageFromBuffer(buf)
+		require.NoError(t, err)
+		profile, ok := embedded.ICCProfile()
+		require.True(t, ok)
+		assert.Equal(t, "acsp", string(profile[36:40]))
+	}
+
+	params.ICCProfile = "export-icc-profile-test"
+	_, _, err = img.Export(params)
+	assert.True(t, errors.Is(err, ErrUnknownICCProfile))
+
+	err = RegisterICCProfile("export-icc-profile-test", sRGBV2MicroICCProfile)
+	require.NoError(t, err)
+
+	_, _, err = img.Export(params)
+	assert.NoError(t, err)
+
+	assert.Error(t, RegisterICCProfile("srgb", sRGBV2MicroICCProfile))
+	assert.Error(t, RegisterICCProfile("p3", sRGBV2MicroICCProfile))
+}
+
+func TestImageRef_DominantColor_AverageColor(t *testing.T) {
+	Startup(nil)
+
+	src := image.NewRGBA(image.Rect(0, 0, 40, 40))
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 40; x++ {
+			if x < 30 {
+				src.Set(x, y, color.RGBA{R: 200, A: 255})
+			} else {
+				src.Set(x, y, color.RGBA{B: 200, A: 255})
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, src))
+
+	img, err := NewImageFromBuffer(buf.Bytes())
+	require.NoError(t, err)
+
+	dominant, err := img.DominantColor()
+	require.NoError(t, err)
+	assert.Equal(t, ColorRGBA{R: 200, A: 255}, dominant)
+
+	average, err := img.AverageColor()
+	require.NoError(t, err)
+	assert.Equal(t, ColorRGBA{R: 150, B: 50, A: 255}, average)
+}
+
+func TestLoadImageFromRawData(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "png-24bit.png")
+	require.NoError(t, err)
+
+	pixels, _, err := img.RGBABytes()
+	require.NoError(t, err)
+
+	raw, err := LoadImageFromRawData(pixels, img.Width(), img.Height(), 4, BandFormatUchar)
+	require.NoError(t, err)
+	assert.Equal(t, img.Width(), raw.Width())
+	assert.Equal(t, img.Height(), raw.Height())
+	assert.Equal(t, InterpretationSRGB, raw.Interpretation())
+	assert.True(t, raw.HasAlpha())
+
+	roundTrip, _, err := raw.RGBABytes()
+	require.NoError(t, err)
+	assert.Equal(t, pixels, roundTrip)
+
+	_, err = LoadImageFromRawData(pixels[:10], img.Width(), img.Height(), 4, BandFormatUchar)
+	assert.Error(t, err)
+}
+
+func TestLoadImageFromRawDataWithByteOrder(t *testing.T) {
+	Startup(nil)
+
+	samples := []uint16{0x0102, 0xFF00, 0x1234, 0xABCD}
+	bigEndian := make([]byte, 2*len(samples))
+	for i, sample := range samples {
+		binary.BigEndian.PutUint16(bigEndian[2*i:], sample)
+	}
+
+	img, err := LoadImageFromRawDataWithByteOrder(bigEndian, 2, 2, 1, BandFormatUshort, binary.BigEndian)
+	require.NoError(t, err)
+	assert.Equal(t, BandFormatUshort, img.BandFormat())
+
+	pixels, err := img.ToBytes()
+	require.NoError(t, err)
+	for i, sample := range samples {
+		assert.Equal(t, sample, nativeByteOrder.Uint16(pixels[2*i:]))
+	}
+
+	_, err = LoadImageFromRawDataWithByteOrder(bigEndian[:6], 2, 2, 1, BandFormatUshort, binary.LittleEndian)
+	assert.Error(t, err)
+}
+
+func TestImageRef_AddRemoveAlpha__CMYK(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "jpg-32bit-cmyk-icc-swop.jpg")
+	require.NoError(t, err)
+	require.Equal(t, InterpretationCMYK, img.Interpretation())
+	assert.Equal(t, 4, img.Bands())
+	assert.False(t, img.HasAlpha())
+
+	err = img.AddAlpha()
+	require.NoError(t, err)
+	assert.Equal(t, 5, img.Bands())
+	assert.True(t, img.HasAlpha())
+
+	err = img.RemoveAlpha()
+	require.NoError(t, err)
+	assert.Equal(t, 4, img.Bands())
+	assert.False(t, img.HasAlpha())
+
+	err = img.RemoveAlpha()
+	require.NoError(t, err)
+	assert.Equal(t, 4, img.Bands())
+}
+
+func TestImageRef_ResizeWithVScale__PremultipliedAlpha(t *testing.T) {
+	Startup(nil)
+
+	// opaque white next to transparent black, which darkens the edge unless alpha is premultiplied
+	src := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 8; x++ {
+			src.Set(x, y, color.NRGBA{R: 255, G: 255, B: 255, A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, src))
+
+	img, err := NewImageFromBuffer(buf.Bytes())
+	require.NoError(t, err)
+
+	err = img.ResizeWithVScale(0.5, 0.5, KernelLinear)
+	require.NoError(t, err)
+
+	pixels, _, err := img.RGBABytes()
+	require.NoError(t, err)
+	for i := 0; i < len(pixels); i += 4 {
+		if pixels[i+3] > 0 {
+			assert.InDelta(t, 255, pixels[i], 1)
+		}
+	}
+}
+
+func TestImageRef_Resize__Linear(t *testing.T) {
+	Startup(nil)
+
+	// a black and white checkerboard averages to 50% grey in linear light, which is 188 in sRGB
+	checkerboard := make([]byte, 32*32)
+	for i := range checkerboard {
+		if (i%32+i/32)%2 == 0 {
+			checkerboard[i] = 255
+		}
+	}
+
+	average := func(opts ...ResizeOption) float64 {
+		img, err := LoadImageFromRawData(checkerboard, 32, 32, 1, BandFormatUchar)
+		require.NoError(t, err)
+		require.NoError(t, img.Resize(0.5, KernelLinear, opts...))
+		assert.Equal(t, 16, img.Width())
+		assert.Equal(t, 1, img.Bands())
+
+		pixels, err := img.ToBytes()
+		require.NoError(t, err)
+		sum := 0.0
+		for _, p := range pixels {
+			sum += float64(p)
+		}
+		return sum / float64(len(pixels))
+	}
+
+	assert.InDelta(t, 128, average(), 10)
+	assert.InDelta(t, 188, average(WithLinearResize()), 10)
+
+	img, err := NewImageFromFile(resources + "png-8bit+alpha.png")
+	require.NoError(t, err)
+	bands, width := img.Bands(), img.Width()
+	require.NoError(t, img.ResizeWithVScale(0.5, 0.25, KernelAuto, WithLinearResize()))
+	assert.Equal(t, bands, img.Bands())
+	assert.Equal(t, BandFormatUchar, img.BandFormat())
+	assert.Equal(t, width/2, img.Width())
+
+	require.NoError(t, img.Thumbnail(50, 50, InterestingNone, WithLinearResize()))
+	assert.True(t, img.Width() == 50 || img.Height() == 50)
+}
+
+func TestPremultipliedAlphaImportOption(t *testing.T) {
+	Startup(nil)
+
+	src := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	src.Set(0, 0, color.NRGBA{R: 100, A: 128})
+
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, src))
+
+	img, err := NewImageFromBuffer(buf.Bytes(), PremultipliedAlphaImportOption(true))
+	require.NoError(t, err)
+	assert.Equal(t, BandFormatUchar, img.BandFormat())
+
+	pixels, _, err := img.RGBABytes()
+	require.NoError(t, err)
+	assert.InDelta(t, 199, pixels[0], 1)
+	assert.Equal(t, uint8(128), pixels[3])
+}
+
+func TestProcessingPrecisionImportOption(t *testing.T) {
+	Startup(nil)
+
+	src := image.NewRGBA64(image.Rect(0, 0, 2, 2))
+	for i := range src.Pix {
+		src.Pix[i] = 0xAB
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, src))
+
+	img, err := NewImageFromBuffer(buf.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, BandFormatUshort, img.BandFormat())
+
+	img, err = NewImageFromBuffer(buf.Bytes(), ProcessingPrecisionImportOption(ProcessingPrecision8))
+	require.NoError(t, err)
+	assert.Equal(t, BandFormatUchar, img.BandFormat())
+	assert.Equal(t, InterpretationSRGB, img.Interpretation())
+
+	pixels, _, err := img.RGBABytes()
+	require.NoError(t, err)
+	assert.InDelta(t, 0xAB, pixels[0], 1)
+
+	img, err = NewImageFromBuffer(buf.Bytes(), ProcessingPrecisionImportOption(ProcessingPrecisionFloat))
+	require.NoError(t, err)
+	assert.Equal(t, BandFormatFloat, img.BandFormat())
+}
+
+func TestInvertedCMYKImportOption(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "jpg-32bit-cmyk-icc-swop.jpg")
+	require.NoError(t, err)
+	require.Equal(t, InterpretationCMYK, img.Interpretation())
+
+	inverted, err := NewImageFromFile(resources+"jpg-32bit-cmyk-icc-swop.jpg", InvertedCMYKImportOption(true))
+	require.NoError(t, err)
+	assert.Equal(t, InterpretationCMYK, inverted.Interpretation())
+	assert.Equal(t, img.Bands(), inverted.Bands())
+
+	pixels, err := img.ToBytes()
+	require.NoError(t, err)
+	invertedPixels, err := inverted.ToBytes()
+	require.NoError(t, err)
+	require.Equal(t, len(pixels), len(invertedPixels))
+
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, 255-pixels[i], invertedPixels[i])
+	}
+}
+
+func TestImageRef_ExportDataURI(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "png-8bit.png")
+	require.NoError(t, err)
+
+	uri, err := img.ExportDataURI(NewDefaultPNGExportParams(), 0)
+	require.NoError(t, err)
+
+	prefix := "data:image/png;base64,"
+	require.True(t, strings.HasPrefix(uri, prefix))
+
+	buf, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(uri, prefix))
+	require.NoError(t, err)
+	assert.Equal(t, ImageTypePNG, DetermineImageType(buf))
+
+	_, err = img.ExportDataURI(NewDefaultPNGExportParams(), 100)
+	assert.True(t, errors.Is(err, ErrDataURITooLarge))
+}
+
+func TestMaxFramesImportOption(t *testing.T) {
+	Startup(nil)
+
+	file := resources + "webp-animated+alpha.webp"
+
+	_, err := NewImageFromFile(file, NParamImportOption(-1), MaxFramesImportOption(2, false))
+	assert.True(t, errors.Is(err, ErrMaxFramesExceeded))
+
+	img, err := NewImageFromFile(file, NParamImportOption(-1), MaxFramesImportOption(2, true))
+	require.NoError(t, err)
+	assert.Equal(t, 2*img.PageHeight(), img.Height())
+	assert.Len(t, vipsGetMetaDelay(img.image), 2)
+	assert.Equal(t, 2, img.Pages())
+
+	buf, _, err := img.Export(NewDefaultWEBPExportParams())
+	require.NoError(t, err)
+	exported, err := NewImageFromBuffer(buf, NParamImportOption(-1))
+	require.NoError(t, err)
+	assert.Equal(t, 2*exported.PageHeight(), exported.Height())
+
+	img, err = NewImageFromFile(file, MaxFramesImportOption(2, false))
+	require.NoError(t, err)
+	assert.Equal(t, img.PageHeight(), img.Height())
+}
+
+func TestImageRef_Metadata__Interpretation(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "png-24bit.png")
+	require.NoError(t, err)
+
+	metadata := img.Metadata()
+	assert.Equal(t, 3, metadata.Bands)
+	assert.Equal(t, InterpretationSRGB, metadata.Colorspace)
+	assert.Equal(t, "srgb", metadata.Colorspace.String())
+
+	err = img.ToColorSpace(InterpretationLAB)
+	require.NoError(t, err)
+	assert.Equal(t, InterpretationLAB, img.Metadata().Colorspace)
+	assert.Equal(t, "lab", img.Metadata().Colorspace.String())
+
+	assert.Equal(t, "b-w", InterpretationBW.String())
+	assert.Equal(t, "Interpretation(-2)", Interpretation(-2).String())
+}
+
+func TestNewThumbnailFromBuffer(t *testing.T) {
+	Startup(nil)
+
+	buf, err := ioutil.ReadFile(resources + "png-24bit.png")
+	require.NoError(t, err)
+
+	img, err := NewThumbnailFromBuffer(buf, 300, 300, InterestingNone)
+	require.NoError(t, err)
+	assert.Equal(t, ImageTypePNG, img.Format())
+	assert.Equal(t, 300, img.Width())
+	assert.Equal(t, 169, img.Height())
+
+	img, err = NewThumbnailFromBuffer(buf, 300, 300, InterestingCentre)
+	require.NoError(t, err)
+	assert.Equal(t, 300, img.Width())
+	assert.Equal(t, 300, img.Height())
+
+	_, err = NewThumbnailFromBuffer([]byte("not an image"), 300, 300, InterestingNone)
+	assert.Error(t, err)
+}
+
+func TestImageRef_ExtractPage(t *testing.T) {
+	Startup(nil)
+
+	buf, err := ioutil.ReadFile(resources + "webp-animated+alpha.webp")
+	require.NoError(t, err)
+
+	img, err := NewImageFromBuffer(buf, NParamImportOption(-1))
+	require.NoError(t, err)
+	require.Equal(t, 14, img.Pages())
+	pageHeight := img.PageHeight()
+
+	page, err := img.ExtractPage(13)
+	require.NoError(t, err)
+	assert.Equal(t, img.Width(), page.Width())
+	assert.Equal(t, pageHeight, page.Height())
+	assert.Equal(t, 1, page.Pages())
+	assert.Equal(t, 14*pageHeight, img.Height())
+
+	_, err = img.ExtractPage(14)
+	assert.Error(t, err)
+	_, err = img.ExtractPage(-1)
+	assert.Error(t, err)
+}
+
+func TestImageRef_SetPageHeight(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "png-8bit.png")
+	require.NoError(t, err)
+	require.Equal(t, 1, img.Pages())
+
+	require.NoError(t, img.SetPageHeight(50))
+	assert.Equal(t, 50, img.PageHeight())
+	assert.Equal(t, 3, img.Pages())
+
+	page, err := img.ExtractPage(2)
+	require.NoError(t, err)
+	assert.Equal(t, 200, page.Width())
+	assert.Equal(t, 50, page.Height())
+
+	assert.Error(t, img.SetPageHeight(40))
+}
+
+func TestImageRef_Export__InvalidParams(t *testing.T) {
+	img, err := NewImageFromFile(resources + "png-8bit.png")
+	require.NoError(t, err)
+
+	params := NewDefaultJPEGExportParams()
+	params.Quality = 200
+	_, _, err = img.Export(params)
+	assert.EqualError(t, err, "invalid JPEG quality 200, the quality must be between 0 and 100")
+
+	params = NewDefaultWEBPExportParams()
+	params.Quality = -1
+	_, _, err = img.Export(params)
+	assert.Error(t, err)
+
+	params = NewDefaultPNGExportParams()
+	params.Compression = 99
+	_, _, err = img.Export(params)
+	assert.EqualError(t, err, "invalid PNG compression 99, the zlib level must be between 0 and 9")
+
+	params.Compression = 9
+	_, _, err = img.Export(params)
+	assert.NoError(t, err)
+}
+
+func TestNewImageFromBufferContext(t *testing.T) {
+	Startup(nil)
+
+	buf, err := ioutil.ReadFile(resources + "svg.svg")
+	require.NoError(t, err)
+
+	img, err := NewImageFromBufferContext(context.Background(), buf)
+	require.NoError(t, err)
+	assert.Equal(t, ImageTypeSVG, img.Format())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = NewImageFromBufferContext(ctx, buf)
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	var heavy strings.Builder
+	heavy.WriteString(`<svg xmlns="http://www.w3.org/2000/svg" width="2000" height="2000">`)
+	heavy.WriteString(`<filter id="blur"><feGaussianBlur stdDeviation="20"/></filter>`)
+	for i := 0; i < 20; i++ {
+		fmt.Fprintf(&heavy, `<circle cx="%d" cy="%d" r="500" fill="#%06x" filter="url(#blur)"/>`, i*100, 2000-i*100, i*800000)
+	}
+	heavy.WriteString(`</svg>`)
+
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	_, err = NewImageFromBufferContext(expired, []byte(heavy.String()))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	// the decode itself is aborted, as the deadline is checked before the copy is evaluated
+	loaded, _, err := vipsLoadFromBuffer([]byte(heavy.String()))
+	require.NoError(t, err)
+	defer clearImage(loaded)
+	_, err = vipsCopyImageMemoryContext(expired, loaded)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	// an aborted decode must not kill the image shared via the operation cache
+	img, err = NewImageFromBufferContext(context.Background(), []byte(heavy.String()))
+	require.NoError(t, err)
+	assert.Equal(t, 2000, img.Width())
+}
+
+func TestImageRef_Export__RegisteredEncoder(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "png-8bit.png")
+	require.NoError(t, err)
+
+	RegisterEncoder(ImageTypeGIF, func(w io.Writer, img image.Image, params *ExportParams) error {
+		return gif.Encode(w, img, nil)
+	})
+	defer RegisterEncoder(ImageTypeGIF, nil)
+
+	buf, metadata, err := img.Export(&ExportParams{Format: ImageTypeGIF})
+	require.NoError(t, err)
+	assert.Equal(t, ImageTypeGIF, metadata.Format)
+
+	decoded, err := gif.Decode(bytes.NewReader(buf))
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 200, 150), decoded.Bounds())
+
+	RegisterEncoder(ImageTypeGIF, nil)
+
+	_, metadata, err = img.Export(&ExportParams{Format: ImageTypeGIF})
+	if IsTypeSupported(ImageTypeGIF) {
+		require.NoError(t, err)
+		assert.Equal(t, ImageTypeJPEG, metadata.Format)
+	} else {
+		assert.Error(t, err)
+	}
+}
+
+func TestImageRef_Export__RenderingIntent(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "jpg-24bit-icc-adobe-rgb.jpg")
+	require.NoError(t, err)
+
+	buf, _, err := img.Export(&ExportParams{Format: ImageTypeJPEG, RenderingIntent: RenderingIntentRelative})
+	require.NoError(t, err)
+
+	exported, err := NewImageFromBuffer(buf)
+	require.NoError(t, err)
+	profile, ok := exported.ICCProfile()
+	require.True(t, ok)
+	assert.Equal(t, []byte{0, 0, 0, 1}, profile[64:68])
+
+	buf, _, err = img.Export(&ExportParams{Format: ImageTypePNG, ICCProfile: "srgb", RenderingIntent: RenderingIntentSaturation})
+	require.NoError(t, err)
+
+	exported, err = NewImageFromBuffer(buf)
+	require.NoError(t, err)
+	profile, ok = exported.ICCProfile()
+	require.True(t, ok)
+	assert.Equal(t, []byte{0, 0, 0, 2}, profile[64:68])
+}
+
+func TestImageRef_SizeInBytes(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "png-24bit.png")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1920*1080*3), img.SizeInBytes())
+
+	err = img.Linear1(1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1920*1080*3*4), img.SizeInBytes())
+}
+
+func TestImageRef_WebP__Effort(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "png-8bit.png")
+	require.NoError(t, err)
+
+	params := NewDefaultWEBPExportParams()
+	for _, effort := range []int{0, 6} {
+		params.Effort = effort
+		_, _, err = img.Export(params)
+		assert.NoError(t, err)
+	}
+
+	for _, effort := range []int{-1, 7} {
+		params.Effort = effort
+		_, _, err = img.Export(params)
+		assert.Error(t, err)
+	}
+}
+
+func TestImageRef_PNGText(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "png-8bit.png")
+	require.NoError(t, err)
+
+	text := img.PNGText()
+	text["Software"] = "govips"
+	text["Build"] = "1234"
+
+	err = img.SetPNGText(text)
+	require.NoError(t, err)
+
+	buf, _, err := img.Export(NewDefaultPNGExportParams())
+	require.NoError(t, err)
+
+	loaded, err := NewImageFromBuffer(buf)
+	require.NoError(t, err)
+	assert.Equal(t, text, loaded.PNGText())
+
+	assert.Error(t, img.SetPNGText(map[string]string{"": "empty key"}))
+}
+
 // TODO unit tests to cover:
 // NewImageFromReader failing test
 // NewImageFromFile failing test
@@ -0,0 +1,428 @@
+package vips
+
+import (
+	"bytes"
+	"errors"
+)
+
+// JPEG markers, see https://www.w3.org/Graphics/JPEG/itu-t81.pdf (Table B.1)
+const (
+	jpegMarkerSOF0  = 0xC0
+	jpegMarkerSOF1  = 0xC1
+	jpegMarkerSOF2  = 0xC2
+	jpegMarkerDHT   = 0xC4
+	jpegMarkerDQT   = 0xDB
+	jpegMarkerSOI   = 0xD8
+	jpegMarkerEOI   = 0xD9
+	jpegMarkerSOS   = 0xDA
+	jpegMarkerDRI   = 0xDD
+	jpegMarkerAPP0  = 0xE0
+	jpegMarkerAPP1  = 0xE1
+	jpegMarkerAPP2  = 0xE2
+	jpegMarkerAPP8  = 0xE8
+	jpegMarkerAPP13 = 0xED
+	jpegMarkerAPP14 = 0xEE
+
+	// JPEG-LS start of frame, see ITU-T T.87
+	jpegMarkerSOF55 = 0xF7
+)
+
+// JPEGVariant identifies a JPEG by the segment following the start of image marker
+type JPEGVariant int
+
+// JPEGVariant enum
+const (
+	JPEGVariantUnknown JPEGVariant = iota
+	JPEGVariantJFIF                // APP0 JFIF segment (FF D8 FF E0)
+	JPEGVariantEXIF                // APP1 Exif segment (FF D8 FF E1)
+	JPEGVariantSPIFF               // APP8 SPIFF segment (FF D8 FF E8)
+	JPEGVariantRaw                 // no application segment, starts with the quantization tables (FF D8 FF DB)
+)
+
+// JPEGVariants maps the JPEG variants to their names
+var JPEGVariants = map[JPEGVariant]string{
+	JPEGVariantUnknown: "unknown",
+	JPEGVariantJFIF:    "jfif",
+	JPEGVariantEXIF:    "exif",
+	JPEGVariantSPIFF:   "spiff",
+	JPEGVariantRaw:     "raw",
+}
+
+// DetermineJPEGVariant determines the JPEG variant from the first segment of the buffer.
+// JPEGVariantUnknown is returned for other application segments and for buffers which are not JPEGs.
+func DetermineJPEGVariant(buf []byte) JPEGVariant {
+	if !isJPEG(buf) || len(buf) < 4 {
+		return JPEGVariantUnknown
+	}
+
+	// the identifier follows the marker and the segment length
+	var identifier []byte
+	if len(buf) > 6 {
+		identifier = buf[6:]
+	}
+
+	switch buf[3] {
+	case jpegMarkerAPP0:
+		if bytes.HasPrefix(identifier, []byte("JFIF\x00")) {
+			return JPEGVariantJFIF
+		}
+	case jpegMarkerAPP1:
+		if bytes.HasPrefix(identifier, exifHeader) {
+			return JPEGVariantEXIF
+		}
+	case jpegMarkerAPP8:
+		if bytes.HasPrefix(identifier, []byte("SPIFF\x00")) {
+			return JPEGVariantSPIFF
+		}
+	case jpegMarkerDQT:
+		return JPEGVariantRaw
+	}
+
+	return JPEGVariantUnknown
+}
+
+var errInvalidJPEG = errors.New("invalid JPEG marker structure")
+
+// jpegSegment is a marker segment of a JPEG file. Data is the payload without the length field.
+type jpegSegment struct {
+	marker byte
+	offset int
+	data   []byte
+}
+
+// readJPEGSegments returns the marker segments of a JPEG up to and including the first start of scan.
+func readJPEGSegments(buf []byte) ([]jpegSegment, error) {
+	if !isJPEG(buf) {
+		return nil, ErrUnsupportedImageFormat
+	}
+
+	var segments []jpegSegment
+	pos := 2
+	for pos+4 <= len(buf) {
+		if buf[pos] != 0xFF {
+			return nil, errInvalidJPEG
+		}
+
+		marker := buf[pos+1]
+		switch {
+		case marker == 0xFF:
+			// fill byte
+			pos++
+			continue
+		case marker == jpegMarkerSOI, marker == 0x01, marker >= 0xD0 && marker <= 0xD7:
+			// markers without a payload
+			pos += 2
+			continue
+		case marker == jpegMarkerEOI:
+			return segments, nil
+		}
+
+		length := int(buf[pos+2])<<8 | int(buf[pos+3])
+		if length < 2 || pos+2+length > len(buf) {
+			return nil, errInvalidJPEG
+		}
+
+		segments = append(segments, jpegSegment{
+			marker: marker,
+			offset: pos,
+			data:   buf[pos+4 : pos+2+length],
+		})
+
+		if marker == jpegMarkerSOS {
+			return segments, nil
+		}
+
+		pos += 2 + length
+	}
+
+	return segments, nil
+}
+
+// isJPEGLS checks whether the JPEG is encoded with a JPEG-LS frame, which libjpeg cannot decode
+func isJPEGLS(buf []byte) bool {
+	segments, err := readJPEGSegments(buf)
+	if err != nil {
+		return false
+	}
+
+	for _, segment := range segments {
+		if segment.marker == jpegMarkerSOF55 {
+			return true
+		}
+	}
+	return false
+}
+
+// JPEGColorTransform is the color transform applied to the components of a JPEG before compression
+type JPEGColorTransform int
+
+// JPEGColorTransform enum
+const (
+	JPEGColorTransformNone  JPEGColorTransform = iota // grey, RGB or CMYK stored as is
+	JPEGColorTransformYCbCr                           // RGB stored as YCbCr
+	JPEGColorTransformYCCK                            // CMYK stored as YCbCr and K
+)
+
+// JPEGHeader holds the frame parameters of a JPEG as returned by JPEGInfo. SamplingFactors holds the horizontal
+// and vertical sampling factor of each component. Subsampling is the chroma subsampling in J:a:b notation, e.g.
+// "4:2:0", and empty for grey JPEGs and sampling factors without a common notation.
+type JPEGHeader struct {
+	Width           int
+	Height          int
+	Precision       int
+	Components      int
+	Progressive     bool
+	Subsampling     string
+	SamplingFactors [][2]int
+	ColorTransform  JPEGColorTransform
+}
+
+// jpegSubsamplings maps the ratio of the luma to the chroma sampling factors to the J:a:b notation
+var jpegSubsamplings = map[[2]int]string{
+	{1, 1}: "4:4:4",
+	{2, 1}: "4:2:2",
+	{2, 2}: "4:2:0",
+	{1, 2}: "4:4:0",
+	{4, 1}: "4:1:1",
+	{4, 2}: "4:1:0",
+}
+
+// JPEGInfo reads the frame parameters of a JPEG from its markers without decoding it, e.g. to keep the chroma
+// subsampling of the source when re-encoding. The color transform is derived like libjpeg does, from the Adobe
+// and JFIF segments and the component ids.
+func JPEGInfo(buf []byte) (*JPEGHeader, error) {
+	segments, err := readJPEGSegments(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	var header *JPEGHeader
+	jfif, adobe, transform := false, false, byte(0)
+	var ids []byte
+
+	for _, segment := range segments {
+		switch {
+		case segment.marker == jpegMarkerAPP0 && bytes.HasPrefix(segment.data, []byte("JFIF\x00")):
+			jfif = true
+		case segment.marker == jpegMarkerAPP14 && len(segment.data) >= 12 && bytes.HasPrefix(segment.data, []byte("Adobe")):
+			adobe, transform = true, segment.data[11]
+		case isJPEGFrameMarker(segment.marker) && header == nil:
+			data := segment.data
+			if len(data) < 6 || len(data) < 6+3*int(data[5]) || data[5] == 0 {
+				return nil, errInvalidJPEG
+			}
+
+			header = &JPEGHeader{
+				Precision:   int(data[0]),
+				Height:      int(data[1])<<8 | int(data[2]),
+				Width:       int(data[3])<<8 | int(data[4]),
+				Components:  int(data[5]),
+				Progressive: segment.marker&0x03 == 0x02,
+			}
+			for i := 0; i < header.Components; i++ {
+				ids = append(ids, data[6+3*i])
+				sampling := data[7+3*i]
+				header.SamplingFactors = append(header.SamplingFactors, [2]int{int(sampling >> 4), int(sampling & 0x0F)})
+			}
+		}
+	}
+
+	if header == nil {
+		return nil, errInvalidJPEG
+	}
+
+	switch header.Components {
+	case 3:
+		switch {
+		case jfif:
+			header.ColorTransform = JPEGColorTransformYCbCr
+		case adobe && transform == 0:
+			header.ColorTransform = JPEGColorTransformNone
+		case !adobe && string(ids) == "RGB":
+			header.ColorTransform = JPEGColorTransformNone
+		default:
+			header.ColorTransform = JPEGColorTransformYCbCr
+		}
+	case 4:
+		if adobe && transform == 2 {
+			header.ColorTransform = JPEGColorTransformYCCK
+		}
+	}
+
+	if header.Components >= 3 {
+		luma, chroma := header.SamplingFactors[0], header.SamplingFactors[1]
+		if chroma == header.SamplingFactors[2] && chroma[0] > 0 && chroma[1] > 0 &&
+			luma[0]%chroma[0] == 0 && luma[1]%chroma[1] == 0 {
+			header.Subsampling = jpegSubsamplings[[2]int{luma[0] / chroma[0], luma[1] / chroma[1]}]
+		}
+	}
+
+	return header, nil
+}
+
+// isJPEGFrameMarker checks whether the marker is a start of frame, SOF0 to SOF15 except DHT, JPG and DAC
+func isJPEGFrameMarker(marker byte) bool {
+	return marker >= jpegMarkerSOF0 && marker <= 0xCF && marker != jpegMarkerDHT && marker != 0xC8 && marker != 0xCC
+}
+
+// isJPEGProgressive checks whether the JPEG is encoded with a progressive DCT frame
+func isJPEGProgressive(segments []jpegSegment) bool {
+	for _, segment := range segments {
+		if segment.marker == jpegMarkerSOF2 {
+			return true
+		}
+	}
+	return false
+}
+
+// MakeJPEGProgressive converts a baseline JPEG to a progressive JPEG losslessly, like jpegtran -progressive: the
+// quantized DCT coefficients are kept and only the entropy coding is rewritten, so the pixels don't change.
+// Metadata segments are kept, restart markers are dropped. Progressive JPEGs are returned unchanged. Arithmetic
+// coded, 12-bit and multi-scan JPEGs fail with ErrUnsupportedImageFormat.
+func MakeJPEGProgressive(buf []byte) ([]byte, error) {
+	segments, err := readJPEGSegments(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	if isJPEGProgressive(segments) {
+		return buf, nil
+	}
+
+	j, err := readBaselineJPEG(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	coefficients, err := j.decode(0, 0, j.width, j.height)
+	if err != nil {
+		return nil, err
+	}
+
+	return coefficients.writeProgressive(j.segments, j.frame, false), nil
+}
+
+// OptimizeJPEG rewrites a baseline JPEG with Huffman tables optimized for its data, like jpegtran -optimize, e.g.
+// as the size reduction stage of an optimizer. The quantized DCT coefficients are kept, so the pixels don't
+// change, and so are the metadata segments. Restart markers are dropped. The original buffer is returned if the
+// rewrite doesn't make it smaller. Progressive JPEGs are returned unchanged, as encoders always optimize their
+// tables. Arithmetic coded, 12-bit and multi-scan JPEGs fail with ErrUnsupportedImageFormat.
+func OptimizeJPEG(buf []byte) ([]byte, error) {
+	segments, err := readJPEGSegments(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	if isJPEGProgressive(segments) {
+		return buf, nil
+	}
+
+	j, err := readBaselineJPEG(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	coefficients, err := j.decode(0, 0, j.width, j.height)
+	if err != nil {
+		return nil, err
+	}
+
+	out := coefficients.write(j.segments, j.frame, false)
+	if len(out) >= len(buf) {
+		return buf, nil
+	}
+
+	return out, nil
+}
+
+// jpegStandardLuminanceTable is the luminance quantization table of the JPEG standard (Table K.1) in the
+// zigzag order used by DQT segments. libjpeg scales it by the quality.
+var jpegStandardLuminanceTable = [64]int{
+	16, 11, 12, 14, 12, 10, 16, 14, 13, 14, 18, 17, 16, 19, 24, 40,
+	26, 24, 22, 22, 24, 49, 35, 37, 29, 40, 58, 51, 61, 60, 57, 51,
+	56, 55, 64, 72, 92, 78, 64, 68, 87, 69, 55, 56, 80, 109, 81, 87,
+	95, 98, 103, 104, 103, 62, 77, 113, 121, 112, 100, 120, 92, 101, 103, 99,
+}
+
+// EstimateJPEGQuality estimates the 1-100 quality a JPEG was encoded with by matching its luminance
+// quantization table against the scaled tables of the JPEG standard, as used by libjpeg and most encoders.
+// Encoders with custom tables (e.g. mozjpeg) give approximate results.
+func EstimateJPEGQuality(buf []byte) (int, error) {
+	segments, err := readJPEGSegments(buf)
+	if err != nil {
+		return 0, err
+	}
+
+	table, ok := readJPEGLuminanceTable(segments)
+	if !ok {
+		return 0, errors.New("JPEG has no luminance quantization table")
+	}
+
+	quality, minDiff := 0, -1
+	for q := 1; q <= 100; q++ {
+		scale := 200 - 2*q
+		if q < 50 {
+			scale = 5000 / q
+		}
+
+		diff := 0
+		for i, std := range jpegStandardLuminanceTable {
+			scaled := (std*scale + 50) / 100
+			if scaled < 1 {
+				scaled = 1
+			} else if scaled > 255 {
+				scaled = 255
+			}
+
+			if d := table[i] - scaled; d < 0 {
+				diff -= d
+			} else {
+				diff += d
+			}
+		}
+
+		if minDiff < 0 || diff < minDiff {
+			quality, minDiff = q, diff
+		}
+	}
+
+	return quality, nil
+}
+
+// readJPEGLuminanceTable returns quantization table 0, which encoders use for the luminance channel
+func readJPEGLuminanceTable(segments []jpegSegment) ([64]int, bool) {
+	var table [64]int
+
+	for _, segment := range segments {
+		if segment.marker != jpegMarkerDQT {
+			continue
+		}
+
+		data := segment.data
+		for len(data) > 0 {
+			precision, id := data[0]>>4, data[0]&0x0F
+			size := 64
+			if precision != 0 {
+				size = 128
+			}
+			if len(data) < 1+size {
+				break
+			}
+
+			if id == 0 {
+				for i := range table {
+					if precision != 0 {
+						table[i] = int(data[1+2*i])<<8 | int(data[2+2*i])
+					} else {
+						table[i] = int(data[1+i])
+					}
+				}
+				return table, true
+			}
+
+			data = data[1+size:]
+		}
+	}
+
+	return table, false
+}
@@ -0,0 +1,955 @@
+package vips
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var errJPEGEntropyData = errors.New("invalid JPEG entropy coded data")
+
+// jpegComponent is an image component of a JPEG frame along with the tables of its scan
+type jpegComponent struct {
+	id      byte
+	h, v    int
+	dcTable int
+	acTable int
+}
+
+// jpegHuffmanTable is a Huffman table for decoding, built from the number of codes of each length from 1 to 16
+// bits and the symbols in the order of their codes as stored in a DHT segment
+type jpegHuffmanTable struct {
+	symbols []byte
+
+	// decoding tables, see Figure F.16
+	minCode [17]int32
+	maxCode [18]int32
+	valPtr  [17]int32
+}
+
+func newJPEGHuffmanTable(counts [16]byte, symbols []byte) *jpegHuffmanTable {
+	t := &jpegHuffmanTable{symbols: symbols}
+
+	code, k := int32(0), int32(0)
+	for l := 1; l <= 16; l++ {
+		t.valPtr[l] = k
+		t.minCode[l] = code
+		code += int32(counts[l-1])
+		k += int32(counts[l-1])
+		if counts[l-1] == 0 {
+			t.maxCode[l] = -1
+		} else {
+			t.maxCode[l] = code - 1
+		}
+		code <<= 1
+	}
+	t.maxCode[17] = 0x7FFFFFFF
+
+	return t
+}
+
+// baselineJPEG is a baseline JPEG with a single interleaved scan, parsed for transcoding its quantized DCT
+// coefficients without decoding the pixels
+type baselineJPEG struct {
+	segments        []jpegSegment
+	frame           *jpegSegment
+	components      []jpegComponent
+	tables          map[int]*jpegHuffmanTable
+	restartInterval int
+	width, height   int
+	mcuWidth        int
+	mcuHeight       int
+	entropy         []byte
+}
+
+// readBaselineJPEG parses the markers of a baseline JPEG. Progressive, arithmetic coded, 12-bit and multi-scan
+// JPEGs fail with ErrUnsupportedImageFormat.
+func readBaselineJPEG(buf []byte) (*baselineJPEG, error) {
+	segments, err := readJPEGSegments(buf)
+	if err != nil {
+		return nil, err
+	}
+	if len(segments) == 0 || segments[len(segments)-1].marker != jpegMarkerSOS {
+		return nil, errInvalidJPEG
+	}
+
+	j := &baselineJPEG{segments: segments, tables: map[int]*jpegHuffmanTable{}}
+
+	for i := range segments {
+		segment := &segments[i]
+		switch {
+		case segment.marker == jpegMarkerSOF0 || segment.marker == jpegMarkerSOF1:
+			if j.frame != nil {
+				return nil, errInvalidJPEG
+			}
+			j.frame = segment
+			if j.components, err = readJPEGFrameComponents(segment.data); err != nil {
+				return nil, err
+			}
+		case isJPEGFrameMarker(segment.marker):
+			return nil, fmt.Errorf("%w: lossless transcoding requires a baseline JPEG", ErrUnsupportedImageFormat)
+		case segment.marker == jpegMarkerDHT:
+			if err := readJPEGHuffmanTables(segment.data, j.tables); err != nil {
+				return nil, err
+			}
+		case segment.marker == jpegMarkerDRI:
+			if len(segment.data) != 2 {
+				return nil, errInvalidJPEG
+			}
+			j.restartInterval = int(segment.data[0])<<8 | int(segment.data[1])
+		}
+	}
+	if j.frame == nil {
+		return nil, errInvalidJPEG
+	}
+
+	scan := segments[len(segments)-1]
+	if err := readJPEGScanTables(scan.data, j.components, j.tables); err != nil {
+		return nil, err
+	}
+	j.entropy = buf[scan.offset+4+len(scan.data):]
+
+	j.width = int(j.frame.data[3])<<8 | int(j.frame.data[4])
+	j.height = int(j.frame.data[1])<<8 | int(j.frame.data[2])
+	if j.width == 0 || j.height == 0 {
+		return nil, errInvalidJPEG
+	}
+
+	// a scan with a single component is not interleaved, its MCU is a single block
+	if len(j.components) == 1 {
+		j.components[0].h, j.components[0].v = 1, 1
+	}
+	maxH, maxV := 1, 1
+	for _, c := range j.components {
+		if c.h > maxH {
+			maxH = c.h
+		}
+		if c.v > maxV {
+			maxV = c.v
+		}
+	}
+	j.mcuWidth, j.mcuHeight = 8*maxH, 8*maxV
+
+	return j, nil
+}
+
+// decode reads the coefficients of the MCUs within the area, given in pixels aligned to the MCU grid
+func (j *baselineJPEG) decode(left, top, right, bottom int) (*jpegCrop, error) {
+	crop := &jpegCrop{
+		components: j.components,
+		width:      right - left,
+		height:     bottom - top,
+		mcuLeft:    left / j.mcuWidth,
+		mcuTop:     top / j.mcuHeight,
+		mcusX:      (right - left + j.mcuWidth - 1) / j.mcuWidth,
+		mcusY:      (bottom - top + j.mcuHeight - 1) / j.mcuHeight,
+	}
+
+	mcusPerLine := (j.width + j.mcuWidth - 1) / j.mcuWidth
+	if err := crop.decode(j.entropy, j.tables, mcusPerLine, j.restartInterval); err != nil {
+		return nil, err
+	}
+
+	return crop, nil
+}
+
+// CropJPEGLossless crops a baseline JPEG without decoding and re-encoding the pixels, like jpegtran -crop, so
+// the kept area has no generation loss. The crop is done on whole MCUs (8 or 16 pixels, depending on the chroma
+// subsampling): x and y are snapped down to the MCU grid and the width and height grow by the same amount, so
+// the result always covers the requested area. The area is clipped to the image. The coordinates refer to the
+// stored pixels, regardless of the EXIF orientation. Metadata segments are kept, except for embedded previews
+// of the uncropped image, which would leak the removed area: the EXIF thumbnail, MPF and FlashPix previews and
+// Photoshop thumbnails are removed. Progressive and arithmetic coded JPEGs are not supported.
+func CropJPEGLossless(buf []byte, x, y, w, h int) ([]byte, error) {
+	j, err := readBaselineJPEG(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	if w <= 0 || h <= 0 || x < 0 || y < 0 || x >= j.width || y >= j.height {
+		return nil, fmt.Errorf("crop area %dx%d at %d,%d is outside of the %dx%d image", w, h, x, y, j.width, j.height)
+	}
+
+	left, top := x-x%j.mcuWidth, y-y%j.mcuHeight
+	right, bottom := x+w, y+h
+	if right > j.width {
+		right = j.width
+	}
+	if bottom > j.height {
+		bottom = j.height
+	}
+
+	crop, err := j.decode(left, top, right, bottom)
+	if err != nil {
+		return nil, err
+	}
+
+	return crop.write(j.segments, j.frame, true), nil
+}
+
+// readJPEGFrameComponents reads the components of an 8-bit SOF segment
+func readJPEGFrameComponents(data []byte) ([]jpegComponent, error) {
+	if len(data) < 6 {
+		return nil, errInvalidJPEG
+	}
+	if data[0] != 8 {
+		return nil, fmt.Errorf("%w: lossless transcoding requires an 8-bit JPEG", ErrUnsupportedImageFormat)
+	}
+
+	n := int(data[5])
+	if n == 0 || len(data) < 6+3*n {
+		return nil, errInvalidJPEG
+	}
+
+	components := make([]jpegComponent, n)
+	for i := range components {
+		sampling := data[7+3*i]
+		components[i] = jpegComponent{id: data[6+3*i], h: int(sampling >> 4), v: int(sampling & 0x0F)}
+		if components[i].h < 1 || components[i].h > 4 || components[i].v < 1 || components[i].v > 4 {
+			return nil, errInvalidJPEG
+		}
+	}
+
+	return components, nil
+}
+
+// readJPEGHuffmanTables reads the tables of a DHT segment, keyed by class (0 for DC, 1 for AC) * 4 + id
+func readJPEGHuffmanTables(data []byte, tables map[int]*jpegHuffmanTable) error {
+	for len(data) > 0 {
+		if len(data) < 17 || data[0]>>4 > 1 || data[0]&0x0F > 3 {
+			return errInvalidJPEG
+		}
+
+		var counts [16]byte
+		copy(counts[:], data[1:17])
+		total := 0
+		for _, count := range counts {
+			total += int(count)
+		}
+		if total > 256 || len(data) < 17+total {
+			return errInvalidJPEG
+		}
+
+		symbols := append([]byte(nil), data[17:17+total]...)
+		tables[int(data[0]>>4)*4+int(data[0]&0x0F)] = newJPEGHuffmanTable(counts, symbols)
+		data = data[17+total:]
+	}
+	return nil
+}
+
+// readJPEGScanTables reads the table selectors of an SOS segment, which must contain all components
+func readJPEGScanTables(data []byte, components []jpegComponent, tables map[int]*jpegHuffmanTable) error {
+	if len(data) < 1 {
+		return errInvalidJPEG
+	}
+
+	n := int(data[0])
+	if len(data) != 4+2*n {
+		return errInvalidJPEG
+	}
+	if n != len(components) {
+		return fmt.Errorf("%w: lossless transcoding requires a JPEG with a single scan", ErrUnsupportedImageFormat)
+	}
+	if data[1+2*n] != 0 || data[2+2*n] != 63 || data[3+2*n] != 0 {
+		return errInvalidJPEG
+	}
+
+	for i := range components {
+		if data[1+2*i] != components[i].id {
+			return errInvalidJPEG
+		}
+		components[i].dcTable = int(data[2+2*i] >> 4)
+		components[i].acTable = 4 + int(data[2+2*i]&0x0F)
+		if tables[components[i].dcTable] == nil || tables[components[i].acTable] == nil {
+			return errInvalidJPEG
+		}
+	}
+
+	return nil
+}
+
+// jpegCrop holds the quantized DCT coefficients, in zigzag order, of the blocks within the cropped MCUs
+type jpegCrop struct {
+	components    []jpegComponent
+	width, height int
+	mcuLeft       int
+	mcuTop        int
+	mcusX, mcusY  int
+	blocks        [][][64]int32
+	blocksPerLine []int
+}
+
+// decode reads the coefficients of the cropped blocks from the entropy coded data of the scan. Decoding stops
+// after the last cropped MCU row.
+func (c *jpegCrop) decode(data []byte, tables map[int]*jpegHuffmanTable, mcusPerLine, restartInterval int) error {
+	c.blocks = make([][][64]int32, len(c.components))
+	c.blocksPerLine = make([]int, len(c.components))
+	for i, component := range c.components {
+		c.blocksPerLine[i] = c.mcusX * component.h
+		c.blocks[i] = make([][64]int32, c.blocksPerLine[i]*c.mcusY*component.v)
+	}
+
+	r := &jpegBitReader{data: data}
+	predictors := make([]int32, len(c.components))
+	var scratch [64]int32
+
+	for mcuY := 0; mcuY < c.mcuTop+c.mcusY; mcuY++ {
+		for mcuX := 0; mcuX < mcusPerLine; mcuX++ {
+			mcu := mcuY*mcusPerLine + mcuX
+			if restartInterval > 0 && mcu > 0 && mcu%restartInterval == 0 {
+				if err := r.restart(); err != nil {
+					return err
+				}
+				for i := range predictors {
+					predictors[i] = 0
+				}
+			}
+
+			cropX, cropY := mcuX-c.mcuLeft, mcuY-c.mcuTop
+			inCrop := cropX >= 0 && cropX < c.mcusX && cropY >= 0
+
+			for i, component := range c.components {
+				for v := 0; v < component.v; v++ {
+					for h := 0; h < component.h; h++ {
+						block := &scratch
+						if inCrop {
+							index := (cropY*component.v+v)*c.blocksPerLine[i] + cropX*component.h + h
+							block = &c.blocks[i][index]
+						}
+						if err := r.decodeBlock(block, &predictors[i], tables[component.dcTable], tables[component.acTable]); err != nil {
+							return err
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// encode walks the cropped blocks in MCU order and passes each Huffman symbol with its extra bits to emit
+func (c *jpegCrop) encode(emit func(table int, symbol byte, bits uint32, size uint)) {
+	predictors := make([]int32, len(c.components))
+
+	for mcuY := 0; mcuY < c.mcusY; mcuY++ {
+		for mcuX := 0; mcuX < c.mcusX; mcuX++ {
+			for i, component := range c.components {
+				for v := 0; v < component.v; v++ {
+					for h := 0; h < component.h; h++ {
+						block := &c.blocks[i][(mcuY*component.v+v)*c.blocksPerLine[i]+mcuX*component.h+h]
+
+						diff := block[0] - predictors[i]
+						predictors[i] = block[0]
+						bits, size := jpegMagnitude(diff)
+						emit(component.dcTable, byte(size), bits, size)
+
+						run := 0
+						for k := 1; k < 64; k++ {
+							if block[k] == 0 {
+								run++
+								continue
+							}
+							for ; run > 15; run -= 16 {
+								emit(component.acTable, 0xF0, 0, 0)
+							}
+							bits, size := jpegMagnitude(block[k])
+							emit(component.acTable, byte(run<<4)|byte(size), bits, size)
+							run = 0
+						}
+						if run > 0 {
+							emit(component.acTable, 0x00, 0, 0)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// jpegHuffmanCodes holds the DHT payload of Huffman tables optimized for symbol frequencies, along with the
+// code and code size of each symbol, keyed like the decoding tables by class * 4 + id
+type jpegHuffmanCodes struct {
+	dht       []byte
+	codes     [8][256]uint16
+	codeSizes [8][256]uint
+}
+
+// newJPEGHuffmanCodes builds optimized Huffman tables for the tables which have any symbols
+func newJPEGHuffmanCodes(frequencies *[8][257]int) *jpegHuffmanCodes {
+	h := &jpegHuffmanCodes{}
+
+	for table := range frequencies {
+		used := false
+		for _, f := range frequencies[table] {
+			used = used || f > 0
+		}
+		if !used {
+			continue
+		}
+
+		counts, symbols := optimalJPEGHuffmanTable(frequencies[table])
+		h.dht = append(h.dht, byte(table/4)<<4|byte(table%4))
+		h.dht = append(h.dht, counts[:]...)
+		h.dht = append(h.dht, symbols...)
+
+		code, k := uint16(0), 0
+		for l := 1; l <= 16; l++ {
+			for i := 0; i < int(counts[l-1]); i++ {
+				h.codes[table][symbols[k]] = code
+				h.codeSizes[table][symbols[k]] = uint(l)
+				code++
+				k++
+			}
+			code <<= 1
+		}
+	}
+
+	return h
+}
+
+// encodeJPEGScan Huffman codes the symbols passed to encode into out, with tables optimized for them
+func encodeJPEGScan(out *bytes.Buffer, scan []byte, encode func(emit func(table int, symbol byte, bits uint32, size uint))) {
+	var frequencies [8][257]int
+	encode(func(table int, symbol byte, bits uint32, size uint) {
+		frequencies[table][symbol]++
+	})
+	h := newJPEGHuffmanCodes(&frequencies)
+
+	writeJPEGSegment(out, jpegMarkerDHT, h.dht)
+	writeJPEGSegment(out, jpegMarkerSOS, scan)
+
+	w := &jpegBitWriter{out: out}
+	encode(func(table int, symbol byte, bits uint32, size uint) {
+		w.writeBits(uint32(h.codes[table][symbol]), h.codeSizes[table][symbol])
+		w.writeBits(bits, size)
+	})
+	w.flush()
+}
+
+func writeJPEGSegment(out *bytes.Buffer, marker byte, data []byte) {
+	out.Write([]byte{0xFF, marker, byte((len(data) + 2) >> 8), byte(len(data) + 2)})
+	out.Write(data)
+}
+
+// writeHeader writes the segments of the original up to the scan, with a frame of the given marker and the
+// size of the crop. Huffman tables and restart intervals are left out, they are written for the new scans.
+func (c *jpegCrop) writeHeader(out *bytes.Buffer, segments []jpegSegment, frame *jpegSegment, marker byte, stripPreviews bool) {
+	out.Write([]byte{0xFF, jpegMarkerSOI})
+
+	for _, segment := range segments {
+		switch {
+		case segment.marker == jpegMarkerDHT, segment.marker == jpegMarkerDRI, segment.marker == jpegMarkerSOS:
+			continue
+		case segment.offset == frame.offset:
+			data := append([]byte(nil), segment.data...)
+			data[1], data[2] = byte(c.height>>8), byte(c.height)
+			data[3], data[4] = byte(c.width>>8), byte(c.width)
+			writeJPEGSegment(out, marker, data)
+		case stripPreviews:
+			if data, keep := removeJPEGPreview(segment); keep {
+				writeJPEGSegment(out, segment.marker, data)
+			}
+		default:
+			writeJPEGSegment(out, segment.marker, segment.data)
+		}
+	}
+}
+
+// write returns the cropped JPEG as baseline JPEG with the segments of the original, a frame of the cropped size
+// and Huffman tables optimized for the cropped data. Restart markers are not written. If stripPreviews is set,
+// embedded previews are removed from the metadata, see removeJPEGPreview.
+func (c *jpegCrop) write(segments []jpegSegment, frame *jpegSegment, stripPreviews bool) []byte {
+	var out bytes.Buffer
+	c.writeHeader(&out, segments, frame, frame.marker, stripPreviews)
+	encodeJPEGScan(&out, segments[len(segments)-1].data, c.encode)
+
+	out.Write([]byte{0xFF, jpegMarkerEOI})
+	return out.Bytes()
+}
+
+// jpegProgressiveScan is a scan of a progressive JPEG, holding the indexes of its components and its spectral
+// selection. Successive approximation is not used, so every coefficient is written in full by a single scan.
+type jpegProgressiveScan struct {
+	components []int
+	ss, se     int
+}
+
+// jpegProgressiveScans returns the scans used for progressive JPEGs, following the simple progression of libjpeg
+// without successive approximation: the DC coefficients of all components first, then the low frequencies of
+// the first (luma) component, the AC coefficients of the other components and the high frequencies of the
+// first component.
+func jpegProgressiveScans(components int) []jpegProgressiveScan {
+	dc := jpegProgressiveScan{}
+	for i := 0; i < components; i++ {
+		dc.components = append(dc.components, i)
+	}
+
+	scans := []jpegProgressiveScan{dc, {components: []int{0}, ss: 1, se: 5}}
+	for i := 1; i < components; i++ {
+		scans = append(scans, jpegProgressiveScan{components: []int{i}, ss: 1, se: 63})
+	}
+	return append(scans, jpegProgressiveScan{components: []int{0}, ss: 6, se: 63})
+}
+
+// writeProgressive returns the cropped JPEG as progressive JPEG, otherwise like write
+func (c *jpegCrop) writeProgressive(segments []jpegSegment, frame *jpegSegment, stripPreviews bool) []byte {
+	var out bytes.Buffer
+	c.writeHeader(&out, segments, frame, jpegMarkerSOF2, stripPreviews)
+
+	for _, scan := range jpegProgressiveScans(len(c.components)) {
+		scan := scan
+
+		header := []byte{byte(len(scan.components))}
+		for _, i := range scan.components {
+			component := c.components[i]
+			header = append(header, component.id, byte(component.dcTable)<<4|byte(component.acTable-4))
+		}
+		header = append(header, byte(scan.ss), byte(scan.se), 0)
+
+		encodeJPEGScan(&out, header, func(emit func(table int, symbol byte, bits uint32, size uint)) {
+			c.encodeProgressive(scan, emit)
+		})
+	}
+
+	out.Write([]byte{0xFF, jpegMarkerEOI})
+	return out.Bytes()
+}
+
+// scanBlocks calls fn for each block of the scan in coding order. Scans with several components are
+// interleaved and walk the MCUs, scans with a single component walk the blocks covering the component only,
+// leaving out the padding blocks of partial MCUs at the right and bottom edge, see A.2.
+func (c *jpegCrop) scanBlocks(components []int, fn func(i int, block *[64]int32)) {
+	if len(components) > 1 {
+		for mcuY := 0; mcuY < c.mcusY; mcuY++ {
+			for mcuX := 0; mcuX < c.mcusX; mcuX++ {
+				for _, i := range components {
+					component := c.components[i]
+					for v := 0; v < component.v; v++ {
+						for h := 0; h < component.h; h++ {
+							fn(i, &c.blocks[i][(mcuY*component.v+v)*c.blocksPerLine[i]+mcuX*component.h+h])
+						}
+					}
+				}
+			}
+		}
+		return
+	}
+
+	maxH, maxV := 1, 1
+	for _, component := range c.components {
+		if component.h > maxH {
+			maxH = component.h
+		}
+		if component.v > maxV {
+			maxV = component.v
+		}
+	}
+
+	i := components[0]
+	component := c.components[i]
+	blocksX := ((c.width*component.h+maxH-1)/maxH + 7) / 8
+	blocksY := ((c.height*component.v+maxV-1)/maxV + 7) / 8
+	for y := 0; y < blocksY; y++ {
+		for x := 0; x < blocksX; x++ {
+			fn(i, &c.blocks[i][y*c.blocksPerLine[i]+x])
+		}
+	}
+}
+
+// encodeProgressive passes the Huffman symbols of a progressive scan with their extra bits to emit. DC scans
+// code the differences like baseline scans, AC scans code runs of blocks without coefficients in the spectral
+// selection as end of band runs, see G.1.2.
+func (c *jpegCrop) encodeProgressive(scan jpegProgressiveScan, emit func(table int, symbol byte, bits uint32, size uint)) {
+	if scan.ss == 0 {
+		predictors := make([]int32, len(c.components))
+		c.scanBlocks(scan.components, func(i int, block *[64]int32) {
+			diff := block[0] - predictors[i]
+			predictors[i] = block[0]
+			bits, size := jpegMagnitude(diff)
+			emit(c.components[i].dcTable, byte(size), bits, size)
+		})
+		return
+	}
+
+	table := c.components[scan.components[0]].acTable
+	eobRun := 0
+	flushEOBRun := func() {
+		if eobRun == 0 {
+			return
+		}
+		n := uint(0)
+		for eobRun>>(n+1) > 0 {
+			n++
+		}
+		emit(table, byte(n<<4), uint32(eobRun)&(1<<n-1), n)
+		eobRun = 0
+	}
+
+	c.scanBlocks(scan.components, func(i int, block *[64]int32) {
+		last := scan.ss - 1
+		for k := scan.se; k >= scan.ss; k-- {
+			if block[k] != 0 {
+				last = k
+				break
+			}
+		}
+
+		if last >= scan.ss {
+			flushEOBRun()
+
+			run := 0
+			for k := scan.ss; k <= last; k++ {
+				if block[k] == 0 {
+					run++
+					continue
+				}
+				for ; run > 15; run -= 16 {
+					emit(table, 0xF0, 0, 0)
+				}
+				bits, size := jpegMagnitude(block[k])
+				emit(table, byte(run<<4)|byte(size), bits, size)
+				run = 0
+			}
+		}
+
+		if last < scan.se {
+			eobRun++
+			if eobRun == 0x7FFF {
+				flushEOBRun()
+			}
+		}
+	})
+	flushEOBRun()
+}
+
+// removeJPEGPreview removes embedded previews from a metadata segment: the thumbnail in IFD1 of the EXIF data,
+// thumbnail resources of Photoshop segments, and MPF and FlashPix segments, which hold preview images. It returns
+// false if the whole segment is to be removed.
+func removeJPEGPreview(segment jpegSegment) ([]byte, bool) {
+	data := segment.data
+
+	switch segment.marker {
+	case jpegMarkerAPP1:
+		if bytes.HasPrefix(data, exifHeader) {
+			if exif, ok := removeEXIFThumbnail(data); ok {
+				return exif, true
+			}
+		}
+	case jpegMarkerAPP2:
+		if bytes.HasPrefix(data, []byte("MPF\x00")) || bytes.HasPrefix(data, []byte("FPXR\x00")) {
+			return nil, false
+		}
+	case jpegMarkerAPP13:
+		if bytes.HasPrefix(data, photoshopHeader) {
+			return removePhotoshopThumbnails(data), true
+		}
+	}
+
+	return data, true
+}
+
+// photoshopHeader is the prefix of the APP13 segments holding Photoshop image resources
+var photoshopHeader = []byte("Photoshop 3.0\x00")
+
+// removePhotoshopThumbnails removes the thumbnail resources (0x0409 and 0x040C) from the Photoshop image
+// resources of an APP13 segment. The remaining resources, e.g. IPTC data, are kept. Data which cannot be parsed
+// is kept up to the last complete resource.
+func removePhotoshopThumbnails(data []byte) []byte {
+	out := append([]byte(nil), photoshopHeader...)
+
+	pos := len(photoshopHeader)
+	for pos+8 <= len(data) && bytes.Equal(data[pos:pos+4], []byte("8BIM")) {
+		id := int(data[pos+4])<<8 | int(data[pos+5])
+
+		// the name is a Pascal string padded to an even size
+		nameEnd := pos + 6 + 1 + int(data[pos+6])
+		if nameEnd%2 != 0 {
+			nameEnd++
+		}
+		if nameEnd+4 > len(data) {
+			break
+		}
+
+		size := int(binary.BigEndian.Uint32(data[nameEnd:]))
+		end := nameEnd + 4 + size
+		if end > len(data) {
+			break
+		}
+		// the data is padded to an even size as well, except by some writers for the last resource
+		if size%2 != 0 && end < len(data) {
+			end++
+		}
+
+		if id != 0x0409 && id != 0x040C {
+			out = append(out, data[pos:end]...)
+		}
+		pos = end
+	}
+
+	return out
+}
+
+// jpegMagnitude returns the extra bits and their number for a coefficient value, see F.1.2.1
+func jpegMagnitude(value int32) (uint32, uint) {
+	magnitude := value
+	if magnitude < 0 {
+		magnitude = -magnitude
+		value--
+	}
+
+	size := uint(0)
+	for magnitude > 0 {
+		size++
+		magnitude >>= 1
+	}
+
+	return uint32(value) & (1<<size - 1), size
+}
+
+// optimalJPEGHuffmanTable builds a Huffman table with codes of at most 16 bits for the symbol frequencies,
+// following Annex K.2. The last entry of frequencies is reserved so that no code consists of only 1 bits.
+func optimalJPEGHuffmanTable(frequencies [257]int) ([16]byte, []byte) {
+	frequencies[256] = 1
+
+	var codeSize [257]int
+	var others [257]int
+	for i := range others {
+		others[i] = -1
+	}
+
+	for {
+		// find the least and the second least frequent symbols, preferring higher symbols on ties
+		v1, v2 := -1, -1
+		for i, f := range frequencies {
+			if f > 0 && (v1 < 0 || f <= frequencies[v1]) {
+				v1 = i
+			}
+		}
+		for i, f := range frequencies {
+			if f > 0 && i != v1 && (v2 < 0 || f <= frequencies[v2]) {
+				v2 = i
+			}
+		}
+		if v2 < 0 {
+			break
+		}
+
+		frequencies[v1] += frequencies[v2]
+		frequencies[v2] = 0
+
+		codeSize[v1]++
+		for others[v1] >= 0 {
+			v1 = others[v1]
+			codeSize[v1]++
+		}
+		others[v1] = v2
+
+		codeSize[v2]++
+		for others[v2] >= 0 {
+			v2 = others[v2]
+			codeSize[v2]++
+		}
+	}
+
+	var counts [258]int
+	for _, size := range codeSize {
+		if size > 0 {
+			counts[size]++
+		}
+	}
+
+	// limit the code lengths to 16 bits, see Figure K.3
+	for i := len(counts) - 1; i > 16; i-- {
+		for counts[i] > 0 {
+			j := i - 2
+			for counts[j] == 0 {
+				j--
+			}
+			counts[i] -= 2
+			counts[i-1]++
+			counts[j+1] += 2
+			counts[j]--
+		}
+	}
+
+	// remove the reserved symbol, which has the longest code
+	i := 16
+	for counts[i] == 0 {
+		i--
+	}
+	counts[i]--
+
+	var limited [16]byte
+	for l := 1; l <= 16; l++ {
+		limited[l-1] = byte(counts[l])
+	}
+
+	var symbols []byte
+	for size := 1; size < len(counts); size++ {
+		for symbol := 0; symbol < 256; symbol++ {
+			if codeSize[symbol] == size {
+				symbols = append(symbols, byte(symbol))
+			}
+		}
+	}
+
+	return limited, symbols
+}
+
+// jpegBitReader reads the entropy coded data of a scan, removing the stuffed zero bytes
+type jpegBitReader struct {
+	data []byte
+	pos  int
+	bits uint32
+	n    uint
+}
+
+func (r *jpegBitReader) readBits(n uint) (uint32, error) {
+	for r.n < n {
+		if r.pos >= len(r.data) {
+			return 0, errJPEGEntropyData
+		}
+
+		b := r.data[r.pos]
+		if b == 0xFF {
+			// any marker other than a stuffed zero byte ends the data of the interval
+			if r.pos+1 >= len(r.data) || r.data[r.pos+1] != 0x00 {
+				return 0, errJPEGEntropyData
+			}
+			r.pos++
+		}
+		r.pos++
+
+		r.bits = r.bits<<8 | uint32(b)
+		r.n += 8
+	}
+
+	r.n -= n
+	return (r.bits >> r.n) & (1<<n - 1), nil
+}
+
+// restart skips the padding bits and the restart marker at the end of a restart interval
+func (r *jpegBitReader) restart() error {
+	r.n = 0
+	for r.pos < len(r.data) && r.data[r.pos] == 0xFF && r.pos+1 < len(r.data) && r.data[r.pos+1] == 0xFF {
+		r.pos++
+	}
+	if r.pos+1 >= len(r.data) || r.data[r.pos] != 0xFF || r.data[r.pos+1] < 0xD0 || r.data[r.pos+1] > 0xD7 {
+		return errJPEGEntropyData
+	}
+	r.pos += 2
+	return nil
+}
+
+// decodeSymbol decodes a Huffman coded symbol, see Figure F.16
+func (r *jpegBitReader) decodeSymbol(t *jpegHuffmanTable) (byte, error) {
+	code := int32(0)
+	for l := 1; l <= 16; l++ {
+		bit, err := r.readBits(1)
+		if err != nil {
+			return 0, err
+		}
+		code = code<<1 | int32(bit)
+		if code <= t.maxCode[l] {
+			return t.symbols[t.valPtr[l]+code-t.minCode[l]], nil
+		}
+	}
+	return 0, errJPEGEntropyData
+}
+
+// receiveExtend reads a coefficient value of the given size, see Figure F.12
+func (r *jpegBitReader) receiveExtend(size uint) (int32, error) {
+	if size == 0 {
+		return 0, nil
+	}
+	if size > 16 {
+		return 0, errJPEGEntropyData
+	}
+
+	bits, err := r.readBits(size)
+	if err != nil {
+		return 0, err
+	}
+
+	value := int32(bits)
+	if value < 1<<(size-1) {
+		value += -1<<size + 1
+	}
+	return value, nil
+}
+
+// decodeBlock decodes the quantized coefficients of a block, see F.2.2
+func (r *jpegBitReader) decodeBlock(block *[64]int32, predictor *int32, dc, ac *jpegHuffmanTable) error {
+	*block = [64]int32{}
+
+	size, err := r.decodeSymbol(dc)
+	if err != nil {
+		return err
+	}
+	diff, err := r.receiveExtend(uint(size))
+	if err != nil {
+		return err
+	}
+	*predictor += diff
+	block[0] = *predictor
+
+	for k := 1; k < 64; k++ {
+		symbol, err := r.decodeSymbol(ac)
+		if err != nil {
+			return err
+		}
+
+		run, size := int(symbol>>4), uint(symbol&0x0F)
+		if size == 0 {
+			if run != 15 {
+				// end of block
+				return nil
+			}
+			k += 15
+			continue
+		}
+
+		k += run
+		if k > 63 {
+			return errJPEGEntropyData
+		}
+		if block[k], err = r.receiveExtend(size); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// jpegBitWriter writes entropy coded data, stuffing a zero byte after each 0xFF byte
+type jpegBitWriter struct {
+	out  *bytes.Buffer
+	bits uint32
+	n    uint
+}
+
+func (w *jpegBitWriter) writeBits(bits uint32, n uint) {
+	if n == 0 {
+		return
+	}
+
+	w.bits = w.bits<<n | bits&(1<<n-1)
+	w.n += n
+	for w.n >= 8 {
+		b := byte(w.bits >> (w.n - 8))
+		w.out.WriteByte(b)
+		if b == 0xFF {
+			w.out.WriteByte(0x00)
+		}
+		w.n -= 8
+	}
+}
+
+// flush pads the last byte with 1 bits
+func (w *jpegBitWriter) flush() {
+	if w.n > 0 {
+		w.writeBits(1<<(8-w.n)-1, 8-w.n)
+	}
+}
@@ -0,0 +1,115 @@
+package vips
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	_ "image/jpeg"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_CropJPEGLossless(t *testing.T) {
+	tests := []struct {
+		file          string
+		x, y, w, h    int
+		left, top     int
+		width, height int
+	}{
+		// 4:2:0 subsampling with restart markers, snapped to 16x16 MCUs
+		{"orientation-issue-1.jpg", 1000, 333, 1500, 900, 992, 320, 1508, 913},
+		// clipped to the image
+		{"orientation-issue-1.jpg", 3000, 2000, 5000, 5000, 2992, 2000, 1040, 1024},
+		// grayscale, snapped to 8x8 blocks
+		{"without_exif.jpg", 13, 17, 50, 50, 8, 16, 55, 51},
+	}
+
+	for _, test := range tests {
+		buf, err := ioutil.ReadFile(resources + test.file)
+		require.NoError(t, err)
+
+		out, err := CropJPEGLossless(buf, test.x, test.y, test.w, test.h)
+		require.NoError(t, err)
+
+		original, _, err := image.Decode(bytes.NewReader(buf))
+		require.NoError(t, err)
+		cropped, _, err := image.Decode(bytes.NewReader(out))
+		require.NoError(t, err)
+
+		require.Equal(t, test.width, cropped.Bounds().Dx(), test.file)
+		require.Equal(t, test.height, cropped.Bounds().Dy(), test.file)
+
+		differences := 0
+		for y := 0; y < test.height; y++ {
+			for x := 0; x < test.width; x++ {
+				if original.At(test.left+x, test.top+y) != cropped.At(x, y) {
+					differences++
+				}
+			}
+		}
+		assert.Zero(t, differences, test.file)
+	}
+}
+
+func Test_CropJPEGLossless__Unsupported(t *testing.T) {
+	progressive, err := ioutil.ReadFile(resources + "jpg-24bit.jpg")
+	require.NoError(t, err)
+	_, err = CropJPEGLossless(progressive, 0, 0, 10, 10)
+	assert.True(t, errors.Is(err, ErrUnsupportedImageFormat))
+
+	baseline, err := ioutil.ReadFile(resources + "without_exif.jpg")
+	require.NoError(t, err)
+	_, err = CropJPEGLossless(baseline, 100, 0, 10, 10)
+	assert.Error(t, err)
+	_, err = CropJPEGLossless(baseline, 0, 0, 0, 10)
+	assert.Error(t, err)
+}
+
+func Test_CropJPEGLossless__RemovesPreviews(t *testing.T) {
+	buf, err := ioutil.ReadFile(resources + "orientation-issue-1.jpg")
+	require.NoError(t, err)
+	require.True(t, hasEXIFThumbnail(readTestEXIF(t, buf)))
+
+	segment := func(marker byte, data []byte) []byte {
+		return append([]byte{0xFF, marker, byte((len(data) + 2) >> 8), byte(len(data) + 2)}, data...)
+	}
+	resource := func(id uint16, data []byte) []byte {
+		return append([]byte{'8', 'B', 'I', 'M', byte(id >> 8), byte(id), 0, 0, 0, 0, 0, byte(len(data))}, data...)
+	}
+
+	// add an MPF preview and a Photoshop thumbnail next to the IPTC data after the EXIF segment
+	photoshop := append(append(append([]byte(nil), photoshopHeader...),
+		resource(0x0404, []byte("iptc"))...), resource(0x040C, []byte("thumbnail"))...)
+	exifEnd := 4 + (int(buf[4])<<8 | int(buf[5]))
+	var withPreviews []byte
+	withPreviews = append(withPreviews, buf[:exifEnd]...)
+	withPreviews = append(withPreviews, segment(0xE2, []byte("MPF\x00preview"))...)
+	withPreviews = append(withPreviews, segment(0xED, photoshop)...)
+	withPreviews = append(withPreviews, buf[exifEnd:]...)
+
+	out, err := CropJPEGLossless(withPreviews, 0, 0, 64, 64)
+	require.NoError(t, err)
+
+	segments, err := readJPEGSegments(out)
+	require.NoError(t, err)
+
+	exif, iptc := false, false
+	for _, segment := range segments {
+		switch segment.marker {
+		case 0xE1:
+			exif = true
+			assert.False(t, hasEXIFThumbnail(segment.data))
+		case 0xE2:
+			assert.False(t, bytes.HasPrefix(segment.data, []byte("MPF\x00")))
+		case 0xED:
+			iptc = bytes.Contains(segment.data, []byte("iptc"))
+			assert.NotContains(t, string(segment.data), "thumbnail")
+		}
+	}
+	assert.True(t, exif)
+	assert.True(t, iptc)
+	assert.Less(t, len(out), 30000)
+}
@@ -0,0 +1,268 @@
+package vips
+
+import (
+	"bytes"
+	"image"
+	_ "image/jpeg"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readTestFile(t *testing.T, file string) []byte {
+	buf, err := ioutil.ReadFile(resources + file)
+	require.NoError(t, err)
+	return buf
+}
+
+// assertSameJPEGPixels decodes both JPEGs and asserts that their pixels are identical
+func assertSameJPEGPixels(t *testing.T, expected, actual []byte, msgAndArgs ...interface{}) {
+	want, _, err := image.Decode(bytes.NewReader(expected))
+	require.NoError(t, err)
+	got, _, err := image.Decode(bytes.NewReader(actual))
+	require.NoError(t, err)
+	require.Equal(t, want.Bounds(), got.Bounds(), msgAndArgs...)
+
+	differences := 0
+	for y := want.Bounds().Min.Y; y < want.Bounds().Max.Y; y++ {
+		for x := want.Bounds().Min.X; x < want.Bounds().Max.X; x++ {
+			if want.At(x, y) != got.At(x, y) {
+				differences++
+			}
+		}
+	}
+	assert.Zero(t, differences, msgAndArgs...)
+}
+
+func Test_MakeJPEGProgressive(t *testing.T) {
+	Startup(nil)
+
+	params := NewDefaultJPEGExportParams()
+	params.Interlaced = false
+
+	img, err := NewImageFromFile(resources + "jpg-24bit.jpg")
+	require.NoError(t, err)
+	exported, _, err := img.Export(params)
+	require.NoError(t, err)
+
+	for name, baseline := range map[string][]byte{"exported": exported, "grey": readTestFile(t, "without_exif.jpg"),
+		"cmyk": readTestFile(t, "jpg-32bit-cmyk-icc-swop.jpg"), "restart markers": readTestFile(t, "jpg-orientation-6.jpg")} {
+		segments, err := readJPEGSegments(baseline)
+		require.NoError(t, err)
+		require.False(t, isJPEGProgressive(segments), name)
+
+		progressive, err := MakeJPEGProgressive(baseline)
+		require.NoError(t, err)
+
+		segments, err = readJPEGSegments(progressive)
+		require.NoError(t, err)
+		assert.True(t, isJPEGProgressive(segments), name)
+		assertSameJPEGPixels(t, baseline, progressive, name)
+
+		again, err := MakeJPEGProgressive(progressive)
+		require.NoError(t, err)
+		assert.Equal(t, progressive, again, name)
+	}
+}
+
+func Test_MakeJPEGProgressive__NotJPEG(t *testing.T) {
+	buf, err := ioutil.ReadFile(resources + "png-24bit.png")
+	require.NoError(t, err)
+
+	_, err = MakeJPEGProgressive(buf)
+	assert.Equal(t, ErrUnsupportedImageFormat, err)
+}
+
+func Test_JPEG_Density(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "jpg-24bit.jpg")
+	require.NoError(t, err)
+
+	readJFIFDensity := func(buf []byte) (byte, int, int) {
+		segments, err := readJPEGSegments(buf)
+		require.NoError(t, err)
+
+		for _, segment := range segments {
+			if segment.marker == 0xE0 && bytes.HasPrefix(segment.data, []byte("JFIF\x00")) {
+				d := segment.data
+				return d[7], int(d[8])<<8 | int(d[9]), int(d[10])<<8 | int(d[11])
+			}
+		}
+		t.Fatal("no JFIF segment")
+		return 0, 0, 0
+	}
+
+	params := NewDefaultJPEGExportParams()
+	params.Density = 300
+
+	buf, _, err := img.Export(params)
+	require.NoError(t, err)
+
+	unit, x, y := readJFIFDensity(buf)
+	assert.Equal(t, byte(1), unit)
+	assert.Equal(t, 300, x)
+	assert.Equal(t, 300, y)
+
+	params.Density = 118
+	params.DensityUnit = DensityUnitCentimeter
+
+	buf, _, err = img.Export(params)
+	require.NoError(t, err)
+
+	unit, x, y = readJFIFDensity(buf)
+	assert.Equal(t, byte(2), unit)
+	assert.Equal(t, 118, x)
+	assert.Equal(t, 118, y)
+}
+
+func Test_DetermineJPEGVariant(t *testing.T) {
+	buf, err := ioutil.ReadFile(resources + "jpg-orientation-6.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, JPEGVariantEXIF, DetermineJPEGVariant(buf))
+
+	assert.Equal(t, JPEGVariantJFIF, DetermineJPEGVariant([]byte("\xFF\xD8\xFF\xE0\x00\x10JFIF\x00\x01\x01")))
+	assert.Equal(t, JPEGVariantSPIFF, DetermineJPEGVariant([]byte("\xFF\xD8\xFF\xE8\x00\x20SPIFF\x00\x01\x00")))
+	assert.Equal(t, JPEGVariantRaw, DetermineJPEGVariant([]byte("\xFF\xD8\xFF\xDB\x00\x43\x00")))
+	assert.Equal(t, JPEGVariantUnknown, DetermineJPEGVariant([]byte("\xFF\xD8\xFF\xEE\x00\x0EAdobe")))
+	assert.Equal(t, JPEGVariantUnknown, DetermineJPEGVariant([]byte("\xFF\xD8\xFF")))
+	assert.Equal(t, JPEGVariantUnknown, DetermineJPEGVariant([]byte("\x89PNG\r\n\x1a\n")))
+}
+
+func Test_JPEGInfo(t *testing.T) {
+	tests := []struct {
+		file     string
+		expected JPEGHeader
+	}{
+		{"orientation-issue-1.jpg", JPEGHeader{
+			Width: 4032, Height: 3024, Precision: 8, Components: 3, Subsampling: "4:2:0",
+			SamplingFactors: [][2]int{{2, 2}, {1, 1}, {1, 1}}, ColorTransform: JPEGColorTransformYCbCr,
+		}},
+		{"jpg-24bit.jpg", JPEGHeader{
+			Width: 100, Height: 100, Precision: 8, Components: 3, Progressive: true, Subsampling: "4:4:4",
+			SamplingFactors: [][2]int{{1, 1}, {1, 1}, {1, 1}}, ColorTransform: JPEGColorTransformYCbCr,
+		}},
+		{"without_exif.jpg", JPEGHeader{
+			Width: 100, Height: 100, Precision: 8, Components: 1,
+			SamplingFactors: [][2]int{{1, 1}}, ColorTransform: JPEGColorTransformNone,
+		}},
+		{"jpg-32bit-cmyk-icc-swop.jpg", JPEGHeader{
+			Width: 1080, Height: 1080, Precision: 8, Components: 4, Subsampling: "4:4:4",
+			SamplingFactors: [][2]int{{1, 1}, {1, 1}, {1, 1}, {1, 1}}, ColorTransform: JPEGColorTransformYCCK,
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			buf, err := ioutil.ReadFile(resources + tt.file)
+			require.NoError(t, err)
+
+			header, err := JPEGInfo(buf)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, *header)
+		})
+	}
+
+	_, err := JPEGInfo([]byte("not a jpeg"))
+	assert.Error(t, err)
+}
+
+func TestImageRef_Metadata_JPEGVariant(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "jpg-orientation-6.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, JPEGVariantEXIF, img.Metadata().JPEGVariant)
+
+	img, err = NewImageFromFile(resources + "png-24bit.png")
+	require.NoError(t, err)
+	assert.Equal(t, JPEGVariantUnknown, img.Metadata().JPEGVariant)
+}
+
+func Test_EstimateJPEGQuality(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "png-24bit.png")
+	require.NoError(t, err)
+
+	for _, quality := range []int{30, 75, 90} {
+		params := NewDefaultJPEGExportParams()
+		params.Quality = quality
+
+		buf, _, err := img.Export(params)
+		require.NoError(t, err)
+
+		estimate, err := EstimateJPEGQuality(buf)
+		require.NoError(t, err)
+		assert.InDelta(t, quality, estimate, 5)
+	}
+}
+
+func Test_EstimateJPEGQuality__NotJPEG(t *testing.T) {
+	buf, err := ioutil.ReadFile(resources + "png-24bit.png")
+	require.NoError(t, err)
+
+	_, err = EstimateJPEGQuality(buf)
+	assert.Equal(t, ErrUnsupportedImageFormat, err)
+
+	_, err = EstimateJPEGQuality([]byte{0xFF, 0xD8, 0xFF, 0xD9})
+	assert.Error(t, err)
+}
+
+func TestImageRef_JPEGComment(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources + "png-24bit.png")
+	require.NoError(t, err)
+
+	_, ok := img.JPEGComment()
+	assert.False(t, ok)
+
+	err = img.SetJPEGComment("build 1234")
+	require.NoError(t, err)
+
+	buf, _, err := img.Export(NewDefaultJPEGExportParams())
+	require.NoError(t, err)
+
+	loaded, err := NewImageFromBuffer(buf)
+	require.NoError(t, err)
+
+	comment, ok := loaded.JPEGComment()
+	assert.True(t, ok)
+	assert.Equal(t, "build 1234", comment)
+
+	err = loaded.SetJPEGComment("")
+	require.NoError(t, err)
+
+	_, ok = loaded.JPEGComment()
+	assert.False(t, ok)
+}
+
+func Test_OptimizeJPEG(t *testing.T) {
+	for _, file := range []string{"without_exif.jpg", "jpg-32bit-cmyk-icc-swop.jpg", "jpg-orientation-6.jpg"} {
+		buf := readTestFile(t, file)
+
+		optimized, err := OptimizeJPEG(buf)
+		require.NoError(t, err)
+		assert.Less(t, len(optimized), len(buf), file)
+		assertSameJPEGPixels(t, buf, optimized, file)
+
+		// the sampling factors are kept, e.g. 4:4:4 is not subsampled
+		original, err := JPEGInfo(buf)
+		require.NoError(t, err)
+		info, err := JPEGInfo(optimized)
+		require.NoError(t, err)
+		assert.Equal(t, original.SamplingFactors, info.SamplingFactors, file)
+		assert.False(t, info.Progressive, file)
+	}
+
+	progressive := readTestFile(t, "jpg-24bit.jpg")
+	optimized, err := OptimizeJPEG(progressive)
+	require.NoError(t, err)
+	assert.Equal(t, progressive, optimized)
+
+	_, err = OptimizeJPEG([]byte("not a jpeg"))
+	assert.Equal(t, ErrUnsupportedImageFormat, err)
+}
@@ -42,3 +42,41 @@ int label(VipsImage *in, VipsImage **out, LabelOptions *o) {
 	return 0;
 }
 
+// renders the text as a mask, colors it and composites it onto the image at x, y. The alpha band composite
+// adds is removed again for images without alpha, it is opaque everywhere.
+int draw_text(VipsImage *in, VipsImage **out, const char *text, const char *font, int width, VipsAlign align, int dpi,
+	double r, double g, double b, double a, int x, int y) {
+	double ones[3] = { 1, 1, 1 };
+	double color[3] = { r, g, b };
+	VipsImage *base = vips_image_new();
+	VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 8);
+
+	if (
+		vips_text(&t[0], text,
+			"font", font,
+			"width", width,
+			"align", align,
+			"dpi", dpi,
+			NULL) ||
+		vips_black(&t[1], t[0]->Xsize, t[0]->Ysize, "bands", 3, NULL) ||
+		vips_linear(t[1], &t[2], ones, color, 3, NULL) ||
+		vips_linear1(t[0], &t[3], a / 255.0, 0, NULL) ||
+		vips_bandjoin2(t[2], t[3], &t[4], NULL) ||
+		vips_cast(t[4], &t[5], VIPS_FORMAT_UCHAR, NULL) ||
+		vips_copy(t[5], &t[6], "interpretation", VIPS_INTERPRETATION_sRGB, NULL) ||
+		vips_composite2(in, t[6], &t[7], VIPS_BLEND_MODE_OVER, "x", x, "y", y, NULL)
+		) {
+		g_object_unref(base);
+		return -1;
+	}
+
+	int code = 0;
+	if (vips_image_hasalpha(in)) {
+		code = vips_copy(t[7], out, NULL);
+	} else {
+		code = vips_extract_band(t[7], out, 0, "n", t[7]->Bands - 1, NULL);
+	}
+
+	g_object_unref(base);
+	return code;
+}
@@ -3,7 +3,12 @@ package vips
 // #cgo pkg-config: vips
 // #include "label.h"
 import "C"
-import "unsafe"
+import (
+	"html"
+	"strconv"
+	"strings"
+	"unsafe"
+)
 
 // Align represents VIPS_ALIGN
 type Align int
@@ -83,3 +88,75 @@ func labelImage(in *C.VipsImage, params *LabelParams) (*C.VipsImage, error) {
 
 	return out, nil
 }
+
+// TextOptions are options when drawing text with DrawText. Font is a Pango font description such as
+// "sans bold 12", Size overrides the size in points given in Font. Lines are wrapped at Width pixels and
+// aligned with Align; a Width of 0 disables wrapping. X and Y are the position of the top left corner of the
+// text, Color.A is its opacity. Set Markup to interpret the text as Pango markup instead of plain text.
+type TextOptions struct {
+	Font   string
+	Size   int
+	Color  ColorRGBA
+	Align  Align
+	Width  int
+	DPI    int
+	X, Y   int
+	Markup bool
+}
+
+// NewDefaultTextOptions creates default values for drawing opaque black text with the DefaultFont at 72 DPI
+func NewDefaultTextOptions() *TextOptions {
+	return &TextOptions{
+		Font:  DefaultFont,
+		Color: ColorRGBA{A: 255},
+		Align: AlignLow,
+		DPI:   72,
+	}
+}
+
+// textFont returns the Pango font description with the size replaced by the given size in points
+func textFont(font string, size int) string {
+	if font == "" {
+		font = DefaultFont
+	}
+	if size <= 0 {
+		return font
+	}
+
+	fields := strings.Fields(font)
+	if len(fields) > 1 {
+		if _, err := strconv.ParseFloat(fields[len(fields)-1], 64); err == nil {
+			fields = fields[:len(fields)-1]
+		}
+	}
+
+	return strings.Join(fields, " ") + " " + strconv.Itoa(size)
+}
+
+func vipsDrawText(in *C.VipsImage, text string, opts *TextOptions) (*C.VipsImage, error) {
+	incOpCounter("draw_text")
+	var out *C.VipsImage
+
+	if !opts.Markup {
+		text = html.EscapeString(text)
+	}
+
+	cText := C.CString(text)
+	defer freeCString(cText)
+
+	cFont := C.CString(textFont(opts.Font, opts.Size))
+	defer freeCString(cFont)
+
+	dpi := opts.DPI
+	if dpi <= 0 {
+		dpi = 72
+	}
+
+	if err := C.draw_text(in, &out, cText, cFont, C.int(opts.Width), C.VipsAlign(opts.Align), C.int(dpi),
+		C.double(opts.Color.R), C.double(opts.Color.G), C.double(opts.Color.B), C.double(opts.Color.A),
+		C.int(opts.X), C.int(opts.Y)); err != 0 {
+		return nil, handleImageError(out)
+	}
+
+	return out, nil
+}
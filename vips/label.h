@@ -17,4 +17,7 @@ typedef struct {
 
 int label(VipsImage *in, VipsImage **out, LabelOptions *o);
 
+int draw_text(VipsImage *in, VipsImage **out, const char *text, const char *font, int width, VipsAlign align, int dpi,
+	double r, double g, double b, double a, int x, int y);
+
 int text(VipsImage **out, const char *text, const char *font, int width, int height, VipsAlign align, int dpi);
@@ -0,0 +1,42 @@
+package vips
+
+import (
+	"bytes"
+	"regexp"
+)
+
+var (
+	pdfAcroFormPattern = regexp.MustCompile(`/AcroForm[\s<\d]`)
+	pdfAnnotsPattern   = regexp.MustCompile(`/Annots\s*(\[([^\]]*)\]|\d+\s+\d+\s+R)`)
+)
+
+// PDFInfo describes interactive content of a PDF document.
+type PDFInfo struct {
+	HasForm        bool
+	HasAnnotations bool
+}
+
+// InspectPDF reports whether a PDF document has form fields (an AcroForm) or pages with annotations.
+// libvips does not expose this, so the document is scanned for the corresponding dictionary keys. Keys
+// inside compressed object streams (PDF 1.5+) are not visible to the scan and are reported as absent.
+// Note that annotations, including form widgets, are rendered when the PDF is loaded.
+func InspectPDF(buf []byte) (*PDFInfo, error) {
+	if !isPDF(buf) {
+		return nil, ErrUnsupportedImageFormat
+	}
+
+	info := &PDFInfo{
+		HasForm: pdfAcroFormPattern.Match(buf),
+	}
+
+	for _, match := range pdfAnnotsPattern.FindAllSubmatch(buf, -1) {
+		// skip empty annotation arrays
+		if match[1][0] == '[' && len(bytes.TrimSpace(match[2])) == 0 {
+			continue
+		}
+		info.HasAnnotations = true
+		break
+	}
+
+	return info, nil
+}
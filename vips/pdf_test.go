@@ -0,0 +1,34 @@
+package vips
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_InspectPDF(t *testing.T) {
+	buf, err := ioutil.ReadFile(resources + "pdf.pdf")
+	require.NoError(t, err)
+
+	info, err := InspectPDF(buf)
+	require.NoError(t, err)
+	assert.False(t, info.HasForm)
+	assert.False(t, info.HasAnnotations)
+
+	form := []byte("%PDF-1.4\n1 0 obj\n<< /Type /Catalog /Pages 2 0 R /AcroForm 5 0 R >>\nendobj\n" +
+		"3 0 obj\n<< /Type /Page /Parent 2 0 R /Annots [6 0 R] >>\nendobj\n")
+	info, err = InspectPDF(form)
+	require.NoError(t, err)
+	assert.True(t, info.HasForm)
+	assert.True(t, info.HasAnnotations)
+
+	empty := []byte("%PDF-1.4\n3 0 obj\n<< /Type /Page /Parent 2 0 R /Annots [ ] >>\nendobj\n")
+	info, err = InspectPDF(empty)
+	require.NoError(t, err)
+	assert.False(t, info.HasAnnotations)
+
+	_, err = InspectPDF([]byte("not a pdf"))
+	assert.Equal(t, ErrUnsupportedImageFormat, err)
+}
@@ -0,0 +1,118 @@
+package vips
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// QOI is decoded by govips itself as libvips has no loader for it, see https://qoiformat.org/qoi-specification.pdf
+var qoiHeader = []byte("qoif")
+
+const (
+	qoiHeaderSize = 14
+	// the specification limits images to 400 million pixels
+	qoiMaxPixels = 400000000
+	// a run op encodes at most 62 pixels in one byte
+	qoiMaxRun = 62
+
+	qoiOpRGB   = 0xfe
+	qoiOpRGBA  = 0xff
+	qoiOpIndex = 0x00
+	qoiOpDiff  = 0x40
+	qoiOpLuma  = 0x80
+	qoiOpRun   = 0xc0
+	qoiMask2   = 0xc0
+)
+
+var errInvalidQOI = errors.New("invalid QOI image")
+
+func isQOI(buf []byte) bool {
+	return bytes.HasPrefix(buf, qoiHeader)
+}
+
+// decodeQOI decodes a QOI image into interleaved 8-bit samples with 3 (RGB) or 4 (RGBA) channels.
+// The colorspace byte of the header is informative only and ignored. Images with more than maxPixels
+// pixels are rejected before anything is allocated, unless maxPixels is 0 or less.
+func decodeQOI(buf []byte, maxPixels int) ([]byte, int, int, int, error) {
+	if len(buf) < qoiHeaderSize || !isQOI(buf) {
+		return nil, 0, 0, 0, errInvalidQOI
+	}
+
+	width := int(binary.BigEndian.Uint32(buf[4:8]))
+	height := int(binary.BigEndian.Uint32(buf[8:12]))
+	channels := int(buf[12])
+
+	pixels := int64(width) * int64(height)
+	if width == 0 || height == 0 || pixels > qoiMaxPixels || (channels != 3 && channels != 4) {
+		return nil, 0, 0, 0, errInvalidQOI
+	}
+
+	if maxPixels > 0 && pixels > int64(maxPixels) {
+		return nil, 0, 0, 0, fmt.Errorf("%w: %dx%d is larger than %d pixels",
+			ErrMaxRasterPixelsExceeded, width, height, maxPixels)
+	}
+
+	data := buf[qoiHeaderSize:]
+	if pixels > int64(len(data))*qoiMaxRun {
+		return nil, 0, 0, 0, errInvalidQOI
+	}
+
+	var index [64][4]byte
+	px := [4]byte{0, 0, 0, 255}
+	out := make([]byte, 0, int(pixels)*channels)
+	run := 0
+	pos := 0
+
+	for i := int64(0); i < pixels; i++ {
+		if run > 0 {
+			run--
+		} else {
+			if pos >= len(data) {
+				return nil, 0, 0, 0, errInvalidQOI
+			}
+			op := data[pos]
+			pos++
+
+			switch {
+			case op == qoiOpRGB:
+				if pos+3 > len(data) {
+					return nil, 0, 0, 0, errInvalidQOI
+				}
+				copy(px[:3], data[pos:pos+3])
+				pos += 3
+			case op == qoiOpRGBA:
+				if pos+4 > len(data) {
+					return nil, 0, 0, 0, errInvalidQOI
+				}
+				copy(px[:], data[pos:pos+4])
+				pos += 4
+			case op&qoiMask2 == qoiOpIndex:
+				px = index[op]
+			case op&qoiMask2 == qoiOpDiff:
+				px[0] += (op>>4)&0x03 - 2
+				px[1] += (op>>2)&0x03 - 2
+				px[2] += op&0x03 - 2
+			case op&qoiMask2 == qoiOpLuma:
+				if pos >= len(data) {
+					return nil, 0, 0, 0, errInvalidQOI
+				}
+				diff := data[pos]
+				pos++
+				dg := op&0x3f - 32
+				px[0] += dg - 8 + (diff>>4)&0x0f
+				px[1] += dg
+				px[2] += dg - 8 + diff&0x0f
+			case op&qoiMask2 == qoiOpRun:
+				run = int(op & 0x3f)
+			}
+
+			index[(int(px[0])*3+int(px[1])*5+int(px[2])*7+int(px[3])*11)%64] = px
+		}
+
+		out = append(out, px[:channels]...)
+	}
+
+	return out, width, height, channels, nil
+}
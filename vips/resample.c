@@ -20,8 +20,79 @@ int resize_image(VipsImage *in, VipsImage **out, double scale, gdouble vscale, i
 	return vips_resize(in, out, scale, "kernel", kernel, NULL);
 }
 
-int thumbnail_image(VipsImage *in, VipsImage **out, int width, int height, int crop) {
-	return vips_thumbnail_image(in, out, width, "height", height, "crop", crop, NULL);
+// resizes in linear light: the color bands are converted to scRGB and the alpha band, if any, is scaled to
+// 0-1 so that the color can be premultiplied in float. Afterwards both are converted back to the format of in.
+int resize_image_linear(VipsImage *in, VipsImage **out, double scale, gdouble vscale, int kernel, double max_alpha) {
+	VipsImage *base = vips_image_new();
+	VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 14);
+	int alpha = vips_image_hasalpha(in);
+	int bands = alpha ? in->Bands - 1 : in->Bands;
+
+	if (
+		vips_extract_band(in, &t[0], 0, "n", bands, NULL) ||
+		vips_colourspace(t[0], &t[1], VIPS_INTERPRETATION_scRGB, NULL)
+		) {
+		g_object_unref(base);
+		return -1;
+	}
+
+	if (!alpha) {
+		if (
+			resize_image(t[1], &t[2], scale, vscale, kernel) ||
+			vips_colourspace(t[2], &t[3], in->Type, NULL) ||
+			vips_cast(t[3], out, in->BandFmt, NULL)
+			) {
+			g_object_unref(base);
+			return -1;
+		}
+
+		g_object_unref(base);
+		return 0;
+	}
+
+	if (
+		vips_extract_band(in, &t[4], bands, NULL) ||
+		vips_linear1(t[4], &t[5], 1.0 / max_alpha, 0, NULL) ||
+		vips_bandjoin2(t[1], t[5], &t[6], NULL) ||
+		vips_premultiply(t[6], &t[7], "max_alpha", 1.0, NULL) ||
+		resize_image(t[7], &t[8], scale, vscale, kernel) ||
+		vips_unpremultiply(t[8], &t[9], "max_alpha", 1.0, NULL) ||
+		vips_extract_band(t[9], &t[10], 0, "n", t[9]->Bands - 1, NULL) ||
+		vips_colourspace(t[10], &t[11], in->Type, NULL) ||
+		vips_extract_band(t[9], &t[12], t[9]->Bands - 1, NULL) ||
+		vips_linear1(t[12], &t[13], max_alpha, 0, NULL) ||
+		vips_bandjoin2(t[11], t[13], &t[2], NULL) ||
+		vips_cast(t[2], out, in->BandFmt, NULL)
+		) {
+		g_object_unref(base);
+		return -1;
+	}
+
+	g_object_unref(base);
+	return 0;
+}
+
+int thumbnail_image(VipsImage *in, VipsImage **out, int width, int height, int crop, int linear) {
+	return vips_thumbnail_image(in, out, width, "height", height, "crop", crop, "linear", linear, NULL);
+}
+
+// loads the image with sequential access and shrink-on-load where the format supports it, otherwise the
+// decoded lines are streamed through the shrink so that the full size image is never held in memory
+int thumbnail_buffer(void *buf, size_t len, VipsImage **out, int width, int height, int crop, int linear) {
+	VipsImage *thumbnail;
+
+	if (vips_thumbnail_buffer(buf, len, &thumbnail, width, "height", height, "crop", crop, "linear", linear, NULL)) {
+		return -1;
+	}
+
+	// run the pipeline once while the source buffer is still referenced
+	*out = vips_image_copy_memory(thumbnail);
+	g_object_unref(thumbnail);
+	if (!*out) {
+		return -1;
+	}
+
+	return 0;
 }
 
 int mapim(VipsImage *in, VipsImage **out, VipsImage *index) {
@@ -4,6 +4,11 @@ package vips
 // #include "resample.h"
 import "C"
 
+import (
+	"runtime"
+	"unsafe"
+)
+
 // Kernel represents VipsKernel type
 type Kernel int
 
@@ -18,6 +23,61 @@ const (
 	KernelMitchell Kernel = C.VIPS_KERNEL_MITCHELL
 )
 
+// ResizeOption is an option for Resize, ResizeWithVScale, Thumbnail and NewThumbnailFromBuffer
+type ResizeOption func(o *resizeOptions)
+
+type resizeOptions struct {
+	linear bool
+}
+
+// WithLinearResize resamples in linear light instead of in sRGB, which darkens fine detail such as hair or
+// foliage when downscaling. It is slower, as the pixels are resampled as float, and it disables shrink-on-load
+// in NewThumbnailFromBuffer. Resize only applies it to sRGB and grey images, other color spaces are resized as is.
+func WithLinearResize() ResizeOption {
+	return func(o *resizeOptions) {
+		o.linear = true
+	}
+}
+
+func newResizeOptions(opts []ResizeOption) resizeOptions {
+	var o resizeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// canResizeLinear reports whether the image can be converted to linear light and back for resizing
+func canResizeLinear(in *C.VipsImage) bool {
+	switch Interpretation(in.Type) {
+	case InterpretationSRGB, InterpretationRGB16, InterpretationBW, InterpretationGrey16:
+		return true
+	}
+	return false
+}
+
+// vipsResizeLinear resizes in linear light, vscale is ignored unless positive
+func vipsResizeLinear(in *C.VipsImage, scale, vscale float64, kernel Kernel) (*C.VipsImage, error) {
+	incOpCounter("resize_linear")
+	var out *C.VipsImage
+
+	// libvips recommends Lanczos3 as the default kernel
+	if kernel == KernelAuto {
+		kernel = KernelLanczos3
+	}
+
+	maxAlpha := 255.0
+	if BandFormat(in.BandFmt) == BandFormatUshort {
+		maxAlpha = 65535
+	}
+
+	if err := C.resize_image_linear(in, &out, C.double(scale), C.double(vscale), C.int(kernel), C.double(maxAlpha)); err != 0 {
+		return nil, handleImageError(out)
+	}
+
+	return out, nil
+}
+
 // https://libvips.github.io/libvips/API/current/libvips-resample.html#vips-resize
 func vipsResize(in *C.VipsImage, scale float64, kernel Kernel) (*C.VipsImage, error) {
 	incOpCounter("resize")
@@ -47,11 +107,27 @@ func vipsResizeWithVScale(in *C.VipsImage, scale, vscale float64, kernel Kernel)
 	return out, nil
 }
 
-func vipsThumbnail(in *C.VipsImage, width, height int, crop Interesting) (*C.VipsImage, error) {
+func vipsThumbnail(in *C.VipsImage, width, height int, crop Interesting, linear bool) (*C.VipsImage, error) {
 	incOpCounter("thumbnail")
 	var out *C.VipsImage
 
-	if err := C.thumbnail_image(in, &out, C.int(width), C.int(height), C.int(crop)); err != 0 {
+	if err := C.thumbnail_image(in, &out, C.int(width), C.int(height), C.int(crop), C.int(boolToInt(linear))); err != 0 {
+		return nil, handleImageError(out)
+	}
+
+	return out, nil
+}
+
+// https://libvips.github.io/libvips/API/current/libvips-resample.html#vips-thumbnail-buffer
+func vipsThumbnailFromBuffer(buf []byte, width, height int, crop Interesting, linear bool) (*C.VipsImage, error) {
+	incOpCounter("thumbnail_buffer")
+	var out *C.VipsImage
+
+	src := buf
+	// Reference src here so it's not garbage collected while the thumbnail is rendered.
+	defer runtime.KeepAlive(src)
+
+	if err := C.thumbnail_buffer(unsafe.Pointer(&src[0]), C.size_t(len(src)), &out, C.int(width), C.int(height), C.int(crop), C.int(boolToInt(linear))); err != 0 {
 		return nil, handleImageError(out)
 	}
 
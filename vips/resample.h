@@ -7,5 +7,7 @@ int shrink_image(VipsImage *in, VipsImage **out, double xshrink, double yshrink)
 int reduce_image(VipsImage *in, VipsImage **out, double xshrink, double yshrink);
 int affine_image(VipsImage *in, VipsImage **out, double a, double b, double c, double d, VipsInterpolate *interpolator);
 int resize_image(VipsImage *in, VipsImage **out, double scale, gdouble vscale, int kernel);
-int thumbnail_image(VipsImage *in, VipsImage **out, int width, int height, int crop);
+int resize_image_linear(VipsImage *in, VipsImage **out, double scale, gdouble vscale, int kernel, double max_alpha);
+int thumbnail_image(VipsImage *in, VipsImage **out, int width, int height, int crop, int linear);
+int thumbnail_buffer(void *buf, size_t len, VipsImage **out, int width, int height, int crop, int linear);
 int mapim(VipsImage *in, VipsImage **out, VipsImage *index);
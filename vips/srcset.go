@@ -0,0 +1,119 @@
+package vips
+
+import (
+	"errors"
+	"fmt"
+)
+
+// SrcSetEntry is an image of a srcset as generated by GenerateSrcSet
+type SrcSetEntry struct {
+	Width  int
+	Height int
+	Buf    []byte
+}
+
+// jpegShrinkFactors are the factors the JPEG loader can shrink by while decoding, largest first
+var jpegShrinkFactors = []int{8, 4, 2}
+
+// GenerateSrcSet produces the image at each of the given widths for a responsive srcset, keeping the aspect
+// ratio. The image is decoded only once, JPEGs are shrunk on load as far as the largest width allows, and
+// every width is resized from that decoded image and exported with params (nil exports in the source format).
+// The image is rotated according to its EXIF orientation, so the widths are the displayed widths. Widths
+// larger than the image are skipped, as upscaling adds no detail; if all are, the image is returned at its
+// own width. The entries are returned in the order of the widths.
+func GenerateSrcSet(buf []byte, widths []int, params *ExportParams) ([]SrcSetEntry, error) {
+	if len(widths) == 0 {
+		return nil, errors.New("no srcset widths given")
+	}
+
+	maxWidth := 0
+	for _, width := range widths {
+		if width <= 0 {
+			return nil, fmt.Errorf("invalid srcset width %d", width)
+		}
+		if width > maxWidth {
+			maxWidth = width
+		}
+	}
+
+	img, err := NewImageFromBuffer(buf, srcSetImportOptions(buf, maxWidth)...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := img.AutoRotate(); err != nil {
+		return nil, err
+	}
+
+	out, err := vipsCopyImageMemory(img.image)
+	if err != nil {
+		return nil, err
+	}
+	decoded := newImageRef(out, img.format, buf)
+
+	var entries []SrcSetEntry
+	for _, width := range widths {
+		if width > decoded.Width() {
+			continue
+		}
+
+		entry, err := srcSetEntry(decoded, width, params)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	if len(entries) == 0 {
+		entry, err := srcSetEntry(decoded, decoded.Width(), params)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// srcSetImportOptions picks the largest JPEG shrink-on-load factor which keeps the image at least maxWidth wide
+func srcSetImportOptions(buf []byte, maxWidth int) []ImportOption {
+	if DetermineImageType(buf) != ImageTypeJPEG {
+		return nil
+	}
+
+	header, err := NewImageFromBuffer(buf)
+	if err != nil {
+		return nil
+	}
+
+	width := header.Width()
+	if orientation := header.GetOrientation(); orientation >= 5 && orientation <= 8 {
+		width = header.Height()
+	}
+
+	for _, shrink := range jpegShrinkFactors {
+		if width/shrink >= maxWidth {
+			return []ImportOption{ShrinkParamImportOption(shrink)}
+		}
+	}
+	return nil
+}
+
+func srcSetEntry(decoded *ImageRef, width int, params *ExportParams) (SrcSetEntry, error) {
+	img, err := decoded.Copy()
+	if err != nil {
+		return SrcSetEntry{}, err
+	}
+
+	// the height of the decoded image never limits a downscale to the width
+	if err := img.Thumbnail(width, decoded.Height(), InterestingNone); err != nil {
+		return SrcSetEntry{}, err
+	}
+
+	out, _, err := img.Export(params)
+	if err != nil {
+		return SrcSetEntry{}, err
+	}
+
+	return SrcSetEntry{Width: img.Width(), Height: img.Height(), Buf: out}, nil
+}
@@ -0,0 +1,64 @@
+package vips
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateSrcSet(t *testing.T) {
+	Startup(nil)
+
+	buf, err := ioutil.ReadFile(resources + "png-24bit.png")
+	require.NoError(t, err)
+
+	entries, err := GenerateSrcSet(buf, []int{640, 320, 3000}, NewDefaultWEBPExportParams())
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	for i, width := range []int{640, 320} {
+		assert.Equal(t, width, entries[i].Width)
+		assert.Equal(t, ImageTypeWEBP, DetermineImageType(entries[i].Buf))
+
+		img, err := NewImageFromBuffer(entries[i].Buf)
+		require.NoError(t, err)
+		assert.Equal(t, width, img.Width())
+		assert.Equal(t, entries[i].Height, img.Height())
+	}
+	assert.Equal(t, 360, entries[0].Height)
+
+	entries, err = GenerateSrcSet(buf, []int{4000}, nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, 1920, entries[0].Width)
+	assert.Equal(t, ImageTypePNG, DetermineImageType(entries[0].Buf))
+}
+
+func TestGenerateSrcSet__JPEGShrinkOnLoad(t *testing.T) {
+	Startup(nil)
+
+	buf, err := ioutil.ReadFile(resources + "orientation-issue-1.jpg")
+	require.NoError(t, err)
+
+	// 3024 pixels wide once rotated, so a largest width of 700 allows shrinking by 4 on load
+	assert.Len(t, srcSetImportOptions(buf, 700), 1)
+	assert.Len(t, srcSetImportOptions(buf, 2000), 0)
+
+	entries, err := GenerateSrcSet(buf, []int{400, 700}, nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, 400, entries[0].Width)
+	assert.Equal(t, 700, entries[1].Width)
+	assert.Equal(t, 933, entries[1].Height)
+	assert.Equal(t, ImageTypeJPEG, DetermineImageType(entries[1].Buf))
+}
+
+func TestGenerateSrcSet__InvalidWidths(t *testing.T) {
+	_, err := GenerateSrcSet([]byte("not an image"), nil, nil)
+	assert.Error(t, err)
+
+	_, err = GenerateSrcSet([]byte("not an image"), []int{100, 0}, nil)
+	assert.Error(t, err)
+}
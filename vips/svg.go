@@ -0,0 +1,176 @@
+package vips
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"golang.org/x/net/html/charset"
+)
+
+// svgUnits holds the size of the absolute CSS units in CSS pixels
+var svgUnits = map[string]float64{
+	"":   1,
+	"px": 1,
+	"in": 96,
+	"cm": 96 / 2.54,
+	"mm": 96 / 25.4,
+	"pt": 96.0 / 72,
+	"pc": 16,
+}
+
+// SVGInfo returns the intrinsic width and height of an SVG document in CSS pixels along with its viewBox
+// (min-x, min-y, width, height), e.g. to compute the scale for rendering it at an exact size. A missing or
+// relative (percentage) width or height is taken from the viewBox; it is 0 if the viewBox is missing too.
+func SVGInfo(buf []byte) (width, height float64, viewBox [4]float64, err error) {
+	root, err := readSVGRoot(buf)
+	if err != nil {
+		return 0, 0, viewBox, err
+	}
+
+	var hasViewBox bool
+	var attrWidth, attrHeight string
+	for _, attr := range root.Attr {
+		switch attr.Name.Local {
+		case "width":
+			attrWidth = attr.Value
+		case "height":
+			attrHeight = attr.Value
+		case "viewBox":
+			if viewBox, err = parseSVGViewBox(attr.Value); err != nil {
+				return 0, 0, viewBox, err
+			}
+			hasViewBox = true
+		}
+	}
+
+	width, ok, err := parseSVGLength(attrWidth)
+	if err != nil {
+		return 0, 0, viewBox, err
+	}
+	if !ok && hasViewBox {
+		width = viewBox[2]
+	}
+
+	height, ok, err = parseSVGLength(attrHeight)
+	if err != nil {
+		return 0, 0, viewBox, err
+	}
+	if !ok && hasViewBox {
+		height = viewBox[3]
+	}
+
+	return width, height, viewBox, nil
+}
+
+// readSVGRoot returns the root element of an SVG document
+func readSVGRoot(buf []byte) (xml.StartElement, error) {
+	decoder := newSVGDecoder(svgText(buf))
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return xml.StartElement{}, ErrUnsupportedImageFormat
+		}
+		if element, ok := token.(xml.StartElement); ok {
+			if element.Name.Local != "svg" {
+				return xml.StartElement{}, ErrUnsupportedImageFormat
+			}
+			return element, nil
+		}
+	}
+}
+
+var (
+	utf8BOM    = []byte("\xEF\xBB\xBF")
+	utf16LEBOM = []byte("\xFF\xFE")
+	utf16BEBOM = []byte("\xFE\xFF")
+)
+
+// svgText returns the SVG document as UTF-8 without byte order mark. UTF-16 documents are detected by
+// their byte order mark or, without one, by the zero bytes around the leading "<".
+func svgText(buf []byte) []byte {
+	switch {
+	case bytes.HasPrefix(buf, utf8BOM):
+		return buf[len(utf8BOM):]
+	case bytes.HasPrefix(buf, utf16LEBOM):
+		return utf16ToUTF8(buf[len(utf16LEBOM):], binary.LittleEndian)
+	case bytes.HasPrefix(buf, utf16BEBOM):
+		return utf16ToUTF8(buf[len(utf16BEBOM):], binary.BigEndian)
+	case len(buf) >= 2 && buf[0] == '<' && buf[1] == 0:
+		return utf16ToUTF8(buf, binary.LittleEndian)
+	case len(buf) >= 2 && buf[0] == 0 && buf[1] == '<':
+		return utf16ToUTF8(buf, binary.BigEndian)
+	}
+	return buf
+}
+
+func utf16ToUTF8(buf []byte, order binary.ByteOrder) []byte {
+	units := make([]uint16, len(buf)/2)
+	for i := range units {
+		units[i] = order.Uint16(buf[2*i:])
+	}
+	return []byte(string(utf16.Decode(units)))
+}
+
+// newSVGDecoder returns a lenient XML decoder for a document returned by svgText. As UTF-16 documents are
+// already converted to UTF-8, a declared UTF-16 encoding is ignored.
+func newSVGDecoder(text []byte) *xml.Decoder {
+	decoder := xml.NewDecoder(bytes.NewReader(text))
+	decoder.Strict = false
+	decoder.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		if strings.HasPrefix(strings.ToLower(label), "utf-16") {
+			return input, nil
+		}
+		return charset.NewReaderLabel(label, input)
+	}
+	return decoder
+}
+
+// parseSVGLength parses an absolute length in CSS pixels. Empty and percentage lengths are not absolute.
+func parseSVGLength(value string) (float64, bool, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || strings.HasSuffix(value, "%") {
+		return 0, false, nil
+	}
+
+	number := strings.TrimRight(value, "abcdefghijklmnopqrstuvwxyz")
+	scale, ok := svgUnits[value[len(number):]]
+	if !ok {
+		return 0, false, fmt.Errorf("unsupported SVG length %q", value)
+	}
+
+	length, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid SVG length %q", value)
+	}
+
+	return length * scale, true, nil
+}
+
+// parseSVGViewBox parses the four numbers of a viewBox, separated by whitespace and/or a comma
+func parseSVGViewBox(value string) ([4]float64, error) {
+	var viewBox [4]float64
+
+	fields := strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+	if len(fields) != 4 {
+		return viewBox, fmt.Errorf("invalid SVG viewBox %q", value)
+	}
+
+	for i, field := range fields {
+		number, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return viewBox, fmt.Errorf("invalid SVG viewBox %q", value)
+		}
+		viewBox[i] = number
+	}
+
+	return viewBox, nil
+}
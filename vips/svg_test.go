@@ -0,0 +1,38 @@
+package vips
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_SVGInfo(t *testing.T) {
+	buf, err := ioutil.ReadFile(resources + "svg.svg")
+	require.NoError(t, err)
+
+	width, height, viewBox, err := SVGInfo(buf)
+	require.NoError(t, err)
+	assert.Equal(t, [4]float64{0, 0, 159.2, 201.5}, viewBox)
+	assert.Equal(t, 159.2, width)
+	assert.Equal(t, 201.5, height)
+
+	sized := []byte(`<svg xmlns="http://www.w3.org/2000/svg" width="1in" height="50%" viewBox="10,20 300 400"></svg>`)
+	width, height, viewBox, err = SVGInfo(sized)
+	require.NoError(t, err)
+	assert.Equal(t, [4]float64{10, 20, 300, 400}, viewBox)
+	assert.Equal(t, 96.0, width)
+	assert.Equal(t, 400.0, height)
+}
+
+func Test_SVGInfo__Invalid(t *testing.T) {
+	_, _, _, err := SVGInfo([]byte(`<html></html>`))
+	assert.Equal(t, ErrUnsupportedImageFormat, err)
+
+	_, _, _, err = SVGInfo([]byte(`<svg width="10em"></svg>`))
+	assert.Error(t, err)
+
+	_, _, _, err = SVGInfo([]byte(`<svg viewBox="0 0 10"></svg>`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,91 @@
+package vips
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// WebP chunk FourCCs, see https://developers.google.com/speed/webp/docs/riff_container
+var (
+	webpChunkVP8X = []byte("VP8X")
+	webpChunkANIM = []byte("ANIM")
+	webpChunkANMF = []byte("ANMF")
+)
+
+// webpChunk is a chunk of a WebP RIFF container. Data is the payload without the chunk header.
+type webpChunk struct {
+	fourCC []byte
+	data   []byte
+}
+
+// webpAnimation holds the canvas and animation parameters from the VP8X and ANIM chunks of an animated WebP
+type webpAnimation struct {
+	canvasWidth  int
+	canvasHeight int
+	background   ColorRGBA
+	loopCount    int
+}
+
+// readWebPChunks returns the chunks of a WebP RIFF container. Truncated chunks end the list.
+func readWebPChunks(buf []byte) []webpChunk {
+	if len(buf) < 12 || !isWEBP(buf) {
+		return nil
+	}
+
+	var chunks []webpChunk
+	pos := 12
+	for pos+8 <= len(buf) {
+		size := int(binary.LittleEndian.Uint32(buf[pos+4 : pos+8]))
+		if size < 0 || pos+8+size > len(buf) {
+			break
+		}
+
+		chunks = append(chunks, webpChunk{
+			fourCC: buf[pos : pos+4],
+			data:   buf[pos+8 : pos+8+size],
+		})
+
+		// chunks are padded to an even size
+		pos += 8 + size + size&1
+	}
+
+	return chunks
+}
+
+// readWebPAnimation reads the canvas size, background color and loop count of an animated WebP
+func readWebPAnimation(buf []byte) (webpAnimation, bool) {
+	var animation webpAnimation
+	var hasCanvas, hasAnimation bool
+
+	for _, chunk := range readWebPChunks(buf) {
+		switch {
+		case bytes.Equal(chunk.fourCC, webpChunkVP8X) && len(chunk.data) >= 10:
+			animation.canvasWidth = readUint24(chunk.data[4:7]) + 1
+			animation.canvasHeight = readUint24(chunk.data[7:10]) + 1
+			hasCanvas = true
+		case bytes.Equal(chunk.fourCC, webpChunkANIM) && len(chunk.data) >= 6:
+			// the background color is stored in blue, green, red, alpha order
+			animation.background = ColorRGBA{R: chunk.data[2], G: chunk.data[1], B: chunk.data[0], A: chunk.data[3]}
+			animation.loopCount = int(binary.LittleEndian.Uint16(chunk.data[4:6]))
+			hasAnimation = true
+		}
+	}
+
+	return animation, hasCanvas && hasAnimation
+}
+
+// setWebPAnimationBackground overwrites the background color of an animated WebP in place
+func setWebPAnimationBackground(buf []byte, color ColorRGBA) bool {
+	for _, chunk := range readWebPChunks(buf) {
+		if bytes.Equal(chunk.fourCC, webpChunkANIM) && len(chunk.data) >= 6 {
+			chunk.data[0], chunk.data[1], chunk.data[2], chunk.data[3] = color.B, color.G, color.R, color.A
+			return true
+		}
+	}
+
+	return false
+}
+
+func readUint24(b []byte) int {
+	return int(b[0]) | int(b[1])<<8 | int(b[2])<<16
+}
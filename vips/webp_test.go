@@ -0,0 +1,89 @@
+package vips
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_readWebPAnimation(t *testing.T) {
+	buf, err := ioutil.ReadFile(resources + "webp-animated+alpha.webp")
+	require.NoError(t, err)
+
+	animation, ok := readWebPAnimation(buf)
+	require.True(t, ok)
+	assert.Equal(t, 480, animation.canvasWidth)
+	assert.Equal(t, 480, animation.canvasHeight)
+	assert.Equal(t, ColorRGBA{R: 255, G: 255, B: 255, A: 255}, animation.background)
+
+	red := ColorRGBA{R: 255, A: 128}
+	assert.True(t, setWebPAnimationBackground(buf, red))
+
+	animation, ok = readWebPAnimation(buf)
+	require.True(t, ok)
+	assert.Equal(t, red, animation.background)
+}
+
+func Test_readWebPAnimation__NotAnimated(t *testing.T) {
+	buf, err := ioutil.ReadFile(resources + "webp+alpha.webp")
+	require.NoError(t, err)
+
+	_, ok := readWebPAnimation(buf)
+	assert.False(t, ok)
+	assert.False(t, setWebPAnimationBackground(buf, ColorRGBA{}))
+}
+
+func TestImageRef_WebPBackground(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources+"webp-animated+alpha.webp", NParamImportOption(-1))
+	require.NoError(t, err)
+
+	background, ok := img.WebPBackground()
+	require.True(t, ok)
+	assert.Equal(t, ColorRGBA{R: 255, G: 255, B: 255, A: 255}, background)
+
+	red := ColorRGBA{R: 255, A: 255}
+	err = img.SetWebPBackground(red)
+	require.NoError(t, err)
+
+	buf, _, err := img.Export(NewDefaultWEBPExportParams())
+	require.NoError(t, err)
+
+	animation, ok := readWebPAnimation(buf)
+	require.True(t, ok)
+	assert.Equal(t, red, animation.background)
+	assert.Equal(t, img.Width(), animation.canvasWidth)
+	assert.Equal(t, img.PageHeight(), animation.canvasHeight)
+}
+
+func TestImageRef_WebPLoop(t *testing.T) {
+	Startup(nil)
+
+	img, err := NewImageFromFile(resources+"webp-animated+alpha.webp", NParamImportOption(-1))
+	require.NoError(t, err)
+
+	loop := 3
+	params := NewDefaultWEBPExportParams()
+	params.Loop = &loop
+
+	buf, _, err := img.Export(params)
+	require.NoError(t, err)
+
+	animation, ok := readWebPAnimation(buf)
+	require.True(t, ok)
+	assert.Equal(t, 3, animation.loopCount)
+
+	// without a Loop param the finite loop count of the source is kept
+	looped, err := NewImageFromBuffer(buf, NParamImportOption(-1))
+	require.NoError(t, err)
+
+	buf, _, err = looped.Export(NewDefaultWEBPExportParams())
+	require.NoError(t, err)
+
+	animation, ok = readWebPAnimation(buf)
+	require.True(t, ok)
+	assert.Equal(t, 3, animation.loopCount)
+}